@@ -0,0 +1,105 @@
+package hdfs
+
+import (
+	"context"
+
+	"github.com/colinmarc/hdfs/v2/internal/rpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// CallerContext describes the caller of namenode operations, like a job or
+// service name. If the namenode has hadoop.caller.context.enabled set, it's
+// recorded in the audit log alongside each operation, which makes it possible
+// to attribute namenode load to the programs causing it.
+//
+// By default, the namenode truncates contexts longer than 128 bytes
+// (hadoop.caller.context.max.size), and ignores signatures longer than 40
+// bytes (hadoop.caller.context.signature.max.size).
+type CallerContext struct {
+	// Context is a free-form description of the caller. If it's empty, no
+	// caller context is sent.
+	Context string
+	// Signature optionally signs Context, so that it can be verified later.
+	Signature []byte
+}
+
+// TraceInfo identifies the trace span that a namenode operation is part of,
+// like the HTrace span IDs sent by the Java client.
+type TraceInfo struct {
+	// TraceID and ParentID are the high and low 64 bits of the ID of the
+	// parent span. If both are zero, no trace information is sent.
+	TraceID  int64
+	ParentID int64
+}
+
+type callerContextKey struct{}
+type traceInfoKey struct{}
+
+// ContextWithCallerContext returns a copy of ctx carrying cc. Namenode
+// operations performed by a Client returned by WithContext send it instead of
+// ClientOptions.CallerContext.
+func ContextWithCallerContext(ctx context.Context, cc CallerContext) context.Context {
+	return context.WithValue(ctx, callerContextKey{}, cc)
+}
+
+// ContextWithTraceInfo returns a copy of ctx carrying ti. Namenode operations
+// performed by a Client returned by WithContext send it to the namenode.
+func ContextWithTraceInfo(ctx context.Context, ti TraceInfo) context.Context {
+	return context.WithValue(ctx, traceInfoKey{}, ti)
+}
+
+// WithContext returns a shallow copy of the Client which uses ctx for all
+// namenode operations, including those performed by any files it opens.
+// Currently, the context is only used for the caller context and trace
+// information set with ContextWithCallerContext and ContextWithTraceInfo, and
+// can't be used to cancel operations.
+//
+// The copy shares the connection to the namenode, and everything else, with
+// the original, so it's cheap to create one per request. Closing either one
+// closes both.
+func (c *Client) WithContext(ctx context.Context) *Client {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	c2 := *c
+	c2.ctx = ctx
+	return &c2
+}
+
+// callInfo returns the caller context and trace information to send with a
+// namenode operation, or nil if there is none.
+func (c *Client) callInfo() *rpc.CallInfo {
+	var cc CallerContext
+	if c.options.CallerContext != nil {
+		cc = *c.options.CallerContext
+	}
+
+	var ti TraceInfo
+	if c.ctx != nil {
+		if v, ok := c.ctx.Value(callerContextKey{}).(CallerContext); ok {
+			cc = v
+		}
+
+		if v, ok := c.ctx.Value(traceInfoKey{}).(TraceInfo); ok {
+			ti = v
+		}
+	}
+
+	if cc.Context == "" && ti.TraceID == 0 && ti.ParentID == 0 {
+		return nil
+	}
+
+	return &rpc.CallInfo{
+		CallerContext:          cc.Context,
+		CallerContextSignature: cc.Signature,
+		TraceID:                ti.TraceID,
+		ParentID:               ti.ParentID,
+	}
+}
+
+// execute performs an RPC call against the namenode, sending along the
+// caller context and trace information, if any.
+func (c *Client) execute(method string, req proto.Message, resp proto.Message) error {
+	return c.namenode.ExecuteWithInfo(method, req, resp, c.callInfo())
+}
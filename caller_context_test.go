@@ -0,0 +1,39 @@
+package hdfs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/colinmarc/hdfs/v2/internal/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallInfo(t *testing.T) {
+	c := &Client{}
+	assert.Nil(t, c.callInfo())
+
+	c.options.CallerContext = &CallerContext{Context: "ingest", Signature: []byte("sig")}
+	assert.Equal(t, &rpc.CallInfo{
+		CallerContext:          "ingest",
+		CallerContextSignature: []byte("sig"),
+	}, c.callInfo())
+
+	ctx := ContextWithTraceInfo(context.Background(), TraceInfo{TraceID: 1, ParentID: 2})
+	c2 := c.WithContext(ctx)
+	assert.Equal(t, &rpc.CallInfo{
+		CallerContext:          "ingest",
+		CallerContextSignature: []byte("sig"),
+		TraceID:                1,
+		ParentID:               2,
+	}, c2.callInfo())
+
+	// The context overrides the caller context from the options, but the
+	// original Client is unaffected.
+	c2 = c2.WithContext(ContextWithCallerContext(ctx, CallerContext{Context: "compaction"}))
+	assert.Equal(t, &rpc.CallInfo{
+		CallerContext: "compaction",
+		TraceID:       1,
+		ParentID:      2,
+	}, c2.callInfo())
+	assert.Equal(t, "ingest", c.callInfo().CallerContext)
+}
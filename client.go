@@ -1,6 +1,7 @@
 package hdfs
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -9,7 +10,11 @@ import (
 	"os"
 	"os/user"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/colinmarc/hdfs/v2/hadoopconf"
 	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
@@ -21,6 +26,10 @@ import (
 
 type dialContext func(ctx context.Context, network, addr string) (net.Conn, error)
 
+// datanodeIPCTimeout limits how long connecting to the IPC port of a datanode,
+// or probing it, can take.
+const datanodeIPCTimeout = 10 * time.Second
+
 const (
 	DataTransferProtectionAuthentication = "authentication"
 	DataTransferProtectionIntegrity      = "integrity"
@@ -33,9 +42,35 @@ const (
 type Client struct {
 	namenode *rpc.NamenodeConnection
 	options  ClientOptions
+	// ctx is the context set by WithContext, if any.
+	ctx context.Context
+
+	cache *serverCache
+
+	hedgedReads  *transfer.HedgedReadPool
+	connCache    *transfer.ConnCache
+	shortCircuit *transfer.ShortCircuitReads
+	topology     *topology
+	deadNodes    *transfer.DeadNodeDetector
 
+	// readThrottler and writeThrottler implement ReadBytesPerSecond and
+	// WriteBytesPerSecond, and are shared by all files.
+	readThrottler  *transfer.Throttler
+	writeThrottler *transfer.Throttler
+
+	// dataTransferCipher holds the cipher negotiated for the most recent
+	// datanode connection.
+	dataTransferCipher *atomic.Value
+}
+
+// serverCache holds information fetched from the namenode, which is shared
+// between a Client and any copies of it made with WithContext.
+type serverCache struct {
 	defaults      *hdfs.FsServerDefaultsProto
 	encryptionKey *hdfs.DataEncryptionKeyProto
+	// lock guards defaults and encryptionKey, so that a Client can be used
+	// from multiple goroutines.
+	lock sync.Mutex
 }
 
 // ClientOptions represents the configurable options for a client.
@@ -62,6 +97,12 @@ type ClientOptions struct {
 	// unless kerberos authentication is enabled, in which case it is overridden
 	// by the username set in KerberosClient.
 	User string
+	// ProxyUser, if set, specifies a user to impersonate. The client
+	// authenticates as User (or the principal of KerberosClient), but all
+	// operations are performed as ProxyUser, like with a proxy user created by
+	// UserGroupInformation.createProxyUser in Hadoop. The namenode must be
+	// configured to allow this, with the hadoop.proxyuser.* properties.
+	ProxyUser string
 	// UseDatanodeHostname specifies whether the client should connect to the
 	// datanodes via hostname (which is useful in multi-homed setups) or IP
 	// address, which may be required if DNS isn't available.
@@ -74,7 +115,9 @@ type ClientOptions struct {
 	DatanodeDialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
 	// KerberosClient is used to connect to kerberized HDFS clusters. If provided,
 	// the client will always mutually authenticate when connecting to the
-	// namenode(s).
+	// namenode(s). If the kerberos client has a keytab (for example, if it was
+	// created with NewKerberosClientWithKeytab), it renews its own ticket
+	// before it expires; otherwise, it can only be used until then.
 	KerberosClient *krb.Client
 	// KerberosServicePrincipleName specifies the Service Principle Name
 	// (<SERVICE>/<FQDN>) for the namenode(s). Like in the
@@ -83,6 +126,13 @@ type ClientOptions struct {
 	// multi-namenode setup (for example: 'nn/_HOST'). It is required if
 	// KerberosClient is provided.
 	KerberosServicePrincipleName string
+	// RPCProtection specifies the acceptable levels of protection for
+	// kerberos connections to the namenode, as a comma-separated list in order
+	// of preference, like hadoop.rpc.protection. The levels are the same as
+	// for DataTransferProtection. If empty, the strongest level the namenode
+	// supports is used. The level actually in use is reported by
+	// Client.RPCProtection.
+	RPCProtection string
 	// DataTransferProtection specifies whether or not authentication, data
 	// signature integrity checks, and wire encryption is required when
 	// communicating the the datanodes. A value of "authentication" implies
@@ -91,8 +141,80 @@ type ClientOptions struct {
 	// Client may negotiate a higher level of protection if it is requested
 	// by the datanode; for example, if the datanode and namenode hdfs-site.xml
 	// has dfs.encrypt.data.transfer enabled, this setting is ignored and
-	// a level of "privacy" is used.
+	// a level of "privacy" is used. For "privacy", the Client asks for AES,
+	// which the datanodes use if they have dfs.encrypt.data.transfer.cipher.suites
+	// set to AES/CTR/NoPadding; see Client.DataTransferCipher.
 	DataTransferProtection string
+	// HedgedReadPoolSize enables hedged reads for FileReader.ReadAt, if it is
+	// positive. If a datanode hasn't returned the data within
+	// HedgedReadThreshold, the read is started again against another replica,
+	// and whichever finishes first is used. HedgedReadPoolSize limits the
+	// number of these extra reads in flight at once across the client.
+	HedgedReadPoolSize int
+	// HedgedReadThreshold specifies how long to wait for a datanode before
+	// starting a hedged read. If zero, a threshold of 500ms is used.
+	HedgedReadThreshold time.Duration
+	// DatanodeConnCacheSize specifies how many idle datanode connections are
+	// kept around to be reused by later reads, which saves reconnecting (and
+	// possibly redoing a SASL handshake) for each one. If zero, up to 16
+	// connections are kept. If negative, connections are never reused.
+	DatanodeConnCacheSize int
+	// DatanodeConnCacheExpiry specifies how long an idle datanode connection is
+	// kept for. It should be shorter than the time the datanodes keep idle
+	// connections open (dfs.datanode.socket.reuse.keepalive). If zero, 3
+	// seconds is used.
+	DatanodeConnCacheExpiry time.Duration
+	// ShortCircuitReads enables reading blocks straight from the local disk,
+	// if one of the datanodes with a replica is running on the same host. The
+	// datanode passes the open block files to the client over the UNIX domain
+	// socket at DomainSocketPath. If this isn't possible for any reason, the
+	// block is read over TCP as usual.
+	ShortCircuitReads bool
+	// DomainSocketPath is the path of the UNIX domain socket used for
+	// short-circuit reads. Any occurrence of "_PORT" is replaced with the
+	// datanode's transfer port.
+	DomainSocketPath string
+	// TopologyResolver, if set, is used to find the client's location in the
+	// network, so that reads can prefer datanodes that are nearby: first on
+	// the same host, then in the same rack, and so on. Replicas that are the
+	// same distance away are picked at random. An empty TopologyTable can be
+	// used to just prefer local datanodes. If nil, replicas are tried in the
+	// order the namenode returns them.
+	TopologyResolver TopologyResolver
+	// DeadNodeExpiry specifies how long a datanode that failed is avoided by
+	// later reads, if other replicas are available. If zero, 10 minutes is
+	// used.
+	DeadNodeExpiry time.Duration
+	// DeadNodeProbeInterval specifies how often datanodes that failed are
+	// checked on in the background (with a getDatanodeInfo call), so that
+	// they can be used again as soon as they've recovered. If zero, 60
+	// seconds is used. If negative, datanodes are only used again once the
+	// DeadNodeExpiry has passed.
+	//
+	// Probing isn't supported with a KerberosClient, since the connection to
+	// the datanode can only use simple authentication, so a secure datanode
+	// would always refuse it. In that case, this option is ignored, and
+	// datanodes are only used again once the DeadNodeExpiry has passed.
+	DeadNodeProbeInterval time.Duration
+	// CallerContext, if set, is sent to the namenode along with every
+	// operation, so that it appears in the namenode's audit log. It can be
+	// overridden for individual operations with ContextWithCallerContext and
+	// Client.WithContext.
+	CallerContext *CallerContext
+	// Observer, if set, is notified of namenode calls, datanode connections,
+	// the data read and written, and failures, so that metrics can be
+	// collected. See PrometheusObserver for an implementation.
+	Observer Observer
+	// ReadBytesPerSecond, if positive, limits the rate at which data is read
+	// from the datanodes, across all the files being read by the Client at
+	// once. It can be overridden for individual files with
+	// FileReader.SetBytesPerSecond. Short-circuit reads aren't limited.
+	ReadBytesPerSecond int64
+	// WriteBytesPerSecond, if positive, limits the rate at which data is
+	// written to the datanodes, across all the files being written by the
+	// Client at once. It can be overridden for individual files with
+	// FileWriter.SetBytesPerSecond.
+	WriteBytesPerSecond int64
 	// skipSaslForPrivilegedDatanodePorts implements a strange edge case present
 	// in the official java client. If data.transfer.protection is set but not
 	// dfs.encrypt.data.transfer, and the datanode is running on a privileged
@@ -122,10 +244,35 @@ type ClientOptions struct {
 //   // (everything after the first '@') chopped off.
 //   KerberosServicePrincipleName string
 //
+//   // Determined by hadoop.rpc.protection.
+//   RPCProtection string
+//
 //   // Determined by dfs.data.transfer.protection or dfs.encrypt.data.transfer
 //   // (in the latter case, it is set to 'privacy').
 //   DataTransferProtection string
 //
+//   // Determined by dfs.client.hedged.read.threadpool.size and
+//   // dfs.client.hedged.read.threshold.millis.
+//   HedgedReadPoolSize int
+//   HedgedReadThreshold time.Duration
+//
+//   // Determined by dfs.client.socketcache.capacity and
+//   // dfs.client.socketcache.expiryMsec.
+//   DatanodeConnCacheSize int
+//   DatanodeConnCacheExpiry time.Duration
+//
+//   // Determined by dfs.client.read.shortcircuit and dfs.domain.socket.path.
+//   ShortCircuitReads bool
+//   DomainSocketPath string
+//
+//   // Determined by net.topology.script.file.name, or
+//   // net.topology.table.file.name if net.topology.node.switch.mapping.impl
+//   // is set to TableMapping.
+//   TopologyResolver TopologyResolver
+//
+//   // Determined by dfs.client.deadnode.detection.probe.deadnode.interval.ms.
+//   DeadNodeProbeInterval time.Duration
+//
 // Because of the way Kerberos can be forced by the Hadoop configuration but not
 // actually configured, you should check for whether KerberosClient is set in
 // the resulting ClientOptions before proceeding:
@@ -151,6 +298,8 @@ func ClientOptionsFromConf(conf hadoopconf.HadoopConf) ClientOptions {
 		options.KerberosServicePrincipleName = strings.Split(conf["dfs.namenode.kerberos.principal"], "@")[0]
 	}
 
+	options.RPCProtection = strings.ToLower(conf["hadoop.rpc.protection"])
+
 	// Note that we take the highest setting, rather than allowing a range of
 	// alternatives. 'authentication', 'integrity', and 'privacy' are
 	// alphabetical for our convenience.
@@ -169,6 +318,48 @@ func ClientOptionsFromConf(conf hadoopconf.HadoopConf) ClientOptions {
 		}
 	}
 
+	if size, err := strconv.Atoi(conf["dfs.client.hedged.read.threadpool.size"]); err == nil {
+		options.HedgedReadPoolSize = size
+	}
+
+	if millis, err := strconv.Atoi(conf["dfs.client.hedged.read.threshold.millis"]); err == nil {
+		options.HedgedReadThreshold = time.Duration(millis) * time.Millisecond
+	}
+
+	if size, err := strconv.Atoi(conf["dfs.client.socketcache.capacity"]); err == nil {
+		// A capacity of zero disables the cache, like in the Java client.
+		if size == 0 {
+			size = -1
+		}
+
+		options.DatanodeConnCacheSize = size
+	}
+
+	if millis, err := strconv.Atoi(conf["dfs.client.socketcache.expiryMsec"]); err == nil {
+		options.DatanodeConnCacheExpiry = time.Duration(millis) * time.Millisecond
+	}
+
+	options.ShortCircuitReads = (conf["dfs.client.read.shortcircuit"] == "true")
+	options.DomainSocketPath = conf["dfs.domain.socket.path"]
+
+	if script := conf["net.topology.script.file.name"]; script != "" {
+		options.TopologyResolver = NewTopologyScript(script)
+	} else if strings.HasSuffix(conf["net.topology.node.switch.mapping.impl"], "TableMapping") &&
+		conf["net.topology.table.file.name"] != "" {
+		// Like in Hadoop, if the table can't be read, every host ends up in
+		// the default rack.
+		table, err := LoadTopologyTable(conf["net.topology.table.file.name"])
+		if err != nil {
+			table = TopologyTable{}
+		}
+
+		options.TopologyResolver = table
+	}
+
+	if millis, err := strconv.Atoi(conf["dfs.client.deadnode.detection.probe.deadnode.interval.ms"]); err == nil {
+		options.DeadNodeProbeInterval = time.Duration(millis) * time.Millisecond
+	}
+
 	if strings.ToLower(conf["dfs.encrypt.data.transfer"]) == "true" {
 		options.DataTransferProtection = "privacy"
 	} else {
@@ -191,13 +382,23 @@ func NewClient(options ClientOptions) (*Client, error) {
 		return nil, errors.New("kerberos enabled, but kerberos namenode SPN is not provided")
 	}
 
+	var rpcProtection []string
+	for _, p := range strings.Split(options.RPCProtection, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			rpcProtection = append(rpcProtection, p)
+		}
+	}
+
 	namenode, err := rpc.NewNamenodeConnection(
 		rpc.NamenodeConnectionOptions{
 			Addresses:                    options.Addresses,
 			User:                         options.User,
+			ProxyUser:                    options.ProxyUser,
 			DialFunc:                     options.NamenodeDialFunc,
 			KerberosClient:               options.KerberosClient,
 			KerberosServicePrincipleName: options.KerberosServicePrincipleName,
+			RPCProtection:                rpcProtection,
+			Events:                       rpcEvents(options.Observer),
 		},
 	)
 
@@ -205,7 +406,45 @@ func NewClient(options ClientOptions) (*Client, error) {
 		return nil, err
 	}
 
-	return &Client{namenode: namenode, options: options}, nil
+	client := &Client{
+		namenode:           namenode,
+		options:            options,
+		cache:              &serverCache{},
+		dataTransferCipher: &atomic.Value{},
+	}
+
+	if options.HedgedReadPoolSize > 0 {
+		client.hedgedReads = transfer.NewHedgedReadPool(
+			options.HedgedReadPoolSize, options.HedgedReadThreshold)
+	}
+
+	if options.DatanodeConnCacheSize >= 0 {
+		client.connCache = transfer.NewConnCache(
+			options.DatanodeConnCacheSize, options.DatanodeConnCacheExpiry)
+	}
+
+	if options.ShortCircuitReads && options.DomainSocketPath != "" {
+		client.shortCircuit = transfer.NewShortCircuitReads(options.DomainSocketPath)
+	}
+
+	if options.TopologyResolver != nil {
+		client.topology = newTopology(options.TopologyResolver)
+	}
+
+	if options.ReadBytesPerSecond > 0 {
+		client.readThrottler = transfer.NewThrottler(options.ReadBytesPerSecond)
+	}
+
+	if options.WriteBytesPerSecond > 0 {
+		client.writeThrottler = transfer.NewThrottler(options.WriteBytesPerSecond)
+	}
+
+	client.deadNodes = transfer.NewDeadNodeDetector(options.DeadNodeExpiry, nil, options.DeadNodeProbeInterval)
+	if options.DeadNodeProbeInterval >= 0 && options.KerberosClient == nil {
+		client.deadNodes.Probe = client.probeDatanode
+	}
+
+	return client, nil
 }
 
 // New returns Client connected to the namenode(s) specified by address, or an
@@ -241,11 +480,19 @@ func New(address string) (*Client, error) {
 }
 
 // User returns the user that the Client is acting under. This is either the
-// current system user or the kerberos principal.
+// current system user or the kerberos principal, or ClientOptions.ProxyUser if
+// it was set.
 func (c *Client) User() string {
 	return c.namenode.User
 }
 
+// RPCProtection returns the level of protection negotiated with the namenode:
+// "authentication", "integrity", or "privacy". It returns an empty string if
+// the Client doesn't use kerberos.
+func (c *Client) RPCProtection() string {
+	return c.namenode.RPCProtection()
+}
+
 // Name returns the unique name that the Client uses in communication
 // with namenodes and datanodes.
 func (c *Client) Name() string {
@@ -268,18 +515,81 @@ func (c *Client) ReadFile(filename string) ([]byte, error) {
 	return ioutil.ReadAll(f)
 }
 
+// CopyOptions specifies optional behavior for CopyToLocal and CopyToRemote.
+type CopyOptions struct {
+	// Resume specifies that a partial copy left behind by an earlier, failed
+	// attempt should be continued rather than started over. For CopyToLocal,
+	// the download picks up at the end of the existing local file. For
+	// CopyToRemote, the existing remote file is appended to, provided that its
+	// checksum matches the same prefix of the local file; otherwise, it is
+	// replaced.
+	Resume bool
+	// Parallelism is the number of blocks CopyToLocal fetches at once, using
+	// FileReader.ParallelCopy, or the number of parts CopyToRemote writes at
+	// once, using ParallelUpload. If it's zero or one, the blocks are
+	// transferred one after another. CopyToRemote doesn't write in parallel
+	// when it's resuming a partial copy.
+	Parallelism int
+	// MemoryBudget limits the memory used to buffer blocks, when Parallelism
+	// is greater than one. If it's zero, DefaultParallelCopyMemory is used.
+	MemoryBudget int64
+}
+
 // CopyToLocal copies the HDFS file specified by src to the local file at dst.
-// If dst already exists, it will be overwritten.
-func (c *Client) CopyToLocal(src string, dst string) error {
-	local, err := os.Create(dst)
+// If dst already exists, it will be overwritten, unless opts specifies that
+// the copy should be resumed.
+func (c *Client) CopyToLocal(src string, dst string, opts ...CopyOptions) error {
+	var o CopyOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	remote, err := c.Open(src)
 	if err != nil {
 		return err
 	}
 
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if o.Resume {
+		// A local file larger than the remote one can't be a prefix of it, so
+		// in that case we start over.
+		info, err := os.Stat(dst)
+		if err == nil && info.Size() <= remote.Stat().Size() {
+			_, err = remote.Seek(info.Size(), io.SeekStart)
+			if err != nil {
+				remote.Close()
+				return err
+			}
+
+			flag = os.O_WRONLY
+		}
+	}
+
+	local, err := os.OpenFile(dst, flag, 0666)
+	if err != nil {
+		remote.Close()
+		return err
+	}
+
 	defer local.Close()
 
-	remote, err := c.Open(src)
+	if o.Parallelism > 1 {
+		start, _ := remote.Seek(0, io.SeekCurrent)
+		n, err := remote.ParallelCopy(local, o.Parallelism, o.MemoryBudget)
+		if err != nil {
+			// Blocks past the first gap may have been written, so trim them off
+			// to leave something that can be resumed.
+			local.Truncate(start + n)
+			remote.Close()
+			return err
+		}
+
+		return remote.Close()
+	}
+
+	_, err = local.Seek(0, io.SeekEnd)
 	if err != nil {
+		remote.Close()
 		return err
 	}
 
@@ -293,16 +603,42 @@ func (c *Client) CopyToLocal(src string, dst string) error {
 }
 
 // CopyToRemote copies the local file specified by src to the HDFS file at dst.
-func (c *Client) CopyToRemote(src string, dst string) error {
+// If dst already exists, an error is returned, unless opts specifies that the
+// copy should be resumed.
+func (c *Client) CopyToRemote(src string, dst string, opts ...CopyOptions) error {
 	local, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer local.Close()
 
-	remote, err := c.Create(dst)
-	if err != nil {
-		return err
+	var o CopyOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+
+	var remote *FileWriter
+	if o.Resume {
+		remote, err = c.resumeCopyToRemote(local, dst)
+		if err != nil {
+			return err
+		}
+	}
+
+	if remote == nil && o.Parallelism > 1 {
+		info, err := local.Stat()
+		if err != nil {
+			return err
+		}
+
+		return c.ParallelUpload(local, info.Size(), dst, o.Parallelism)
+	}
+
+	if remote == nil {
+		remote, err = c.Create(dst)
+		if err != nil {
+			return err
+		}
 	}
 
 	_, err = io.Copy(remote, local)
@@ -314,21 +650,133 @@ func (c *Client) CopyToRemote(src string, dst string) error {
 	return remote.Close()
 }
 
+// resumeCopyToRemote opens dst for appending if it contains a prefix of the
+// local file, and seeks the local file past that prefix. If dst doesn't
+// exist, or has to be replaced, it returns a nil FileWriter.
+func (c *Client) resumeCopyToRemote(local *os.File, dst string) (*FileWriter, error) {
+	info, err := c.Stat(dst)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, &os.PathError{"create", dst, os.ErrExist}
+	}
+
+	// The earlier attempt probably didn't close the file, in which case it's
+	// still leased to that writer.
+	err = c.recoverLease(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := c.matchPrefix(local, dst)
+	if err != nil {
+		return nil, err
+	} else if size < 0 {
+		return nil, c.Remove(dst)
+	}
+
+	_, err = local.Seek(size, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Append(dst)
+}
+
+// matchPrefix compares the checksum of the remote file with the checksum of
+// the same number of bytes at the start of the local file. It returns the
+// length of the prefix if they match, or -1 if they don't.
+func (c *Client) matchPrefix(local *os.File, dst string) (int64, error) {
+	remote, err := c.Open(dst)
+	if err != nil {
+		return 0, err
+	}
+	defer remote.Close()
+
+	localInfo, err := local.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := remote.Stat().Size()
+	if localInfo.Size() < size {
+		return -1, nil
+	}
+
+	expected, err := remote.Checksum()
+	if err != nil {
+		return 0, err
+	}
+
+	actual, err := remote.ComputeChecksum(io.NewSectionReader(local, 0, size))
+	if err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(expected, actual) {
+		return -1, nil
+	}
+
+	return size, nil
+}
+
 func (c *Client) fetchDataEncryptionKey() (*hdfs.DataEncryptionKeyProto, error) {
-	if c.encryptionKey != nil {
-		return c.encryptionKey, nil
+	c.cache.lock.Lock()
+	defer c.cache.lock.Unlock()
+
+	// Like the Java client, fetch a new key once the old one has expired.
+	if c.cache.encryptionKey != nil {
+		expiry := time.UnixMilli(int64(c.cache.encryptionKey.GetExpiryDate()))
+		if c.cache.encryptionKey.GetExpiryDate() == 0 || time.Now().Before(expiry) {
+			return c.cache.encryptionKey, nil
+		}
 	}
 
 	req := &hdfs.GetDataEncryptionKeyRequestProto{}
 	resp := &hdfs.GetDataEncryptionKeyResponseProto{}
 
-	err := c.namenode.Execute("getDataEncryptionKey", req, resp)
+	err := c.execute("getDataEncryptionKey", req, resp)
 	if err != nil {
 		return nil, err
 	}
 
-	c.encryptionKey = resp.GetDataEncryptionKey()
-	return c.encryptionKey, nil
+	c.cache.encryptionKey = resp.GetDataEncryptionKey()
+	return c.cache.encryptionKey, nil
+}
+
+// clearDataEncryptionKey forgets the cached data encryption key, after a
+// datanode rejects it, so that a new one is fetched for the next connection.
+func (c *Client) clearDataEncryptionKey() {
+	c.cache.lock.Lock()
+	defer c.cache.lock.Unlock()
+
+	c.cache.encryptionKey = nil
+}
+
+// newDatanodeConnection connects to the IPC port of a datanode.
+func (c *Client) newDatanodeConnection(id *hdfs.DatanodeIDProto) (*rpc.DatanodeConnection, error) {
+	host := id.GetIpAddr()
+	if c.options.UseDatanodeHostname {
+		host = id.GetHostName()
+	}
+
+	dialFunc := c.options.DatanodeDialFunc
+	if dialFunc == nil {
+		dialFunc = (&net.Dialer{}).DialContext
+	}
+
+	return rpc.NewDatanodeConnection(rpc.DatanodeConnectionOptions{
+		Address:  net.JoinHostPort(host, strconv.Itoa(int(id.GetIpcPort()))),
+		User:     c.namenode.User,
+		RealUser: c.namenode.RealUser,
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, datanodeIPCTimeout)
+			defer cancel()
+			return dialFunc(ctx, network, addr)
+		},
+	})
 }
 
 func (c *Client) wrapDatanodeDial(dc dialContext, token *hadoop.TokenProto) (dialContext, error) {
@@ -350,19 +798,43 @@ func (c *Client) wrapDatanodeDial(dc dialContext, token *hadoop.TokenProto) (dia
 			return nil, err
 		}
 
-		return (&transfer.SaslDialer{
-			DialFunc:                  dc,
-			Key:                       key,
-			Token:                     token,
-			EnforceQop:                c.options.DataTransferProtection,
-			SkipSaslOnPrivilegedPorts: c.options.skipSaslForPrivilegedDatanodePorts,
-		}).DialContext, nil
+		return c.observeDatanodeDial(dc, func(dc dialContext) dialContext {
+			dialer := &transfer.SaslDialer{
+				DialFunc:                  dc,
+				Key:                       key,
+				Token:                     token,
+				EnforceQop:                c.options.DataTransferProtection,
+				SkipSaslOnPrivilegedPorts: c.options.skipSaslForPrivilegedDatanodePorts,
+			}
+
+			return func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := dialer.DialContext(ctx, network, addr)
+				if err == nil {
+					c.dataTransferCipher.Store(transfer.NegotiatedCipher(conn))
+				}
+
+				return conn, err
+			}
+		}), nil
 	}
 
-	return dc, nil
+	return c.observeDatanodeDial(dc, nil), nil
+}
+
+// DataTransferCipher returns the cipher used to encrypt the most recent
+// connection to a datanode: "AES/CTR/NoPadding" if AES was negotiated (which
+// requires dfs.encrypt.data.transfer.cipher.suites to be set on the
+// datanodes), or otherwise the DIGEST-MD5 cipher, like "rc4". It returns an
+// empty string if data transfer isn't encrypted, or if the Client hasn't
+// connected to any datanodes yet.
+func (c *Client) DataTransferCipher() string {
+	cipher, _ := c.dataTransferCipher.Load().(string)
+	return cipher
 }
 
 // Close terminates all underlying socket connections to remote server.
 func (c *Client) Close() error {
+	c.connCache.Close()
+	c.deadNodes.Close()
 	return c.namenode.Close()
 }
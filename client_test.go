@@ -196,3 +196,76 @@ func TestCopyToRemote(t *testing.T) {
 
 	assert.EqualValues(t, "bar\n", string(bytes))
 }
+
+func TestCopyToLocalResume(t *testing.T) {
+	client := getClient(t)
+
+	dir, _ := ioutil.TempDir("", "hdfs-test")
+	tmpfile := filepath.Join(dir, "foo.txt")
+	err := ioutil.WriteFile(tmpfile, []byte("ba"), 0644)
+	require.NoError(t, err)
+
+	err = client.CopyToLocal("/_test/foo.txt", tmpfile, CopyOptions{Resume: true})
+	require.NoError(t, err)
+
+	bytes, err := ioutil.ReadFile(tmpfile)
+	require.NoError(t, err)
+	assert.EqualValues(t, "bar\n", string(bytes))
+}
+
+func TestCopyToLocalParallel(t *testing.T) {
+	client := getClient(t)
+
+	expected, err := ioutil.ReadFile("testdata/mobydick.txt")
+	require.NoError(t, err)
+
+	dir, _ := ioutil.TempDir("", "hdfs-test")
+	tmpfile := filepath.Join(dir, "mobydick.txt")
+	err = ioutil.WriteFile(tmpfile, expected[:testStrOff], 0644)
+	require.NoError(t, err)
+
+	err = client.CopyToLocal("/_test/mobydick.txt", tmpfile, CopyOptions{Resume: true, Parallelism: 4})
+	require.NoError(t, err)
+
+	bytes, err := ioutil.ReadFile(tmpfile)
+	require.NoError(t, err)
+	assert.Equal(t, expected, bytes)
+}
+
+func TestCopyToRemoteResume(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/copytoremoteresume.txt")
+	writer, err := client.Create("/_test/copytoremoteresume.txt")
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("ba"))
+	require.NoError(t, err)
+	ignoreErrReplicating(t, writer.Close())
+
+	err = client.CopyToRemote("testdata/foo.txt", "/_test/copytoremoteresume.txt", CopyOptions{Resume: true})
+	ignoreErrReplicating(t, err)
+
+	bytes, err := client.ReadFile("/_test/copytoremoteresume.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, "bar\n", string(bytes))
+}
+
+func TestCopyToRemoteResumeMismatch(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/copytoremoteresume2.txt")
+	writer, err := client.Create("/_test/copytoremoteresume2.txt")
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("qux"))
+	require.NoError(t, err)
+	ignoreErrReplicating(t, writer.Close())
+
+	err = client.CopyToRemote("testdata/foo.txt", "/_test/copytoremoteresume2.txt", CopyOptions{Resume: true})
+	ignoreErrReplicating(t, err)
+
+	bytes, err := client.ReadFile("/_test/copytoremoteresume2.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, "bar\n", string(bytes))
+}
@@ -37,21 +37,30 @@ func cat(paths []string) {
 }
 
 func printSection(paths []string, numLines, numBytes int64, fromEnd bool) {
+	expanded, client, err := getClientAndExpandedPaths(paths)
+	if err != nil {
+		fatal(err)
+	}
+
+	printSections(client, expanded, numLines, numBytes, fromEnd, false)
+}
+
+// printSections prints the beginning or end of each file. If keepOpen is true,
+// it returns the open files, in the same order as paths, with nil for any that
+// couldn't be read. Otherwise, the files are closed, and it returns nil.
+func printSections(client *hdfs.Client, paths []string, numLines, numBytes int64, fromEnd, keepOpen bool) []*hdfs.FileReader {
 	if numLines != -1 && numBytes != -1 {
 		fatal("You can't specify both -n and -c.")
 	} else if numLines == -1 && numBytes == -1 {
 		numLines = 10
 	}
 
-	expanded, client, err := getClientAndExpandedPaths(paths)
-	if err != nil {
-		fatal(err)
-	}
-
-	for _, p := range expanded {
+	files := make([]*hdfs.FileReader, len(paths))
+	for i, p := range paths {
 		file, err := client.Open(p)
 		if err != nil || file.Stat().IsDir() {
 			if err == nil && file.Stat().IsDir() {
+				file.Close()
 				err = &os.PathError{"open", p, errors.New("file is a directory")}
 			}
 
@@ -60,7 +69,7 @@ func printSection(paths []string, numLines, numBytes int64, fromEnd bool) {
 			continue
 		}
 
-		if len(expanded) > 1 {
+		if len(paths) > 1 {
 			fmt.Fprintf(os.Stderr, "%s:\n", file.Name())
 		}
 
@@ -73,13 +82,32 @@ func printSection(paths []string, numLines, numBytes int64, fromEnd bool) {
 		} else {
 			var offset int64
 			if fromEnd {
-				offset = file.Stat().Size() - numBytes
+				// The file may still be being written to, in which case its visible
+				// length is larger than the one reported by Stat.
+				size, err := file.Seek(0, io.SeekEnd)
+				if err != nil {
+					fatal(err)
+				}
+
+				offset = size - numBytes
 			}
 
 			reader := io.NewSectionReader(file, offset, numBytes)
 			io.Copy(os.Stdout, reader)
 		}
+
+		if keepOpen {
+			files[i] = file
+		} else {
+			file.Close()
+		}
+	}
+
+	if !keepOpen {
+		return nil
 	}
+
+	return files
 }
 
 func headLines(file *hdfs.FileReader, numLines int64) {
@@ -115,8 +143,12 @@ func headLines(file *hdfs.FileReader, numLines int64) {
 }
 
 func tailLines(file *hdfs.FileReader, numLines int64) {
-	fileSize := file.Stat().Size()
-	searchPoint := file.Stat().Size() - tailSearchSize
+	fileSize, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		fatal(err)
+	}
+
+	searchPoint := fileSize - tailSearchSize
 	if searchPoint < 0 {
 		searchPoint = 0
 	}
@@ -155,7 +187,7 @@ func tailLines(file *hdfs.FileReader, numLines int64) {
 		searchPoint -= tailSearchSize
 	}
 
-	_, err := file.Seek(printOffset, 0)
+	_, err = file.Seek(printOffset, 0)
 	if err != nil {
 		fatal(err)
 	}
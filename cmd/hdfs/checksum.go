@@ -22,6 +22,10 @@ func checksum(paths []string) {
 			fatal(err)
 		}
 
-		fmt.Println(hex.EncodeToString(checksum), p)
+		if jsonOutput {
+			printJSON(jsonChecksum{Path: p, Checksum: hex.EncodeToString(checksum)})
+		} else {
+			fmt.Println(hex.EncodeToString(checksum), p)
+		}
 	}
 }
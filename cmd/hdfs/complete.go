@@ -25,6 +25,9 @@ var knownCommands = []string{
 	"getmerge",
 	"put",
 	"df",
+	"find",
+	"stat",
+	"count",
 }
 
 func complete(args []string) {
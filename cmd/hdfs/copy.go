@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+// copyingSuffix is appended to the destination while a file is being copied,
+// like 'hadoop fs -put' does. The file is renamed into place once it's done.
+const copyingSuffix = "._COPYING_"
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// bandwidth is the limit set by --bandwidth for put and get, in bytes per
+// second. It applies to all the files being copied at once.
+var bandwidth int64
+
+// setBandwidth parses the value of --bandwidth, if it was given.
+func setBandwidth(s string) {
+	if s == "" {
+		return
+	}
+
+	n, err := parseBytes(s)
+	if err != nil {
+		fatalWithUsage(err)
+	}
+
+	bandwidth = n
+}
+
+// copyOptions holds the flags shared by put and get.
+type copyOptions struct {
+	// parallelism is the number of files to copy concurrently.
+	parallelism int
+	// overwrite specifies whether existing files are replaced. If false, an
+	// existing file causes an error, unless the copyJob says to skip it.
+	overwrite bool
+	// preserve specifies whether timestamps and permissions are copied along
+	// with the data.
+	preserve bool
+	// verify specifies whether to compare the HDFS checksum of each file with
+	// the local copy, once it's been transferred.
+	verify bool
+	// resume specifies whether to continue from a partial copy left behind by
+	// an earlier attempt.
+	resume bool
+	// blockParallelism is the number of blocks of each file to transfer
+	// concurrently.
+	blockParallelism int
+}
+
+// copyJob represents a single file or directory to be copied.
+type copyJob struct {
+	source string
+	dest   string
+	info   os.FileInfo
+	// skipExisting is set for files in a directory being copied, so that if
+	// the destination exists, the file is skipped with a notice, rather than
+	// causing an error. That way, a partly copied tree can be finished by
+	// running the same command again.
+	skipExisting bool
+}
+
+// existingFileError is returned for a destination that already exists, or nil
+// if the file should be skipped instead. In that case, a notice is printed.
+func existingFileError(op string, job copyJob) error {
+	if !job.skipExisting {
+		return &os.PathError{op, job.dest, os.ErrExist}
+	}
+
+	fmt.Fprintf(os.Stderr, "%s: file already exists; skipping\n", job.dest)
+	return nil
+}
+
+// runCopyJobs calls copyFn for each job, with at most parallelism calls in
+// flight at once. Errors are printed as they occur, and cause the command to
+// exit with a non-zero status.
+func runCopyJobs(jobs []copyJob, parallelism int, copyFn func(copyJob) error) {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	queue := make(chan copyJob)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				err := copyFn(job)
+				if err != nil {
+					errLock.Lock()
+					printError(err)
+					status = 1
+					errLock.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+
+	close(queue)
+	wg.Wait()
+}
+
+// verifyChecksum checks that the local file has the same contents as the
+// remote one, by comparing the HDFS checksum of the remote file with one
+// computed locally.
+func verifyChecksum(client *hdfs.Client, remotePath, localPath string) error {
+	remote, err := client.Open(remotePath)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	local, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	localInfo, err := local.Stat()
+	if err != nil {
+		return err
+	} else if localInfo.Size() != remote.Stat().Size() {
+		return &os.PathError{"checksum", remotePath, errChecksumMismatch}
+	}
+
+	expected, err := remote.Checksum()
+	if err != nil {
+		return err
+	}
+
+	actual, err := remote.ComputeChecksum(local)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(expected, actual) {
+		return &os.PathError{"checksum", remotePath, errChecksumMismatch}
+	}
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// count prints the number of directories, files, and bytes under each path,
+// in the same format as 'hadoop fs -count'.
+func count(args []string, quotas, humanReadable bool) {
+	if len(args) == 0 {
+		fatalWithUsage()
+	}
+
+	expanded, client, err := getClientAndExpandedPaths(args)
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, p := range expanded {
+		cs, err := client.GetContentSummary(p)
+		if err != nil {
+			printError(err)
+			status = 1
+			continue
+		}
+
+		if jsonOutput {
+			printJSON(newJSONContentSummary(p, cs))
+			continue
+		}
+
+		if quotas {
+			fmt.Printf("%12s %15s %15s %15s ",
+				formatQuota(int64(cs.NameQuota()), false),
+				formatRemainingQuota(int64(cs.NameQuota()), int64(cs.DirectoryCount()+cs.FileCount()), false),
+				formatQuota(cs.SpaceQuota(), humanReadable),
+				formatRemainingQuota(cs.SpaceQuota(), cs.SizeAfterReplication(), humanReadable))
+		}
+
+		fmt.Printf("%12d %12d %18s %s\n",
+			cs.DirectoryCount(), cs.FileCount(), formatCount(cs.Size(), humanReadable), p)
+	}
+}
+
+func formatCount(n int64, humanReadable bool) string {
+	if humanReadable {
+		return formatBytes(uint64(n))
+	}
+
+	return strconv.FormatInt(n, 10)
+}
+
+// formatQuota formats a name or space quota. Unset quotas are negative.
+func formatQuota(quota int64, humanReadable bool) string {
+	if quota < 0 {
+		return "none"
+	}
+
+	return formatCount(quota, humanReadable)
+}
+
+func formatRemainingQuota(quota, used int64, humanReadable bool) string {
+	if quota < 0 {
+		return "inf"
+	}
+
+	return formatCount(quota-used, humanReadable)
+}
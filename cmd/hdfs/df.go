@@ -21,6 +21,22 @@ func df(humanReadable bool) {
 		fatal(err)
 	}
 
+	if jsonOutput {
+		printJSON(jsonFsInfo{
+			Filesystem:            os.Getenv("HADOOP_NAMENODE"),
+			Capacity:              fs.Capacity,
+			Used:                  fs.Used,
+			Remaining:             fs.Remaining,
+			UnderReplicated:       fs.UnderReplicated,
+			CorruptBlocks:         fs.CorruptBlocks,
+			MissingBlocks:         fs.MissingBlocks,
+			MissingReplOneBlocks:  fs.MissingReplOneBlocks,
+			BlocksInFuture:        fs.BlocksInFuture,
+			PendingDeletionBlocks: fs.PendingDeletionBlocks,
+		})
+		return
+	}
+
 	tw := tabwriter.NewWriter(os.Stdout, 3, 8, 0, ' ', tabwriter.AlignRight)
 	fmt.Fprintf(tw, "Filesystem \tSize \tUsed \tAvailable \t Use%%\n")
 	if humanReadable {
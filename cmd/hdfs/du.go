@@ -26,7 +26,7 @@ func du(args []string, summarize, humanReadable bool) {
 	for _, p := range expanded {
 		info, err := client.Stat(p)
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			printError(err)
 			status = 1
 			continue
 		}
@@ -36,7 +36,7 @@ func du(args []string, summarize, humanReadable bool) {
 			if summarize {
 				cs, err := client.GetContentSummary(p)
 				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
+					printError(err)
 					status = 1
 					continue
 				}
@@ -56,7 +56,7 @@ func du(args []string, summarize, humanReadable bool) {
 func duDir(client *hdfs.Client, tw *tabwriter.Writer, dir string, humanReadable bool) int64 {
 	dirReader, err := client.Open(dir)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
+		printError(err)
 		return 0
 	}
 
@@ -64,7 +64,7 @@ func duDir(client *hdfs.Client, tw *tabwriter.Writer, dir string, humanReadable
 	var dirSize int64
 	for ; err != io.EOF; partial, err = dirReader.Readdir(100) {
 		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+			printError(err)
 			return dirSize
 		}
 
@@ -72,7 +72,7 @@ func duDir(client *hdfs.Client, tw *tabwriter.Writer, dir string, humanReadable
 			childPath := path.Join(dir, child.Name())
 			info, err := client.Stat(childPath)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, err)
+				printError(err)
 				return 0
 			}
 
@@ -92,7 +92,9 @@ func duDir(client *hdfs.Client, tw *tabwriter.Writer, dir string, humanReadable
 }
 
 func printSize(tw *tabwriter.Writer, size int64, name string, humanReadable bool) {
-	if humanReadable {
+	if jsonOutput {
+		printJSON(jsonSize{Path: name, Size: size})
+	} else if humanReadable {
 		formattedSize := formatBytes(uint64(size))
 		fmt.Fprintf(tw, "%s \t%s\n", formattedSize, name)
 	} else {
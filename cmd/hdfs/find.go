@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2/find"
+)
+
+type findAction int
+
+const (
+	findPrint findAction = iota
+	findPrint0
+	findLs
+	findDelete
+)
+
+// findTests lists the tests which take an argument.
+var findTests = map[string]bool{
+	"-name":  true,
+	"-iname": true,
+	"-type":  true,
+	"-size":  true,
+	"-mtime": true,
+	"-user":  true,
+	"-group": true,
+	"-perm":  true,
+}
+
+func findPaths(args []string) {
+	var paths []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") && args[0] != "!" {
+		paths = append(paths, args[0])
+		args = args[1:]
+	}
+
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	match, actions, err := parseFindExpression(args, time.Now())
+	if err != nil {
+		fatalWithUsage(err)
+	}
+
+	expanded, client, err := getClientAndExpandedPaths(paths)
+	if err != nil {
+		fatal(err)
+	}
+
+	var tw *tabwriter.Writer
+	var toDelete []string
+	for _, action := range actions {
+		if action == findLs {
+			tw = lsTabWriter()
+		}
+	}
+
+	for _, root := range expanded {
+		err = client.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				status = 1
+				return nil
+			}
+
+			if !match(p, info) {
+				return nil
+			}
+
+			for _, action := range actions {
+				switch action {
+				case findPrint:
+					fmt.Println(p)
+				case findPrint0:
+					fmt.Print(p, "\x00")
+				case findLs:
+					printLong(tw, p, info, false)
+				case findDelete:
+					toDelete = append(toDelete, p)
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+
+	if tw != nil {
+		tw.Flush()
+	}
+
+	// Walk visits parents before their children, so deleting in reverse order
+	// empties directories before we try to remove them.
+	for i := len(toDelete) - 1; i >= 0; i-- {
+		err := client.Remove(toDelete[i])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+}
+
+// parseFindExpression parses the tests and actions following the paths in a
+// find command. All tests must match for an entry to be selected; a test may
+// be negated by preceding it with '!' or -not. If no actions are specified,
+// -print is implied.
+func parseFindExpression(args []string, now time.Time) (find.Predicate, []findAction, error) {
+	var preds []find.Predicate
+	var actions []findAction
+	negate := false
+
+	for len(args) > 0 {
+		arg := args[0]
+		args = args[1:]
+
+		switch arg {
+		case "!", "-not":
+			negate = !negate
+			continue
+		case "-print":
+			actions = append(actions, findPrint)
+			continue
+		case "-print0":
+			actions = append(actions, findPrint0)
+			continue
+		case "-ls":
+			actions = append(actions, findLs)
+			continue
+		case "-delete":
+			actions = append(actions, findDelete)
+			continue
+		}
+
+		if !findTests[arg] {
+			return nil, nil, fmt.Errorf("unknown predicate: %s", arg)
+		} else if len(args) == 0 {
+			return nil, nil, fmt.Errorf("missing argument to %s", arg)
+		}
+
+		val := args[0]
+		args = args[1:]
+
+		var pred find.Predicate
+		var err error
+		switch arg {
+		case "-name":
+			pred, err = find.Name(val)
+		case "-iname":
+			pred, err = find.IName(val)
+		case "-type":
+			if len(val) != 1 {
+				return nil, nil, fmt.Errorf("unknown file type: %s", val)
+			}
+
+			pred, err = find.Type(val[0])
+		case "-size":
+			pred, err = find.Size(val)
+		case "-mtime":
+			pred, err = find.Mtime(val, now)
+		case "-user":
+			pred = find.User(val)
+		case "-group":
+			pred = find.Group(val)
+		case "-perm":
+			pred, err = find.Perm(val)
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if negate {
+			pred = find.Not(pred)
+			negate = false
+		}
+
+		preds = append(preds, pred)
+	}
+
+	if negate {
+		return nil, nil, fmt.Errorf("expected a test after negation")
+	}
+
+	if len(actions) == 0 {
+		actions = []findAction{findPrint}
+	}
+
+	return find.All(preds...), actions, nil
+}
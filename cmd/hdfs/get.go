@@ -7,9 +7,11 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/colinmarc/hdfs/v2"
 )
 
-func get(args []string) {
+func get(args []string, opts copyOptions) {
 	if len(args) == 0 || len(args) > 2 {
 		fatalWithUsage()
 	}
@@ -38,6 +40,9 @@ func get(args []string) {
 		fatal(err)
 	}
 
+	// Create the directory tree first, and then copy the files in parallel.
+	var dirs, files []copyJob
+	recursive := false
 	err = client.Walk(source, func(p string, fi os.FileInfo, err error) error {
 		fullDest := filepath.Join(dest, strings.TrimPrefix(p, source))
 
@@ -45,25 +50,93 @@ func get(args []string) {
 			fatal(err)
 		}
 
+		if p == source && fi.IsDir() {
+			recursive = true
+		}
+
+		job := copyJob{source: p, dest: fullDest, info: fi, skipExisting: recursive}
 		if fi.IsDir() {
-			err = os.Mkdir(fullDest, 0755)
+			err = os.MkdirAll(fullDest, 0755)
 			if err != nil {
 				fatal(err)
 			}
+
+			dirs = append(dirs, job)
 		} else {
-			err = client.CopyToLocal(p, fullDest)
-			if pathErr, ok := err.(*os.PathError); ok {
-				fatal(pathErr)
-			} else if err != nil {
-				fatal(err)
-			}
+			files = append(files, job)
 		}
+
 		return nil
 	})
 
 	if err != nil {
 		fatal(err)
 	}
+
+	runCopyJobs(files, opts.parallelism, func(job copyJob) error {
+		return getFile(client, job, opts)
+	})
+
+	if opts.preserve {
+		for i := len(dirs) - 1; i >= 0; i-- {
+			err := preserveLocal(dirs[i].dest, dirs[i].info)
+			if err != nil {
+				printError(err)
+				status = 1
+			}
+		}
+	}
+}
+
+// getFile downloads a single file. Like putFile, the data is written to a
+// temporary file which is renamed into place once it's complete.
+func getFile(client *hdfs.Client, job copyJob, opts copyOptions) error {
+	_, err := os.Stat(job.dest)
+	if err == nil && !opts.overwrite {
+		return existingFileError("get", job)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// As with put, a partial download is left behind if the copy fails.
+	tmp := job.dest + copyingSuffix
+	err = client.CopyToLocal(job.source, tmp, hdfs.CopyOptions{
+		Resume:      opts.resume,
+		Parallelism: opts.blockParallelism,
+	})
+	if err != nil {
+		return err
+	}
+
+	if opts.verify {
+		err = verifyChecksum(client, job.source, tmp)
+		if err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+
+	err = os.Rename(tmp, job.dest)
+	if err != nil {
+		return err
+	}
+
+	if opts.preserve {
+		return preserveLocal(job.dest, job.info)
+	}
+
+	return nil
+}
+
+// preserveLocal copies the permissions, and access and modification times of
+// a remote file to the local one.
+func preserveLocal(dest string, info os.FileInfo) error {
+	err := os.Chmod(dest, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return os.Chtimes(dest, info.(*hdfs.FileInfo).AccessTime(), info.ModTime())
 }
 
 func getmerge(args []string, addNewlines bool) {
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+// jsonOutput is set by the global --json (or -o json) flag. In that mode,
+// commands print one JSON object per line for each entry, instead of the
+// usual human-readable output, and errors are printed to stderr as JSON
+// objects.
+var jsonOutput bool
+
+// jsonFileInfo is the JSON representation of an hdfs.FileInfo. Times are in
+// milliseconds since the epoch, as they are stored by the namenode.
+type jsonFileInfo struct {
+	Path             string `json:"path"`
+	Name             string `json:"name"`
+	Type             string `json:"type"`
+	Size             int64  `json:"size"`
+	Permission       string `json:"permission"`
+	Owner            string `json:"owner"`
+	Group            string `json:"group"`
+	Replication      int32  `json:"replication"`
+	BlockSize        int64  `json:"block_size"`
+	ModificationTime uint64 `json:"modification_time"`
+	AccessTime       uint64 `json:"access_time"`
+}
+
+type jsonContentSummary struct {
+	Path                 string `json:"path"`
+	DirectoryCount       int    `json:"directory_count"`
+	FileCount            int    `json:"file_count"`
+	Size                 int64  `json:"size"`
+	SizeAfterReplication int64  `json:"size_after_replication"`
+	NameQuota            int    `json:"name_quota"`
+	SpaceQuota           int64  `json:"space_quota"`
+}
+
+type jsonFsInfo struct {
+	Filesystem            string `json:"filesystem"`
+	Capacity              uint64 `json:"capacity"`
+	Used                  uint64 `json:"used"`
+	Remaining             uint64 `json:"remaining"`
+	UnderReplicated       uint64 `json:"under_replicated"`
+	CorruptBlocks         uint64 `json:"corrupt_blocks"`
+	MissingBlocks         uint64 `json:"missing_blocks"`
+	MissingReplOneBlocks  uint64 `json:"missing_repl_one_blocks"`
+	BlocksInFuture        uint64 `json:"blocks_in_future"`
+	PendingDeletionBlocks uint64 `json:"pending_deletion_blocks"`
+}
+
+type jsonSize struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type jsonChecksum struct {
+	Path     string `json:"path"`
+	Checksum string `json:"checksum"`
+}
+
+type jsonTestResult struct {
+	Path   string `json:"path"`
+	Test   string `json:"test"`
+	Result bool   `json:"result"`
+}
+
+type jsonError struct {
+	Error string `json:"error"`
+	Op    string `json:"op,omitempty"`
+	Path  string `json:"path,omitempty"`
+}
+
+func newJSONFileInfo(p string, fi *hdfs.FileInfo) jsonFileInfo {
+	status := fi.Sys().(*hdfs.FileStatus)
+	return jsonFileInfo{
+		Path:             p,
+		Name:             fi.Name(),
+		Type:             fileType(fi),
+		Size:             fi.Size(),
+		Permission:       strconv.FormatUint(uint64(fi.Mode())&07777, 8),
+		Owner:            fi.Owner(),
+		Group:            fi.OwnerGroup(),
+		Replication:      fi.GetReplication(),
+		BlockSize:        fi.BlockSize(),
+		ModificationTime: status.GetModificationTime(),
+		AccessTime:       status.GetAccessTime(),
+	}
+}
+
+func newJSONContentSummary(p string, cs *hdfs.ContentSummary) jsonContentSummary {
+	return jsonContentSummary{
+		Path:                 p,
+		DirectoryCount:       cs.DirectoryCount(),
+		FileCount:            cs.FileCount(),
+		Size:                 cs.Size(),
+		SizeAfterReplication: cs.SizeAfterReplication(),
+		NameQuota:            cs.NameQuota(),
+		SpaceQuota:           cs.SpaceQuota(),
+	}
+}
+
+func printJSON(v interface{}) {
+	writeJSON(os.Stdout, v)
+}
+
+func writeJSON(w io.Writer, v interface{}) {
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// printError prints a non-fatal error to stderr, as a JSON object if
+// jsonOutput is set.
+func printError(err error) {
+	if jsonOutput {
+		writeJSON(os.Stderr, newJSONError(err))
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+func newJSONError(err error) jsonError {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return jsonError{
+			Error: pathErr.Err.Error(),
+			Op:    pathErr.Op,
+			Path:  pathErr.Path,
+		}
+	}
+
+	return jsonError{Error: err.Error()}
+}
@@ -6,11 +6,15 @@ import (
 	"os/user"
 	"strings"
 
+	"github.com/colinmarc/hdfs/v2"
 	krb "github.com/jcmturner/gokrb5/v8/client"
 	"github.com/jcmturner/gokrb5/v8/config"
 	"github.com/jcmturner/gokrb5/v8/credentials"
 )
 
+// keytabPath and principal are set by the --keytab and --principal flags.
+var keytabPath, principal string
+
 // TODO: Write a kerberos_windows.go and move this to kerberos_unix.go. This
 // assumes MIT kerberos on unix.
 
@@ -25,6 +29,10 @@ func getKerberosClient() (*krb.Client, error) {
 		return nil, err
 	}
 
+	if keytabPath != "" || principal != "" {
+		return hdfs.NewKerberosClientWithKeytab(principal, keytabPath, cfg)
+	}
+
 	// Determine the ccache location from the environment, falling back to the
 	// default location.
 	ccachePath := os.Getenv("KRB5CCNAME")
@@ -45,6 +53,12 @@ func getKerberosClient() (*krb.Client, error) {
 
 	ccache, err := credentials.LoadCCache(ccachePath)
 	if err != nil {
+		// Like MIT kerberos, fall back to the client keytab if there's no
+		// ccache.
+		if os.Getenv("KRB5_CLIENT_KTNAME") != "" {
+			return hdfs.NewKerberosClientWithKeytab("", "", cfg)
+		}
+
 		return nil, err
 	}
 
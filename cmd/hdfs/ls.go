@@ -26,6 +26,11 @@ func ls(paths []string, long, all, humanReadable, recursive bool) {
 		paths = []string{userDir(client)}
 	}
 
+	if jsonOutput {
+		lsJSON(client, paths, all, recursive)
+		return
+	}
+
 	files := make([]string, 0, len(paths))
 	fileInfos := make([]os.FileInfo, 0, len(paths))
 
@@ -101,6 +106,47 @@ func ls(paths []string, long, all, humanReadable, recursive bool) {
 	}
 }
 
+// lsJSON prints a JSON object for each file, or for each entry in each
+// directory, in paths.
+func lsJSON(client *hdfs.Client, paths []string, all, recursive bool) {
+	for _, p := range paths {
+		fi, err := client.Stat(p)
+		if err != nil {
+			fatal(err)
+		}
+
+		if !fi.IsDir() {
+			printJSON(newJSONFileInfo(p, fi.(*hdfs.FileInfo)))
+			continue
+		}
+
+		if recursive {
+			err = client.Walk(p, func(child string, info os.FileInfo, err error) error {
+				if err != nil {
+					printError(err)
+					status = 1
+				} else if child != p && (all || !strings.HasPrefix(info.Name(), ".")) {
+					printJSON(newJSONFileInfo(child, info.(*hdfs.FileInfo)))
+				}
+
+				return nil
+			})
+		} else {
+			var children []os.FileInfo
+			children, err = client.ReadDir(p)
+			for _, info := range children {
+				if all || !strings.HasPrefix(info.Name(), ".") {
+					printJSON(newJSONFileInfo(path.Join(p, info.Name()), info.(*hdfs.FileInfo)))
+				}
+			}
+		}
+
+		if err != nil {
+			fatal(err)
+		}
+	}
+}
+
 func printDir(client *hdfs.Client, dir string, long, all, humanReadable bool) {
 	dirReader, err := client.Open(dir)
 	if err != nil {
@@ -20,9 +20,19 @@ import (
 
 var (
 	version string
-	usage   = fmt.Sprintf(`Usage: %s COMMAND
+	usage   = fmt.Sprintf(`Usage: %s [--json | -o json|text] [--keytab PATH] [--principal NAME] COMMAND
 The flags available are a subset of the POSIX ones, but should behave similarly.
 
+With --json (or -o json), ls, du, df, stat, checksum, test and count print one
+JSON object per line for each entry, and errors are printed as JSON objects.
+
+With --keytab or --principal, kerberos authentication uses a keytab instead of
+the ccache. The keytab defaults to KRB5_CLIENT_KTNAME, and the principal to
+the first one in the keytab.
+
+For get and put, --bandwidth limits the total rate of transfer to or from the
+cluster, in bytes per second, with an optional K, M or G suffix (like 10M).
+
 Valid commands:
   ls [-lahR] [FILE]...
   rm [-rf] [--skipTrash] [--forceTrash] [--preserveDirTs] FILE...
@@ -33,16 +43,21 @@ Valid commands:
   chown [-R] OWNER[:GROUP] FILE...
   cat SOURCE...
   head [-n LINES | -c BYTES] SOURCE...
-  tail [-n LINES | -c BYTES] SOURCE...
+  tail [-n LINES | -c BYTES] [-f | -F] [-s SECONDS] SOURCE...
   test [-defsz] FILE...
   du [-sh] FILE...
   checksum FILE...
-  get SOURCE [DEST]
+  get [-fpc] [-j N] [-b N] [--resume] [--bandwidth RATE] SOURCE [DEST]
   getmerge SOURCE DEST
-  put SOURCE DEST
+  put [-fpc] [-j N] [-b N] [--resume] [--bandwidth RATE] SOURCE DEST
   df [-h]
   setrep REP FILE...
   truncate SIZE FILE
+  stat [-c FORMAT] FILE...
+  count [-qh] FILE...
+  find [PATH]... [-name GLOB] [-iname GLOB] [-type f|d|l] [-size [+-]N[ckMG]]
+       [-mtime [+-]N] [-user USER] [-group GROUP] [-perm [-/]MODE]
+       [-print | -print0 | -ls | -delete]
 `, os.Args[0])
 
 	lsOpts = getopt.New()
@@ -85,16 +100,48 @@ Valid commands:
 	headtailn    = headTailOpts.Int64('n', -1)
 	headtailc    = headTailOpts.Int64('c', -1)
 
+	tailOpts = getopt.New()
+	tailn    = tailOpts.Int64('n', -1)
+	tailc    = tailOpts.Int64('c', -1)
+	tailf    = tailOpts.Bool('f')
+	tailF    = tailOpts.Bool('F')
+	tails    = tailOpts.String('s', "1")
+
 	duOpts = getopt.New()
 	dus    = duOpts.Bool('s')
 	duh    = duOpts.Bool('h')
 
+	getOpts = getopt.New()
+	getj    = getOpts.Int('j', 1)
+	getf    = getOpts.Bool('f')
+	getp    = getOpts.Bool('p')
+	getc    = getOpts.Bool('c')
+	getr    = getOpts.BoolLong("resume", 0)
+	getb    = getOpts.Int('b', 4)
+	getbw   = getOpts.StringLong("bandwidth", 0, "")
+
+	putOpts = getopt.New()
+	putj    = putOpts.Int('j', 1)
+	putf    = putOpts.Bool('f')
+	putp    = putOpts.Bool('p')
+	putc    = putOpts.Bool('c')
+	putr    = putOpts.BoolLong("resume", 0)
+	putb    = putOpts.Int('b', 1)
+	putbw   = putOpts.StringLong("bandwidth", 0, "")
+
 	getmergeOpts = getopt.New()
 	getmergen    = getmergeOpts.Bool('n')
 
 	dfOpts = getopt.New()
 	dfh    = dfOpts.Bool('h')
 
+	statOpts = getopt.New()
+	statc    = statOpts.String('c', "%y")
+
+	countOpts = getopt.New()
+	countq    = countOpts.Bool('q')
+	counth    = countOpts.Bool('h')
+
 	cachedClients map[string]*hdfs.Client = make(map[string]*hdfs.Client)
 	status                                = 0
 )
@@ -107,19 +154,24 @@ func init() {
 	chmodOpts.SetUsage(func() { fatalWithUsage() })
 	chownOpts.SetUsage(func() { fatalWithUsage() })
 	headTailOpts.SetUsage(func() { fatalWithUsage() })
+	tailOpts.SetUsage(func() { fatalWithUsage() })
 	duOpts.SetUsage(func() { fatalWithUsage() })
+	getOpts.SetUsage(func() { fatalWithUsage() })
+	putOpts.SetUsage(func() { fatalWithUsage() })
 	getmergeOpts.SetUsage(func() { fatalWithUsage() })
 	dfOpts.SetUsage(func() { fatalWithUsage() })
 	testOpts.SetUsage(func() { fatalWithUsage() })
+	statOpts.SetUsage(func() { fatalWithUsage() })
+	countOpts.SetUsage(func() { fatalWithUsage() })
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	argv := parseGlobalFlags(os.Args[1:])
+	if len(argv) < 1 {
 		fatalWithUsage()
 	}
 
-	command := os.Args[1]
-	argv := os.Args[1:]
+	command := argv[0]
 	switch command {
 	case "-v", "--version":
 		fatal("gohdfs version", version)
@@ -146,21 +198,28 @@ func main() {
 		chmod(chmodOpts.Args(), *chmodR)
 	case "cat":
 		cat(argv[1:])
-	case "head", "tail":
+	case "head":
 		headTailOpts.Parse(argv)
-		printSection(headTailOpts.Args(), *headtailn, *headtailc, (command == "tail"))
+		printSection(headTailOpts.Args(), *headtailn, *headtailc, false)
+	case "tail":
+		tailOpts.Parse(argv)
+		tail(tailOpts.Args(), *tailn, *tailc, *tailf, *tailF, *tails)
 	case "du":
 		duOpts.Parse(argv)
 		du(duOpts.Args(), *dus, *duh)
 	case "checksum":
 		checksum(argv[1:])
 	case "get":
-		get(argv[1:])
+		getOpts.Parse(argv)
+		setBandwidth(*getbw)
+		get(getOpts.Args(), copyOptions{*getj, *getf, *getp, *getc, *getr, *getb})
 	case "getmerge":
 		getmergeOpts.Parse(argv)
 		getmerge(getmergeOpts.Args(), *getmergen)
 	case "put":
-		put(argv[1:])
+		putOpts.Parse(argv)
+		setBandwidth(*putbw)
+		put(putOpts.Args(), copyOptions{*putj, *putf, *putp, *putc, *putr, *putb})
 	case "df":
 		dfOpts.Parse(argv)
 		df(*dfh)
@@ -171,6 +230,14 @@ func main() {
 		setrep(argv[1:])
 	case "truncate":
 		truncate(argv[1:])
+	case "stat":
+		statOpts.Parse(argv)
+		stat(statOpts.Args(), *statc)
+	case "count":
+		countOpts.Parse(argv)
+		count(countOpts.Args(), *countq, *counth)
+	case "find":
+		findPaths(argv[1:])
 	// it's a seeeeecret command
 	case "complete":
 		complete(argv)
@@ -185,13 +252,76 @@ func main() {
 	os.Exit(status)
 }
 
+// parseGlobalFlags consumes any flags preceding the command, and returns the
+// remaining arguments.
+func parseGlobalFlags(args []string) []string {
+	for len(args) > 0 {
+		var format string
+		switch {
+		case (args[0] == "--keytab" || args[0] == "--principal") && len(args) > 1:
+			if args[0] == "--keytab" {
+				keytabPath = args[1]
+			} else {
+				principal = args[1]
+			}
+
+			args = args[2:]
+			continue
+		case strings.HasPrefix(args[0], "--keytab="):
+			keytabPath = strings.TrimPrefix(args[0], "--keytab=")
+			args = args[1:]
+			continue
+		case strings.HasPrefix(args[0], "--principal="):
+			principal = strings.TrimPrefix(args[0], "--principal=")
+			args = args[1:]
+			continue
+		case args[0] == "--json":
+			format = "json"
+		case args[0] == "-o" && len(args) > 1:
+			format = args[1]
+			args = args[1:]
+		case strings.HasPrefix(args[0], "-o") && len(args[0]) > 2:
+			format = args[0][2:]
+		default:
+			return args
+		}
+
+		switch format {
+		case "json":
+			jsonOutput = true
+		case "text":
+			jsonOutput = false
+		default:
+			fatalWithUsage("Unknown output format:", format)
+		}
+
+		args = args[1:]
+	}
+
+	return args
+}
+
 func printHelp() {
 	fmt.Fprintln(os.Stderr, usage)
 	os.Exit(0)
 }
 
 func fatal(msg ...interface{}) {
-	fmt.Fprintln(os.Stderr, msg...)
+	if jsonOutput {
+		var err error
+		if len(msg) == 1 {
+			err, _ = msg[0].(error)
+		}
+
+		if err != nil {
+			writeJSON(os.Stderr, newJSONError(err))
+		} else {
+			writeJSON(os.Stderr, jsonError{Error: strings.TrimSpace(fmt.Sprintln(msg...))})
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, msg...)
+	}
+
 	os.Exit(1)
 }
 
@@ -308,6 +438,9 @@ func getClient(namenode string) (*hdfs.Client, error) {
 		options.User = *u
 	}
 
+	// Like hadoop fs, act on behalf of HADOOP_PROXY_USER if it's set.
+	options.ProxyUser = os.Getenv("HADOOP_PROXY_USER")
+
 	// Set some basic defaults.
 	dialFunc := (&net.Dialer{
 		Timeout:   5 * time.Second,
@@ -317,6 +450,8 @@ func getClient(namenode string) (*hdfs.Client, error) {
 
 	options.NamenodeDialFunc = dialFunc
 	options.DatanodeDialFunc = dialFunc
+	options.ReadBytesPerSecond = bandwidth
+	options.WriteBytesPerSecond = bandwidth
 
 	c, err := hdfs.NewClient(options)
 	if err != nil {
@@ -339,6 +474,7 @@ func printMinimalConfig() {
 		"dfs.encrypt.data.transfer": {},
 		"dfs.namenode.kerberos.principal": {},
 		"dfs.nameservices": {},
+		"hadoop.rpc.protection": {},
 		"fs.default.name": {},
 		"fs.defaultFS": {},
 	}
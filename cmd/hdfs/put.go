@@ -9,7 +9,7 @@ import (
 	"github.com/colinmarc/hdfs/v2"
 )
 
-func put(args []string) {
+func put(args []string, opts copyOptions) {
 	if len(args) != 2 {
 		fatalWithUsage()
 	}
@@ -31,17 +31,25 @@ func put(args []string) {
 	}
 
 	if filepath.Base(source) == "-" {
-		putFromStdin(client, dest)
+		putFromStdin(client, dest, opts.overwrite)
 	} else {
-		putFromFile(client, source, dest)
+		putFromFile(client, source, dest, opts)
 	}
 }
 
-func putFromStdin(client *hdfs.Client, dest string) {
-	// If the destination exists, regardless of what it is, bail out.
-	_, err := client.Stat(dest)
+func putFromStdin(client *hdfs.Client, dest string, overwrite bool) {
+	// If the destination exists, bail out, unless it's a file we were asked to
+	// overwrite.
+	existing, err := client.Stat(dest)
 	if err == nil {
-		fatal(&os.PathError{"put", dest, os.ErrExist})
+		if !overwrite || existing.IsDir() {
+			fatal(&os.PathError{"put", dest, os.ErrExist})
+		}
+
+		err = client.Remove(dest)
+		if err != nil {
+			fatal(err)
+		}
 	} else if !os.IsNotExist(err) {
 		fatal(err)
 	}
@@ -74,7 +82,12 @@ func putFromStdin(client *hdfs.Client, dest string) {
 	}
 }
 
-func putFromFile(client *hdfs.Client, source string, dest string) {
+func putFromFile(client *hdfs.Client, source string, dest string, opts copyOptions) {
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		fatal(err)
+	}
+
 	// If the destination is an existing directory, place it inside. Otherwise,
 	// the destination is really the parent directory, and we need to rename the
 	// source directory as we copy.
@@ -82,13 +95,15 @@ func putFromFile(client *hdfs.Client, source string, dest string) {
 	if err == nil {
 		if existing.IsDir() {
 			dest = path.Join(dest, filepath.Base(source))
-		} else {
+		} else if sourceInfo.IsDir() {
 			fatal(&os.PathError{"mkdir", dest, os.ErrExist})
 		}
 	} else if !os.IsNotExist(err) {
 		fatal(err)
 	}
 
+	// Create the directory tree first, and then copy the files in parallel.
+	var dirs, files []copyJob
 	mode := 0755 | os.ModeDir
 	err = filepath.Walk(source, func(p string, fi os.FileInfo, err error) error {
 		if err != nil {
@@ -100,40 +115,100 @@ func putFromFile(client *hdfs.Client, source string, dest string) {
 			return err
 		}
 
-		fullDest := path.Join(dest, rel)
+		job := copyJob{
+			source:       p,
+			dest:         path.Join(dest, filepath.ToSlash(rel)),
+			info:         fi,
+			skipExisting: sourceInfo.IsDir(),
+		}
+
 		if fi.IsDir() {
-			client.Mkdir(fullDest, mode)
+			client.Mkdir(job.dest, mode)
+			dirs = append(dirs, job)
 		} else {
-			writer, err := client.Create(fullDest)
-			if err != nil {
-				return err
-			}
+			files = append(files, job)
+		}
 
-			reader, err := os.Open(p)
-			if err != nil {
-				return err
-			}
+		return nil
+	})
 
-			defer reader.Close()
-			_, err = io.Copy(writer, reader)
-			if err != nil {
-				return err
-			}
+	if err != nil {
+		fatal(err)
+	}
 
-			err = writer.Flush()
-			if err != nil {
-				return err
-			}
-			err = writer.Close()
+	runCopyJobs(files, opts.parallelism, func(job copyJob) error {
+		return putFile(client, job, opts)
+	})
+
+	// Writing files into a directory changes its modification time, so we have
+	// to wait until the end to set it, starting with the innermost directories.
+	if opts.preserve {
+		for i := len(dirs) - 1; i >= 0; i-- {
+			err := preserveRemote(client, dirs[i].dest, dirs[i].info)
 			if err != nil {
-				return err
+				printError(err)
+				status = 1
 			}
 		}
+	}
+}
 
-		return nil
+// putFile uploads a single file. The data is written to a temporary file
+// alongside the destination, which is renamed into place once it's complete.
+func putFile(client *hdfs.Client, job copyJob, opts copyOptions) error {
+	_, err := client.Stat(job.dest)
+	if err == nil && !opts.overwrite {
+		return existingFileError("put", job)
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// A partial upload is left behind if the copy fails, so that it can be
+	// picked up again with --resume.
+	tmp := job.dest + copyingSuffix
+	if !opts.resume {
+		err = client.Remove(tmp)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	err = client.CopyToRemote(job.source, tmp, hdfs.CopyOptions{
+		Resume:      opts.resume,
+		Parallelism: opts.blockParallelism,
 	})
+	if err != nil {
+		return err
+	}
 
+	if opts.verify {
+		err = verifyChecksum(client, tmp, job.source)
+		if err != nil {
+			client.Remove(tmp)
+			return err
+		}
+	}
+
+	err = client.Rename(tmp, job.dest)
 	if err != nil {
-		fatal(err)
+		return err
+	}
+
+	if opts.preserve {
+		return preserveRemote(client, job.dest, job.info)
 	}
+
+	return nil
+}
+
+// preserveRemote copies the permissions and modification time of a local file
+// to the remote one. The local access time isn't portably available, so the
+// modification time is used for both.
+func preserveRemote(client *hdfs.Client, dest string, info os.FileInfo) error {
+	err := client.Chmod(dest, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	return client.Chtimes(dest, info.ModTime(), info.ModTime())
 }
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+// statTimeFormat matches the date format used by 'hadoop fs -stat'.
+const statTimeFormat = "2006-01-02 15:04:05"
+
+func stat(paths []string, format string) {
+	if len(paths) == 0 {
+		fatalWithUsage()
+	}
+
+	expanded, client, err := getClientAndExpandedPaths(paths)
+	if err != nil {
+		fatal(err)
+	}
+
+	for _, p := range expanded {
+		info, err := client.Stat(p)
+		if err != nil {
+			printError(err)
+			status = 1
+			continue
+		}
+
+		if jsonOutput {
+			printJSON(newJSONFileInfo(p, info.(*hdfs.FileInfo)))
+		} else {
+			fmt.Println(formatStat(format, info.(*hdfs.FileInfo)))
+		}
+	}
+}
+
+// formatStat expands the format specifiers supported by 'hadoop fs -stat':
+//
+//	%a  permissions in octal
+//	%A  permissions in symbolic form
+//	%b  file size in bytes
+//	%F  file type ("regular file", "directory" or "symlink")
+//	%g  group name of owner
+//	%n  file name
+//	%o  block size
+//	%r  replication factor
+//	%u  user name of owner
+//	%x  access time, as "yyyy-MM-dd HH:mm:ss" in UTC
+//	%X  access time, in milliseconds since the epoch
+//	%y  modification time, as "yyyy-MM-dd HH:mm:ss" in UTC
+//	%Y  modification time, in milliseconds since the epoch
+//
+// Unknown specifiers are printed verbatim.
+func formatStat(format string, fi *hdfs.FileInfo) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case 'a':
+			b.WriteString(strconv.FormatUint(uint64(fi.Mode())&07777, 8))
+		case 'A':
+			b.WriteString(formatPermissions(fi.Mode()))
+		case 'b':
+			b.WriteString(strconv.FormatInt(fi.Size(), 10))
+		case 'F':
+			b.WriteString(fileType(fi))
+		case 'g':
+			b.WriteString(fi.OwnerGroup())
+		case 'n':
+			b.WriteString(fi.Name())
+		case 'o':
+			b.WriteString(strconv.FormatInt(fi.BlockSize(), 10))
+		case 'r':
+			replication := fi.GetReplication()
+			if replication < 0 {
+				replication = 0
+			}
+
+			b.WriteString(strconv.Itoa(int(replication)))
+		case 'u':
+			b.WriteString(fi.Owner())
+		case 'x':
+			b.WriteString(fi.AccessTime().UTC().Format(statTimeFormat))
+		case 'X':
+			b.WriteString(strconv.FormatUint(fi.Sys().(*hdfs.FileStatus).GetAccessTime(), 10))
+		case 'y':
+			b.WriteString(fi.ModTime().UTC().Format(statTimeFormat))
+		case 'Y':
+			b.WriteString(strconv.FormatUint(fi.Sys().(*hdfs.FileStatus).GetModificationTime(), 10))
+		default:
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+
+	return b.String()
+}
+
+func fileType(fi *hdfs.FileInfo) string {
+	switch {
+	case fi.IsDir():
+		return "directory"
+	case fi.IsSymlink():
+		return "symlink"
+	default:
+		return "regular file"
+	}
+}
+
+// formatPermissions returns permissions in the style of 'ls -l', without the
+// leading file type. Unlike os.FileMode.String, it understands the HDFS
+// sticky bit (01000).
+func formatPermissions(mode os.FileMode) string {
+	perm := []byte(mode.Perm().String()[1:])
+	if uint32(mode)&01000 != 0 {
+		if perm[8] == 'x' {
+			perm[8] = 't'
+		} else {
+			perm[8] = 'T'
+		}
+	}
+
+	return string(perm)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2"
+)
+
+// inodePathPrefix can be used to refer to a file by its inode ID, which
+// stays the same if the file is renamed.
+const inodePathPrefix = "/.reserved/.inodes/"
+
+// followedFile is a file being watched by tail -f or -F.
+type followedFile struct {
+	path   string
+	file   *hdfs.FileReader
+	fileID uint64
+}
+
+func tail(paths []string, numLines, numBytes int64, follow, followName bool, interval string) {
+	seconds, err := strconv.ParseFloat(interval, 64)
+	if err != nil || seconds <= 0 {
+		fatalWithUsage("Invalid interval:", interval)
+	}
+
+	expanded, client, err := getClientAndExpandedPaths(paths)
+	if err != nil {
+		fatal(err)
+	}
+
+	following := follow || followName
+	files := printSections(client, expanded, numLines, numBytes, true, following)
+	if following {
+		followFiles(client, expanded, files, followName, time.Duration(seconds*float64(time.Second)))
+	}
+}
+
+// followFiles polls the given files for new data every interval, and prints
+// it as it arrives, until the process is killed. If byName is true, the paths
+// are followed rather than the files, so that if a file is renamed or
+// deleted and then replaced (for example, by log rotation), the new file is
+// picked up.
+func followFiles(client *hdfs.Client, paths []string, files []*hdfs.FileReader, byName bool, interval time.Duration) {
+	var followed []*followedFile
+	for i, p := range paths {
+		ff := &followedFile{path: p}
+		if files[i] != nil {
+			_, err := files[i].Seek(0, io.SeekEnd)
+			if err != nil {
+				fatal(err)
+			}
+
+			ff.follow(client, files[i])
+		} else if !byName {
+			continue
+		}
+
+		followed = append(followed, ff)
+	}
+
+	var last *followedFile
+	for len(followed) > 0 {
+		time.Sleep(interval)
+
+		for i := 0; i < len(followed); i++ {
+			ff := followed[i]
+			if ff.file != nil {
+				err := ff.print(len(paths) > 1 && last != ff)
+				if err == nil {
+					last = ff
+				} else if !byName {
+					// Without -F, there's nothing left to follow.
+					fmt.Fprintln(os.Stderr, err)
+					status = 1
+					followed = append(followed[:i], followed[i+1:]...)
+					i--
+					continue
+				}
+			}
+
+			if byName {
+				ff.checkReplaced(client)
+			}
+		}
+	}
+}
+
+// follow starts following an open file. If possible, the file is reopened by
+// its inode ID, so that it can still be read after being renamed.
+func (ff *followedFile) follow(client *hdfs.Client, file *hdfs.FileReader) {
+	ff.file = file
+	ff.fileID = file.Stat().Sys().(*hdfs.FileStatus).GetFileId()
+	if ff.fileID == 0 {
+		return
+	}
+
+	byID, err := client.Open(inodePathPrefix + strconv.FormatUint(ff.fileID, 10))
+	if err != nil {
+		return
+	}
+
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = byID.Seek(offset, io.SeekStart)
+	}
+
+	if err != nil {
+		byID.Close()
+		return
+	}
+
+	file.Close()
+	ff.file = byID
+}
+
+// print prints any data appended to the file since the last call.
+func (ff *followedFile) print(header bool) error {
+	offset, err := ff.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	err = ff.file.Refresh()
+	if err != nil {
+		return err
+	}
+
+	length, err := ff.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	if length < offset {
+		fmt.Fprintf(os.Stderr, "%s: file truncated\n", ff.path)
+		offset = 0
+	} else if length == offset {
+		return nil
+	}
+
+	_, err = ff.file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	if header {
+		fmt.Fprintf(os.Stderr, "%s:\n", ff.path)
+	}
+
+	_, err = io.Copy(os.Stdout, ff.file)
+	return err
+}
+
+// checkReplaced reopens the file if the path now refers to a different one,
+// and stops reading it if it's gone.
+func (ff *followedFile) checkReplaced(client *hdfs.Client) {
+	info, err := client.Stat(ff.path)
+	if err != nil {
+		if ff.file != nil {
+			fmt.Fprintf(os.Stderr, "%s: file has become inaccessible\n", ff.path)
+			ff.file.Close()
+			ff.file = nil
+		}
+
+		return
+	}
+
+	fileID := info.Sys().(*hdfs.FileStatus).GetFileId()
+	if ff.file != nil && fileID == ff.fileID {
+		return
+	}
+
+	file, err := client.Open(ff.path)
+	if err != nil {
+		return
+	} else if file.Stat().IsDir() {
+		file.Close()
+		return
+	}
+
+	if ff.file != nil {
+		fmt.Fprintf(os.Stderr, "%s: file has been replaced; following new file\n", ff.path)
+		ff.file.Close()
+	} else {
+		fmt.Fprintf(os.Stderr, "%s: file has appeared; following new file\n", ff.path)
+	}
+
+	ff.follow(client, file)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"errors"
-	"fmt"
 	"os"
 
 	"github.com/colinmarc/hdfs/v2"
@@ -27,17 +26,23 @@ func test(args []string, exists, file, dir, empty, nonempty bool) {
 	}
 
 	var f func(fi os.FileInfo) bool
+	var flag string
 	switch {
 	case exists:
 		f = func(fi os.FileInfo) bool { return fi != nil }
+		flag = "-e"
 	case dir:
 		f = func(fi os.FileInfo) bool { return fi != nil && fi.IsDir() }
+		flag = "-d"
 	case file:
 		f = func(fi os.FileInfo) bool { return fi != nil && fi.(*hdfs.FileInfo).IsFile() }
+		flag = "-f"
 	case nonempty:
 		f = func(fi os.FileInfo) bool { return fi != nil && fi.Size() != 0 }
+		flag = "-s"
 	case empty:
 		f = func(fi os.FileInfo) bool { return fi != nil && fi.Size() == 0 }
+		flag = "-z"
 	}
 
 	expanded, client, err := getClientAndExpandedPaths(args)
@@ -48,11 +53,16 @@ func test(args []string, exists, file, dir, empty, nonempty bool) {
 	for _, p := range expanded {
 		fi, err := client.Stat(p)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
-			fmt.Fprintln(os.Stderr, err)
+			printError(err)
 			continue
 		}
 
-		if !f(fi) {
+		result := f(fi)
+		if jsonOutput {
+			printJSON(jsonTestResult{Path: p, Test: flag, Result: result})
+		}
+
+		if !result {
 			status = 1
 		}
 	}
@@ -0,0 +1,34 @@
+#!/usr/bin/env bats
+
+load helper
+
+setup() {
+  $HDFS mkdir -p /_test_cmd/count/dir1/dir2
+  $HADOOP_FS -cp hdfs://$HADOOP_NAMENODE/_test/foo.txt hdfs://$HADOOP_NAMENODE/_test_cmd/count/dir1/foo.txt
+}
+
+@test "count" {
+  run $HDFS count /_test_cmd/count
+  assert_success
+  assert_output "           3            1                  4 /_test_cmd/count"
+}
+
+@test "count matches hadoop" {
+  COUNT=$($HADOOP_FS -count hdfs://$HADOOP_NAMENODE/_test_cmd/count | sed "s|hdfs://$HADOOP_NAMENODE||")
+
+  run $HDFS count /_test_cmd/count
+  assert_success
+  assert_output "$COUNT"
+}
+
+@test "count nonexistent" {
+  run $HDFS count /_test_cmd/nonexistent
+  assert_failure
+  assert_output <<OUT
+content summary /_test_cmd/nonexistent: file does not exist
+OUT
+}
+
+teardown() {
+  $HDFS rm -r /_test_cmd/count
+}
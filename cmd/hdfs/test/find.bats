@@ -0,0 +1,102 @@
+#!/usr/bin/env bats
+
+load helper
+
+setup() {
+  $HDFS mkdir -p /_test_cmd/find/dir1/dir2
+  $HDFS touch /_test_cmd/find/dir1/a.txt
+  $HDFS touch /_test_cmd/find/dir1/dir2/B.TXT
+  $HDFS touch "/_test_cmd/find/dir1/with space"
+  $HADOOP_FS -cp hdfs://$HADOOP_NAMENODE/_test/foo.txt hdfs://$HADOOP_NAMENODE/_test_cmd/find/foo.txt
+}
+
+@test "find" {
+  run $HDFS find /_test_cmd/find
+  assert_success
+  assert_output <<OUT
+/_test_cmd/find
+/_test_cmd/find/dir1
+/_test_cmd/find/dir1/a.txt
+/_test_cmd/find/dir1/dir2
+/_test_cmd/find/dir1/dir2/B.TXT
+/_test_cmd/find/dir1/with space
+/_test_cmd/find/foo.txt
+OUT
+}
+
+@test "find name" {
+  run $HDFS find /_test_cmd/find -name '*.txt'
+  assert_success
+  assert_output <<OUT
+/_test_cmd/find/dir1/a.txt
+/_test_cmd/find/foo.txt
+OUT
+}
+
+@test "find iname" {
+  run $HDFS find /_test_cmd/find -iname '*.txt'
+  assert_success
+  assert_output <<OUT
+/_test_cmd/find/dir1/a.txt
+/_test_cmd/find/dir1/dir2/B.TXT
+/_test_cmd/find/foo.txt
+OUT
+}
+
+@test "find type" {
+  run $HDFS find /_test_cmd/find -type d
+  assert_success
+  assert_output <<OUT
+/_test_cmd/find
+/_test_cmd/find/dir1
+/_test_cmd/find/dir1/dir2
+OUT
+}
+
+@test "find size" {
+  run $HDFS find /_test_cmd/find -type f -size +0c
+  assert_success
+  assert_output <<OUT
+/_test_cmd/find/foo.txt
+OUT
+}
+
+@test "find negated" {
+  run $HDFS find /_test_cmd/find/dir1 ! -type d -not -name '*.txt'
+  assert_success
+  assert_output <<OUT
+/_test_cmd/find/dir1/dir2/B.TXT
+/_test_cmd/find/dir1/with space
+OUT
+}
+
+@test "find print0" {
+  run bash -c "$HDFS find /_test_cmd/find/dir1 -name 'with*' -print0 | tr '\0' '|'"
+  assert_success
+  assert_output "/_test_cmd/find/dir1/with space|"
+}
+
+@test "find delete" {
+  run $HDFS find /_test_cmd/find/dir1 -delete
+  assert_success
+
+  run $HDFS ls /_test_cmd/find
+  assert_success
+  assert_output <<OUT
+foo.txt
+OUT
+}
+
+@test "find invalid predicate" {
+  run $HDFS find /_test_cmd/find -foo bar
+  assert_failure
+}
+
+@test "find nonexistent" {
+  run $HDFS find /_test_cmd/nonexistent
+  assert_failure
+}
+
+teardown() {
+  $HDFS rm -r /_test_cmd/find
+}
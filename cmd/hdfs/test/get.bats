@@ -0,0 +1,117 @@
+#!/usr/bin/env bats
+
+load helper
+
+setup() {
+  $HDFS mkdir -p /_test_cmd/get
+  $HDFS put $ROOT_TEST_DIR/testdata /_test_cmd/get/testdata
+  mkdir -p $BATS_TMPDIR/get
+}
+
+@test "get" {
+  run $HDFS get /_test_cmd/get/testdata/foo.txt $BATS_TMPDIR/get/foo.txt
+  assert_success
+
+  run cat $BATS_TMPDIR/get/foo.txt
+  assert_output "bar"
+}
+
+@test "get dir parallel" {
+  run $HDFS get -j 4 /_test_cmd/get/testdata $BATS_TMPDIR/get/testdata
+  assert_success
+
+  run cat $BATS_TMPDIR/get/testdata/foo.txt
+  assert_output "bar"
+
+  SHA=`shasum < $ROOT_TEST_DIR/testdata/mobydick.txt | awk '{ print $1 }'`
+  assert_equal $SHA `shasum < $BATS_TMPDIR/get/testdata/mobydick.txt | awk '{ print $1 }'`
+}
+
+@test "get doesn't overwrite existing file" {
+  echo "baz" > $BATS_TMPDIR/get/foo.txt
+
+  run $HDFS get /_test_cmd/get/testdata/foo.txt $BATS_TMPDIR/get/foo.txt
+  assert_failure
+  assert_output "get $BATS_TMPDIR/get/foo.txt: file already exists"
+
+  run cat $BATS_TMPDIR/get/foo.txt
+  assert_output "baz"
+}
+
+@test "get dir skips existing files" {
+  mkdir -p $BATS_TMPDIR/get/testdata
+  echo "baz" > $BATS_TMPDIR/get/testdata/foo.txt
+
+  run $HDFS get /_test_cmd/get/testdata $BATS_TMPDIR/get/testdata
+  assert_success
+  assert_output "$BATS_TMPDIR/get/testdata/foo.txt: file already exists; skipping"
+
+  run cat $BATS_TMPDIR/get/testdata/foo.txt
+  assert_output "baz"
+
+  SHA=`shasum < $ROOT_TEST_DIR/testdata/mobydick.txt | awk '{ print $1 }'`
+  assert_equal $SHA `shasum < $BATS_TMPDIR/get/testdata/mobydick.txt | awk '{ print $1 }'`
+}
+
+@test "get overwrites existing file" {
+  echo "baz" > $BATS_TMPDIR/get/foo.txt
+
+  run $HDFS get -f /_test_cmd/get/testdata/foo.txt $BATS_TMPDIR/get/foo.txt
+  assert_success
+
+  run cat $BATS_TMPDIR/get/foo.txt
+  assert_output "bar"
+}
+
+@test "get preserve" {
+  $HDFS chmod 0640 /_test_cmd/get/testdata/foo.txt
+
+  run $HDFS get -p /_test_cmd/get/testdata/foo.txt $BATS_TMPDIR/get/foo.txt
+  assert_success
+
+  run stat -c "%a %Y" $BATS_TMPDIR/get/foo.txt
+  assert_output "`$HDFS stat -c "%a %Y" /_test_cmd/get/testdata/foo.txt`"
+}
+
+@test "get verify" {
+  run $HDFS get -c /_test_cmd/get/testdata/mobydick.txt $BATS_TMPDIR/get/mobydick.txt
+  assert_success
+}
+
+@test "get resume" {
+  echo -n "ba" > $BATS_TMPDIR/get/foo.txt._COPYING_
+
+  run $HDFS get --resume /_test_cmd/get/testdata/foo.txt $BATS_TMPDIR/get/foo.txt
+  assert_success
+
+  run cat $BATS_TMPDIR/get/foo.txt
+  assert_output "bar"
+  [ ! -e $BATS_TMPDIR/get/foo.txt._COPYING_ ]
+}
+
+@test "get blocks in parallel" {
+  run $HDFS get -b 2 /_test/mobydick.txt $BATS_TMPDIR/get/mobydick.txt
+  assert_success
+
+  SHA=`shasum < $ROOT_TEST_DIR/testdata/mobydick.txt | awk '{ print $1 }'`
+  assert_equal $SHA `shasum < $BATS_TMPDIR/get/mobydick.txt | awk '{ print $1 }'`
+}
+
+@test "get with bandwidth limit" {
+  run $HDFS get --bandwidth 10M /_test/mobydick.txt $BATS_TMPDIR/get/mobydick.txt
+  assert_success
+
+  SHA=`shasum < $ROOT_TEST_DIR/testdata/mobydick.txt | awk '{ print $1 }'`
+  assert_equal $SHA `shasum < $BATS_TMPDIR/get/mobydick.txt | awk '{ print $1 }'`
+}
+
+@test "get with invalid bandwidth" {
+  run $HDFS get --bandwidth 10X /_test/mobydick.txt $BATS_TMPDIR/get/mobydick.txt
+  assert_failure
+  [ ! -e $BATS_TMPDIR/get/mobydick.txt ]
+}
+
+teardown() {
+  $HDFS rm -r /_test_cmd/get
+  rm -rf $BATS_TMPDIR/get
+}
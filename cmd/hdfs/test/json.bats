@@ -0,0 +1,59 @@
+#!/usr/bin/env bats
+
+load helper
+
+setup() {
+  $HDFS mkdir -p /_test_cmd/json/dir1
+  $HADOOP_FS -cp hdfs://$HADOOP_NAMENODE/_test/foo.txt hdfs://$HADOOP_NAMENODE/_test_cmd/json/foo.txt
+}
+
+@test "ls json" {
+  run bash -c "$HDFS --json ls /_test_cmd/json | cut -d, -f1-4"
+  assert_success
+  assert_output <<OUT
+{"path":"/_test_cmd/json/dir1","name":"dir1","type":"directory","size":0
+{"path":"/_test_cmd/json/foo.txt","name":"foo.txt","type":"regular file","size":4
+OUT
+}
+
+@test "stat json" {
+  run bash -c "$HDFS -o json stat /_test_cmd/json/foo.txt | cut -d, -f1-5"
+  assert_success
+  assert_output '{"path":"/_test_cmd/json/foo.txt","name":"foo.txt","type":"regular file","size":4,"permission":"644"'
+}
+
+@test "du json" {
+  run $HDFS --json du -s /_test_cmd/json
+  assert_success
+  assert_output '{"path":"/_test_cmd/json","size":4}'
+}
+
+@test "count json" {
+  run bash -c "$HDFS --json count /_test_cmd/json | cut -d, -f1-4"
+  assert_success
+  assert_output '{"path":"/_test_cmd/json","directory_count":2,"file_count":1,"size":4'
+}
+
+@test "test json" {
+  run $HDFS --json test -d /_test_cmd/json/dir1 /_test_cmd/json/foo.txt
+  assert_failure
+  assert_output <<OUT
+{"path":"/_test_cmd/json/dir1","test":"-d","result":true}
+{"path":"/_test_cmd/json/foo.txt","test":"-d","result":false}
+OUT
+}
+
+@test "error json" {
+  run $HDFS --json ls /_test_cmd/nonexistent
+  assert_failure
+  assert_output '{"error":"file does not exist","op":"stat","path":"/_test_cmd/nonexistent"}'
+}
+
+@test "unknown output format" {
+  run $HDFS -o yaml ls /_test_cmd/json
+  assert_failure
+}
+
+teardown() {
+  $HDFS rm -r /_test_cmd/json
+}
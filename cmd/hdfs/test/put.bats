@@ -27,6 +27,17 @@ setup() {
   assert_equal $SHA `shasum < $BATS_TMPDIR/mobydick_test.txt | awk '{ print $1 }'`
 }
 
+@test "put long with parallel blocks" {
+  run $HDFS put -b 4 $ROOT_TEST_DIR/testdata/mobydick.txt /_test_cmd/put/1
+  assert_success
+
+  run bash -c "$HDFS cat /_test_cmd/put/1/mobydick.txt > $BATS_TMPDIR/mobydick_test.txt"
+  assert_success
+
+  SHA=`shasum < $ROOT_TEST_DIR/testdata/mobydick.txt | awk '{ print $1 }'`
+  assert_equal $SHA `shasum < $BATS_TMPDIR/mobydick_test.txt | awk '{ print $1 }'`
+}
+
 @test "put dir" {
   run $HDFS put $ROOT_TEST_DIR/testdata /_test_cmd/put/test2
   assert_success
@@ -64,6 +75,81 @@ mkdir /_test_cmd/put/existing.txt: file already exists
 OUT
 }
 
+@test "put dir parallel" {
+  run $HDFS put -j 4 $ROOT_TEST_DIR/testdata /_test_cmd/put/parallel
+  assert_success
+
+  run $HDFS cat /_test_cmd/put/parallel/foo.txt
+  assert_output "bar"
+
+  run bash -c "$HDFS cat /_test_cmd/put/parallel/mobydick.txt > $BATS_TMPDIR/mobydick_test.txt"
+  assert_success
+
+  SHA=`shasum < $ROOT_TEST_DIR/testdata/mobydick.txt | awk '{ print $1 }'`
+  assert_equal $SHA `shasum < $BATS_TMPDIR/mobydick_test.txt | awk '{ print $1 }'`
+}
+
+@test "put doesn't overwrite existing file" {
+  run $HDFS put $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/put/existing.txt
+  assert_failure
+  assert_output "put /_test_cmd/put/existing.txt: file already exists"
+
+  run $HDFS cat /_test_cmd/put/existing.txt
+  assert_output ""
+}
+
+@test "put dir skips existing files" {
+  $HDFS mkdir -p /_test_cmd/put/test/testdata
+  $HDFS touch /_test_cmd/put/test/testdata/foo.txt
+
+  run $HDFS put $ROOT_TEST_DIR/testdata /_test_cmd/put/test
+  assert_success
+  assert_output "/_test_cmd/put/test/testdata/foo.txt: file already exists; skipping"
+
+  run $HDFS cat /_test_cmd/put/test/testdata/foo.txt
+  assert_output ""
+
+  run $HDFS cat /_test_cmd/put/test/testdata/mobydick.txt
+  assert_success
+}
+
+@test "put overwrites existing file" {
+  run $HDFS put -f $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/put/existing.txt
+  assert_success
+
+  run $HDFS cat /_test_cmd/put/existing.txt
+  assert_output "bar"
+}
+
+@test "put preserve" {
+  touch -t 201501020304.05 $BATS_TMPDIR/preserve.txt
+  chmod 0640 $BATS_TMPDIR/preserve.txt
+
+  run $HDFS put -p $BATS_TMPDIR/preserve.txt /_test_cmd/put/1
+  assert_success
+
+  run $HDFS stat -c "%a %Y" /_test_cmd/put/1/preserve.txt
+  assert_output "640 `date -r $BATS_TMPDIR/preserve.txt +%s`"
+}
+
+@test "put verify" {
+  run $HDFS put -c $ROOT_TEST_DIR/testdata/mobydick.txt /_test_cmd/put/1
+  assert_success
+}
+
+@test "put resume" {
+  echo -n "ba" | $HDFS put - /_test_cmd/put/1/foo.txt._COPYING_
+
+  run $HDFS put --resume $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/put/1
+  assert_success
+
+  run $HDFS cat /_test_cmd/put/1/foo.txt
+  assert_output "bar"
+
+  run $HDFS test -e /_test_cmd/put/1/foo.txt._COPYING_
+  assert_failure
+}
+
 @test "put stdin" {
   run bash -c "echo 'foo bar baz' | $HDFS put - /_test_cmd/put/stdin.txt"
   assert_success
@@ -72,6 +158,22 @@ OUT
   assert_output "foo bar baz"
 }
 
+@test "put with bandwidth limit" {
+  run $HDFS put --bandwidth 10M $ROOT_TEST_DIR/testdata/mobydick.txt /_test_cmd/put/1
+  assert_success
+
+  run bash -c "$HDFS cat /_test_cmd/put/1/mobydick.txt > $BATS_TMPDIR/mobydick_bandwidth_test.txt"
+  assert_success
+
+  SHA=`shasum < $ROOT_TEST_DIR/testdata/mobydick.txt | awk '{ print $1 }'`
+  assert_equal $SHA `shasum < $BATS_TMPDIR/mobydick_bandwidth_test.txt | awk '{ print $1 }'`
+}
+
+@test "put with invalid bandwidth" {
+  run $HDFS put --bandwidth -1 $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/put/1
+  assert_failure
+}
+
 @test "put stdin long" {
   run bash -c "cat $ROOT_TEST_DIR/testdata/mobydick.txt | $HDFS put - /_test_cmd/put/mobydick_stdin.txt"
   assert_success
@@ -0,0 +1,51 @@
+#!/usr/bin/env bats
+
+load helper
+
+setup() {
+  $HDFS mkdir -p /_test_cmd/stat/dir
+  $HDFS chmod 1777 /_test_cmd/stat/dir
+}
+
+@test "stat" {
+  FOO_MTIME=$($HADOOP_FS -stat hdfs://$HADOOP_NAMENODE/_test/foo.txt)
+
+  run $HDFS stat /_test/foo.txt
+  assert_success
+  assert_output "$FOO_MTIME"
+}
+
+@test "stat format" {
+  FOO_STAT=$($HADOOP_FS -stat '%b %F %n %o %r %u %g %Y' hdfs://$HADOOP_NAMENODE/_test/foo.txt)
+
+  run $HDFS stat -c '%b %F %n %o %r %u %g %Y' /_test/foo.txt
+  assert_success
+  assert_output "$FOO_STAT"
+}
+
+@test "stat dir permissions" {
+  run $HDFS stat -c '%F %a %A %b' /_test_cmd/stat/dir
+  assert_success
+  assert_output "directory 1777 rwxrwxrwt 0"
+}
+
+@test "stat multiple files" {
+  run $HDFS stat -c '%n' /_test/foo.txt /_test_cmd/stat/dir
+  assert_success
+  assert_output <<OUT
+foo.txt
+dir
+OUT
+}
+
+@test "stat nonexistent" {
+  run $HDFS stat /_test_cmd/nonexistent
+  assert_failure
+  assert_output <<OUT
+stat /_test_cmd/nonexistent: file does not exist
+OUT
+}
+
+teardown() {
+  $HDFS rm -r /_test_cmd/stat
+}
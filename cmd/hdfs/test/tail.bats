@@ -27,3 +27,38 @@ load helper
 open /_test_cmd/nonexistent: file does not exist
 OUT
 }
+
+@test "tail follow" {
+  $HDFS mkdir -p /_test_cmd/tail
+  $HDFS put $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/tail/follow.txt
+
+  run timeout 2 $HDFS tail -f -s 0.5 /_test_cmd/tail/follow.txt
+  assert_output "bar"
+
+  $HDFS rm -r /_test_cmd/tail
+}
+
+@test "tail follow name" {
+  $HDFS mkdir -p /_test_cmd/tail
+  $HDFS put $ROOT_TEST_DIR/testdata/foo.txt /_test_cmd/tail/rotate.txt
+
+  timeout 5 $HDFS tail -F -s 0.5 /_test_cmd/tail/rotate.txt > $BATS_TMPDIR/tail_rotate.txt 2>&1 &
+  sleep 1
+  $HDFS mv /_test_cmd/tail/rotate.txt /_test_cmd/tail/rotate.txt.1
+  echo "baz" | $HDFS put - /_test_cmd/tail/rotate.txt
+  wait
+
+  # Depending on timing, the new file may be picked up in one poll or two.
+  run grep -v "^/_test_cmd/tail/rotate.txt: file has" $BATS_TMPDIR/tail_rotate.txt
+  assert_output <<OUT
+bar
+baz
+OUT
+
+  $HDFS rm -r /_test_cmd/tail
+}
+
+@test "tail invalid interval" {
+  run $HDFS tail -f -s foo /_test/foo.txt
+  assert_failure
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 func formatBytes(i uint64) string {
@@ -18,3 +20,29 @@ func formatBytes(i uint64) string {
 		return fmt.Sprintf("%dB", i)
 	}
 }
+
+// parseBytes parses a number of bytes with an optional unit, like "512",
+// "64K", "10M" or "1G". The units are powers of 1024, like in formatBytes.
+func parseBytes(s string) (int64, error) {
+	unit := int64(1)
+	num := strings.ToUpper(s)
+	switch {
+	case strings.HasSuffix(num, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(num, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(num, "G"):
+		unit = 1 << 30
+	}
+
+	if unit > 1 {
+		num = num[:len(num)-1]
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+
+	return n * unit, nil
+}
@@ -0,0 +1,34 @@
+package hdfs
+
+import (
+	"errors"
+	"os"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+// Concat moves the blocks of the source files onto the end of target, in
+// order, and then deletes the sources. No data is copied, so it's very fast.
+//
+// HDFS places several restrictions on the files: they must all have the same
+// block size, every source but the last must end on a block boundary, and
+// usually they all have to be in the same directory.
+func (c *Client) Concat(target string, sources ...string) error {
+	if len(sources) == 0 {
+		return &os.PathError{"concat", target, errors.New("no sources")}
+	}
+
+	req := &hdfs.ConcatRequestProto{
+		Trg:  proto.String(target),
+		Srcs: sources,
+	}
+	resp := &hdfs.ConcatResponseProto{}
+
+	err := c.execute("concat", req, resp)
+	if err != nil {
+		return &os.PathError{"concat", target, interpretException(err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package hdfs
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConcatPart(t *testing.T, client *Client, name string, data []byte) {
+	baleet(t, name)
+	writer, err := client.CreateFile(name, 1, 1048576, 0644)
+	require.NoError(t, err)
+
+	_, err = writer.Write(data)
+	require.NoError(t, err)
+	ignoreErrReplicating(t, writer.Close())
+}
+
+func TestConcat(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/concat")
+	first := bytes.Repeat([]byte{'a'}, 1048576)
+	second := bytes.Repeat([]byte{'b'}, 1048576)
+	third := []byte("foo")
+	writeConcatPart(t, client, "/_test/concat/target", first)
+	writeConcatPart(t, client, "/_test/concat/1", second)
+	writeConcatPart(t, client, "/_test/concat/2", third)
+
+	err := client.Concat("/_test/concat/target", "/_test/concat/1", "/_test/concat/2")
+	require.NoError(t, err)
+
+	data, err := client.ReadFile("/_test/concat/target")
+	require.NoError(t, err)
+	assert.Equal(t, append(append(first, second...), third...), data)
+
+	_, err = client.Stat("/_test/concat/1")
+	assertPathError(t, err, "stat", "/_test/concat/1", os.ErrNotExist)
+}
+
+func TestConcatNonexistent(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/concat")
+	writeConcatPart(t, client, "/_test/concat/target", []byte("foo"))
+	baleet(t, "/_test/concat/nonexistent")
+
+	err := client.Concat("/_test/concat/target", "/_test/concat/nonexistent")
+	assertPathError(t, err, "concat", "/_test/concat/target", os.ErrNotExist)
+}
@@ -31,7 +31,7 @@ func (c *Client) getContentSummary(name string) (*ContentSummary, error) {
 	req := &hdfs.GetContentSummaryRequestProto{Path: proto.String(name)}
 	resp := &hdfs.GetContentSummaryResponseProto{}
 
-	err := c.namenode.Execute("getContentSummary", req, resp)
+	err := c.execute("getContentSummary", req, resp)
 	if err != nil {
 		return nil, err
 	}
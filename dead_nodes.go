@@ -0,0 +1,49 @@
+package hdfs
+
+import (
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+// DeadDatanodes returns the datanodes that reads have recently failed
+// against, keyed by transfer address ("host:port"), along with the time of the
+// latest failure for each. These datanodes are tried last by subsequent reads,
+// until they expire (see ClientOptions.DeadNodeExpiry) or are found to be
+// healthy again.
+func (c *Client) DeadDatanodes() map[string]time.Time {
+	return c.deadNodes.DeadNodes()
+}
+
+// ClearDeadDatanodes forgets the recorded failures for the given datanodes,
+// identified by their transfer address. If no addresses are given, all
+// failures are forgotten.
+func (c *Client) ClearDeadDatanodes(addresses ...string) {
+	if len(addresses) == 0 {
+		c.deadNodes.ClearAll()
+		return
+	}
+
+	for _, address := range addresses {
+		c.deadNodes.Clear(address)
+	}
+}
+
+// probeDatanode checks whether a datanode is healthy, by asking it for its
+// info over ClientDatanodeProtocol.
+func (c *Client) probeDatanode(id *hdfs.DatanodeIDProto) error {
+	conn, err := c.newDatanodeConnection(id)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(datanodeIPCTimeout))
+	if err != nil {
+		return err
+	}
+
+	req := &hdfs.GetDatanodeInfoRequestProto{}
+	resp := &hdfs.GetDatanodeInfoResponseProto{}
+	return conn.Execute("getDatanodeInfo", req, resp)
+}
@@ -0,0 +1,63 @@
+package hdfs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadDatanodes(t *testing.T) {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	require.NoError(t, err)
+
+	options := ClientOptionsFromConf(conf)
+	if options.KerberosClient != nil {
+		options.KerberosClient = getKerberosClient(t, "gohdfs1")
+	} else {
+		options.User = "gohdfs1"
+	}
+
+	options.DeadNodeProbeInterval = -1
+	options.DatanodeDialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("no datanodes for you")
+	}
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+	defer client.Close()
+
+	_, err = client.ReadFile("/_test/foo.txt")
+	assert.Error(t, err)
+
+	dead := client.DeadDatanodes()
+	require.NotEmpty(t, dead)
+
+	for address := range dead {
+		client.ClearDeadDatanodes(address)
+		assert.NotContains(t, client.DeadDatanodes(), address)
+	}
+
+	assert.Empty(t, client.DeadDatanodes())
+}
+
+func TestProbeDatanode(t *testing.T) {
+	client := getClient(t)
+	if client.options.KerberosClient != nil {
+		t.Skip("datanode IPC calls don't support kerberos")
+	}
+
+	file, err := client.Open("/_test/foo.txt")
+	require.NoError(t, err)
+	defer file.Close()
+
+	require.NoError(t, file.getBlocks())
+	require.NotEmpty(t, file.blocks)
+	for _, loc := range file.blocks[0].GetLocs() {
+		assert.NoError(t, client.probeDatanode(loc.GetId()))
+	}
+}
@@ -40,18 +40,21 @@ func (c *Client) ServerDefaults() (ServerDefaults, error) {
 }
 
 func (c *Client) fetchDefaults() (*hdfs.FsServerDefaultsProto, error) {
-	if c.defaults != nil {
-		return c.defaults, nil
+	c.cache.lock.Lock()
+	defer c.cache.lock.Unlock()
+
+	if c.cache.defaults != nil {
+		return c.cache.defaults, nil
 	}
 
 	req := &hdfs.GetServerDefaultsRequestProto{}
 	resp := &hdfs.GetServerDefaultsResponseProto{}
 
-	err := c.namenode.Execute("getServerDefaults", req, resp)
+	err := c.execute("getServerDefaults", req, resp)
 	if err != nil {
 		return nil, err
 	}
 
-	c.defaults = resp.GetServerDefaults()
-	return c.defaults, nil
+	c.cache.defaults = resp.GetServerDefaults()
+	return c.cache.defaults, nil
 }
@@ -13,6 +13,8 @@ const (
 	alreadyBeingCreatedException = "org.apache.hadoop.hdfs.protocol.AlreadyBeingCreatedException"
 	illegalArgumentException     = "org.apache.hadoop.HadoopIllegalArgumentException"
 	parentNotDirecotryException  = "org.apache.hadoop.fs.ParentNotDirectoryException"
+	notReplicatedYetException    = "org.apache.hadoop.hdfs.server.namenode.NotReplicatedYetException"
+	replicaNotFoundException     = "org.apache.hadoop.hdfs.server.datanode.ReplicaNotFoundException"
 )
 
 // Error represents a remote java exception from an HDFS namenode or datanode.
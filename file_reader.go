@@ -2,8 +2,10 @@ package hdfs
 
 import (
 	"crypto/md5"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"time"
@@ -13,6 +15,11 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// maxBlockAccessRefreshes limits how many times a read is retried after a
+// datanode rejects the block token or data encryption key. Since both might
+// have expired, it's two.
+const maxBlockAccessRefreshes = 2
+
 // A FileReader represents an existing file or directory in HDFS. It implements
 // io.Reader, io.ReaderAt, io.Seeker, and io.Closer, and can only be used for
 // reads. For writes, see FileWriter and Client.Create.
@@ -22,11 +29,14 @@ type FileReader struct {
 	info   os.FileInfo
 
 	blocks      []*hdfs.LocatedBlockProto
+	length      int64
 	blockReader *transfer.BlockReader
 	deadline    time.Time
+	throttler   *transfer.Throttler
 	offset      int64
 
-	readdirLast string
+	readdirLast  string
+	checksumInfo *hdfs.OpBlockChecksumResponseProto
 
 	closed bool
 }
@@ -39,10 +49,12 @@ func (c *Client) Open(name string) (*FileReader, error) {
 	}
 
 	return &FileReader{
-		client: c,
-		name:   name,
-		info:   info,
-		closed: false,
+		client:    c,
+		name:      name,
+		info:      info,
+		length:    info.Size(),
+		throttler: c.readThrottler,
+		closed:    false,
 	}, nil
 }
 
@@ -56,6 +68,37 @@ func (f *FileReader) Stat() os.FileInfo {
 	return f.info
 }
 
+// Refresh updates the FileInfo and block locations for the file. If the file
+// is still being written to, this makes any data flushed since it was opened
+// available to Read. The current offset is preserved.
+func (f *FileReader) Refresh() error {
+	if f.closed {
+		return io.ErrClosedPipe
+	}
+
+	info, err := f.client.getFileInfo(f.name)
+	if err != nil {
+		return &os.PathError{"refresh", f.name, interpretException(err)}
+	}
+
+	f.info = info
+	f.length = info.Size()
+	f.blocks = nil
+
+	// The current block reader may have been started with a stale length for
+	// the last block.
+	if f.blockReader != nil {
+		f.blockReader.Close()
+		f.blockReader = nil
+	}
+
+	if info.IsDir() {
+		return nil
+	}
+
+	return f.getBlocks()
+}
+
 // SetDeadline sets the deadline for future Read, ReadAt, and Checksum calls. A
 // zero value for t means those calls will not time out.
 func (f *FileReader) SetDeadline(t time.Time) error {
@@ -68,6 +111,20 @@ func (f *FileReader) SetDeadline(t time.Time) error {
 	return nil
 }
 
+// SetBytesPerSecond limits the rate at which the file is read, in place of
+// the limit shared with other files set by ClientOptions.ReadBytesPerSecond.
+// If n is zero or negative, reads of this file aren't limited at all.
+func (f *FileReader) SetBytesPerSecond(n int64) {
+	f.throttler = nil
+	if n > 0 {
+		f.throttler = transfer.NewThrottler(n)
+	}
+
+	if f.blockReader != nil {
+		f.blockReader.SetThrottler(f.throttler)
+	}
+}
+
 // Checksum returns HDFS's internal "MD5MD5CRC32C" checksum for a given file.
 //
 // Internally to HDFS, it works by calculating the MD5 of all the CRCs (which
@@ -89,38 +146,152 @@ func (f *FileReader) Checksum() ([]byte, error) {
 		}
 	}
 
-	// Hadoop calculates this by writing the checksums out to a byte array, which
-	// is automatically padded with zeroes out to the next  power of 2
-	// (with a minimum of 32)... and then takes the MD5 of that array, including
-	// the zeroes. This is pretty shady business, but we want to track
-	// the 'hadoop fs -checksum' behavior if possible.
-	paddedLength := 32
-	totalLength := 0
-	checksum := md5.New()
-
+	blockChecksums := make([][]byte, 0, len(f.blocks))
 	for _, block := range f.blocks {
-		d, err := f.client.wrapDatanodeDial(f.client.options.DatanodeDialFunc,
-			block.GetBlockToken())
+		resp, err := f.readBlockChecksum(block)
 		if err != nil {
 			return nil, err
 		}
 
-		cr := &transfer.ChecksumReader{
-			Block:               block,
-			UseDatanodeHostname: f.client.options.UseDatanodeHostname,
-			DialFunc:            d,
+		blockChecksums = append(blockChecksums, resp.GetBlockChecksum())
+	}
+
+	return fileChecksum(blockChecksums), nil
+}
+
+// ComputeChecksum returns the checksum that Checksum would return if the file
+// contained the data read from r instead, using the same block boundaries and
+// checksum parameters as the file in HDFS. This can be used to verify a local
+// copy of the file without reading it back from HDFS.
+//
+// Exactly Size bytes are read from r; if r is shorter than that,
+// io.ErrUnexpectedEOF is returned.
+func (f *FileReader) ComputeChecksum(r io.Reader) ([]byte, error) {
+	if f.info.IsDir() {
+		return nil, &os.PathError{
+			"checksum",
+			f.name,
+			errors.New("is a directory"),
 		}
+	}
 
-		err = cr.SetDeadline(f.deadline)
+	if f.blocks == nil {
+		err := f.getBlocks()
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		blockChecksum, err := cr.ReadChecksum()
+	// The checksum parameters are determined when the file is written, so we
+	// have to ask a datanode what they are.
+	if f.checksumInfo == nil && len(f.blocks) > 0 {
+		_, err := f.readBlockChecksum(f.blocks[0])
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	var tab *crc32.Table
+	switch f.checksumInfo.GetCrcType() {
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32:
+		tab = crc32.IEEETable
+	case hdfs.ChecksumTypeProto_CHECKSUM_CRC32C:
+		tab = crc32.MakeTable(crc32.Castagnoli)
+	}
+
+	bytesPerCrc := int64(f.checksumInfo.GetBytesPerCrc())
+	if bytesPerCrc <= 0 {
+		bytesPerCrc = 512
+	}
+
+	chunk := make([]byte, bytesPerCrc)
+	crc := make([]byte, 4)
+	blockChecksums := make([][]byte, 0, len(f.blocks))
+	for _, block := range f.blocks {
+		blockChecksum := md5.New()
+		remaining := int64(block.GetB().GetNumBytes())
+		for remaining > 0 {
+			n := bytesPerCrc
+			if n > remaining {
+				n = remaining
+			}
+
+			_, err := io.ReadFull(r, chunk[:n])
+			if err == io.EOF {
+				return nil, io.ErrUnexpectedEOF
+			} else if err != nil {
+				return nil, err
+			}
+
+			if tab != nil {
+				binary.BigEndian.PutUint32(crc, crc32.Checksum(chunk[:n], tab))
+				blockChecksum.Write(crc)
+			}
+
+			remaining -= n
+		}
 
+		blockChecksums = append(blockChecksums, blockChecksum.Sum(nil))
+	}
+
+	return fileChecksum(blockChecksums), nil
+}
+
+func (f *FileReader) readBlockChecksum(block *hdfs.LocatedBlockProto) (*hdfs.OpBlockChecksumResponseProto, error) {
+	var resp *hdfs.OpBlockChecksumResponseProto
+	err := f.withBlockAccess(block, func(block *hdfs.LocatedBlockProto) error {
+		var err error
+		resp, err = f.readBlockChecksumFrom(block)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if f.checksumInfo == nil {
+		f.checksumInfo = resp
+	}
+
+	return resp, nil
+}
+
+func (f *FileReader) readBlockChecksumFrom(block *hdfs.LocatedBlockProto) (*hdfs.OpBlockChecksumResponseProto, error) {
+	d, err := f.client.wrapDatanodeDial(f.client.options.DatanodeDialFunc,
+		block.GetBlockToken())
+	if err != nil {
+		return nil, err
+	}
+
+	cr := &transfer.ChecksumReader{
+		Block:               block,
+		UseDatanodeHostname: f.client.options.UseDatanodeHostname,
+		DialFunc:            d,
+		ConnCache:           f.client.connCache,
+		DeadNodes:           f.client.deadNodes,
+	}
+
+	err = cr.SetDeadline(f.deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	return cr.ReadBlockChecksum()
+}
+
+// fileChecksum combines the checksums of each block into a checksum for the
+// whole file.
+//
+// Hadoop calculates this by writing the checksums out to a byte array, which
+// is automatically padded with zeroes out to the next  power of 2
+// (with a minimum of 32)... and then takes the MD5 of that array, including
+// the zeroes. This is pretty shady business, but we want to track
+// the 'hadoop fs -checksum' behavior if possible.
+func fileChecksum(blockChecksums [][]byte) []byte {
+	paddedLength := 32
+	totalLength := 0
+	checksum := md5.New()
+
+	for _, blockChecksum := range blockChecksums {
 		checksum.Write(blockChecksum)
 		totalLength += len(blockChecksum)
 		if paddedLength < totalLength {
@@ -129,7 +300,7 @@ func (f *FileReader) Checksum() ([]byte, error) {
 	}
 
 	checksum.Write(make([]byte, paddedLength-totalLength))
-	return checksum.Sum(nil), nil
+	return checksum.Sum(nil)
 }
 
 // Seek implements io.Seeker.
@@ -140,6 +311,15 @@ func (f *FileReader) Seek(offset int64, whence int) (int64, error) {
 		return 0, io.ErrClosedPipe
 	}
 
+	// The length of a file that's still being written to isn't known until
+	// we've asked the datanodes.
+	if f.blocks == nil && !f.info.IsDir() {
+		err := f.getBlocks()
+		if err != nil {
+			return f.offset, err
+		}
+	}
+
 	var off int64
 	switch whence {
 	case io.SeekStart:
@@ -147,12 +327,12 @@ func (f *FileReader) Seek(offset int64, whence int) (int64, error) {
 	case io.SeekCurrent:
 		off = f.offset + offset
 	case io.SeekEnd:
-		off = f.info.Size() + offset
+		off = f.length + offset
 	default:
 		return f.offset, fmt.Errorf("invalid whence: %d", whence)
 	}
 
-	if off < 0 || off > f.info.Size() {
+	if off < 0 || off > f.length {
 		return f.offset, fmt.Errorf("invalid resulting offset: %d", off)
 	}
 
@@ -187,14 +367,6 @@ func (f *FileReader) Read(b []byte) (int, error) {
 		}
 	}
 
-	if f.offset >= f.info.Size() {
-		return 0, io.EOF
-	}
-
-	if len(b) == 0 {
-		return 0, nil
-	}
-
 	if f.blocks == nil {
 		err := f.getBlocks()
 		if err != nil {
@@ -202,6 +374,15 @@ func (f *FileReader) Read(b []byte) (int, error) {
 		}
 	}
 
+	if f.offset >= f.length {
+		return 0, io.EOF
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	refreshes := 0
 	for {
 		if f.blockReader == nil {
 			err := f.getNewBlockReader()
@@ -216,6 +397,14 @@ func (f *FileReader) Read(b []byte) (int, error) {
 		if err != nil && err != io.EOF {
 			f.blockReader.Close()
 			f.blockReader = nil
+
+			// If our credentials have expired, refresh them and try again.
+			if n == 0 && refreshes < maxBlockAccessRefreshes && f.refreshBlocks(err) {
+				f.client.observeRetry("read", f.name, err)
+				refreshes++
+				continue
+			}
+
 			return n, err
 		} else if n > 0 {
 			return n, nil
@@ -230,6 +419,11 @@ func (f *FileReader) Read(b []byte) (int, error) {
 }
 
 // ReadAt implements io.ReaderAt.
+//
+// If hedged reads are enabled for the Client (see
+// ClientOptions.HedgedReadPoolSize), each block is read over a new connection,
+// and slow datanodes are hedged against by reading from other replicas. In
+// that case, the offset used by Read is left unchanged.
 func (f *FileReader) ReadAt(b []byte, off int64) (int, error) {
 	if f.closed {
 		return 0, io.ErrClosedPipe
@@ -239,6 +433,10 @@ func (f *FileReader) ReadAt(b []byte, off int64) (int, error) {
 		return 0, &os.PathError{"readat", f.name, errors.New("negative offset")}
 	}
 
+	if f.client.hedgedReads != nil {
+		return f.readAtHedged(b, off)
+	}
+
 	_, err := f.Seek(off, 0)
 	if err != nil {
 		return 0, err
@@ -255,6 +453,73 @@ func (f *FileReader) ReadAt(b []byte, off int64) (int, error) {
 	return n, err
 }
 
+func (f *FileReader) readAtHedged(b []byte, off int64) (int, error) {
+	if f.info.IsDir() {
+		return 0, &os.PathError{
+			"readat",
+			f.name,
+			errors.New("is a directory"),
+		}
+	}
+
+	if f.blocks == nil {
+		err := f.getBlocks()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Like os.File.ReadAt, return io.EOF if there isn't enough data.
+	var eof error
+	if off >= f.length {
+		return 0, io.EOF
+	} else if off+int64(len(b)) > f.length {
+		b = b[:f.length-off]
+		eof = io.EOF
+	}
+
+	n := 0
+	for n < len(b) {
+		pos := uint64(off) + uint64(n)
+		var block *hdfs.LocatedBlockProto
+		for _, candidate := range f.blocks {
+			start := candidate.GetOffset()
+			if start <= pos && pos < start+candidate.GetB().GetNumBytes() {
+				block = candidate
+				break
+			}
+		}
+
+		if block == nil {
+			return n, errors.New("invalid offset")
+		}
+
+		end := len(b)
+		remaining := block.GetOffset() + block.GetB().GetNumBytes() - pos
+		if uint64(end-n) > remaining {
+			end = n + int(remaining)
+		}
+
+		err := f.withBlockAccess(block, func(block *hdfs.LocatedBlockProto) error {
+			br, err := f.newBlockReader(block, 0)
+			if err != nil {
+				return err
+			}
+
+			_, err = br.ReadAt(b[n:end], int64(pos-block.GetOffset()))
+			br.Close()
+			return err
+		})
+		if err != nil {
+			return n, err
+		}
+
+		n = end
+	}
+
+	return n, eof
+}
+
 // Readdir reads the contents of the directory associated with file and returns
 // a slice of up to n os.FileInfo values, as would be returned by Stat, in
 // directory order. Subsequent calls on the same file will yield further
@@ -334,7 +599,7 @@ func (f *FileReader) readdir() ([]os.FileInfo, int, error) {
 	}
 	resp := &hdfs.GetListingResponseProto{}
 
-	err := f.client.namenode.Execute("getListing", req, resp)
+	err := f.client.execute("getListing", req, resp)
 	if err != nil {
 		return nil, 0, err
 	} else if resp.GetDirList() == nil {
@@ -399,15 +664,199 @@ func (f *FileReader) getBlocks() error {
 	}
 	resp := &hdfs.GetBlockLocationsResponseProto{}
 
-	err := f.client.namenode.Execute("getBlockLocations", req, resp)
+	err := f.client.execute("getBlockLocations", req, resp)
 	if err != nil {
 		return err
 	}
 
-	f.blocks = resp.GetLocations().GetBlocks()
+	locations := resp.GetLocations()
+	blocks := locations.GetBlocks()
+	length := int64(locations.GetFileLength())
+
+	// If the file is still being written to, the length reported by the
+	// namenode doesn't include the last block, and only the datanodes know
+	// how much of it is safe to read.
+	lastBlock := locations.GetLastBlock()
+	if locations.GetUnderConstruction() && !locations.GetIsLastBlockComplete() && lastBlock != nil {
+		visibleLength, err := f.getVisibleLength(lastBlock)
+		if err != nil {
+			return err
+		}
+
+		lastBlock = proto.Clone(lastBlock).(*hdfs.LocatedBlockProto)
+		lastBlock.B.NumBytes = proto.Uint64(uint64(visibleLength))
+
+		// The last block may or may not have been included in the list.
+		for i, block := range blocks {
+			if block.GetB().GetBlockId() == lastBlock.GetB().GetBlockId() {
+				blocks = blocks[:i]
+				break
+			}
+		}
+
+		blocks = append(blocks, lastBlock)
+		length = int64(lastBlock.GetOffset() + lastBlock.GetB().GetNumBytes())
+	}
+
+	if f.client.topology != nil {
+		for _, block := range blocks {
+			f.client.topology.sortLocations(block)
+		}
+	}
+
+	f.blocks = blocks
+	f.length = length
 	return nil
 }
 
+// refreshBlocks handles a datanode rejecting our credentials, by fetching a
+// new data encryption key or new block tokens, as appropriate. It returns
+// false if the error wasn't caused by expired credentials, or they couldn't be
+// refreshed.
+func (f *FileReader) refreshBlocks(err error) bool {
+	if errors.Is(err, transfer.ErrInvalidEncryptionKey) {
+		f.client.clearDataEncryptionKey()
+		return true
+	} else if errors.Is(err, transfer.ErrInvalidBlockToken) {
+		return f.getBlocks() == nil
+	}
+
+	return false
+}
+
+// withBlockAccess calls fn with the block, and again with a refreshed copy if
+// it fails because the block token or data encryption key have expired.
+// Unlike refreshBlocks, it leaves f.blocks alone, so it's safe to use from
+// several goroutines at once.
+func (f *FileReader) withBlockAccess(block *hdfs.LocatedBlockProto, fn func(*hdfs.LocatedBlockProto) error) error {
+	err := fn(block)
+	for refreshes := 0; err != nil && refreshes < maxBlockAccessRefreshes; refreshes++ {
+		if errors.Is(err, transfer.ErrInvalidEncryptionKey) {
+			f.client.clearDataEncryptionKey()
+		} else if errors.Is(err, transfer.ErrInvalidBlockToken) {
+			refreshed, refreshErr := f.refreshBlockToken(block)
+			if refreshErr != nil {
+				return err
+			}
+
+			block = refreshed
+		} else {
+			return err
+		}
+
+		f.client.observeRetry("read", f.name, err)
+		err = fn(block)
+	}
+
+	return err
+}
+
+// refreshBlockToken fetches a new block token for the block from the
+// namenode, and returns a copy of the block with the new token.
+func (f *FileReader) refreshBlockToken(block *hdfs.LocatedBlockProto) (*hdfs.LocatedBlockProto, error) {
+	req := &hdfs.GetBlockLocationsRequestProto{
+		Src:    proto.String(f.name),
+		Offset: proto.Uint64(block.GetOffset()),
+		Length: proto.Uint64(1),
+	}
+	resp := &hdfs.GetBlockLocationsResponseProto{}
+
+	err := f.client.execute("getBlockLocations", req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := resp.GetLocations().GetBlocks()
+	if last := resp.GetLocations().GetLastBlock(); last != nil {
+		candidates = append(candidates, last)
+	}
+
+	for _, candidate := range candidates {
+		if candidate.GetB().GetBlockId() == block.GetB().GetBlockId() {
+			refreshed := proto.Clone(block).(*hdfs.LocatedBlockProto)
+			refreshed.BlockToken = candidate.GetBlockToken()
+			return refreshed, nil
+		}
+	}
+
+	return nil, errors.New("block no longer exists")
+}
+
+// getVisibleLength returns the number of bytes in a block under construction
+// that have been acknowledged by the write pipeline, by asking the datanodes
+// via ClientDatanodeProtocol.
+//
+// If every datanode reports that it doesn't have the replica yet, the block
+// was only just allocated, so its length is zero. If the datanodes can't be
+// reached, or refuse the request (as they do on secure clusters, since the
+// connection only supports simple authentication), it falls back to the
+// length reported by the namenode, which only includes data up to the last
+// Hsync. Any other failure, like a datanode that stops responding, is
+// returned as an error.
+func (f *FileReader) getVisibleLength(block *hdfs.LocatedBlockProto) (int64, error) {
+	locs := block.GetLocs()
+	if len(locs) == 0 {
+		return int64(block.GetB().GetNumBytes()), nil
+	}
+
+	var failure error
+	replicasNotFound := 0
+	for _, loc := range locs {
+		length, connected, err := f.client.getReplicaVisibleLength(loc.GetId(), block.GetB(), f.deadline)
+		if err == nil {
+			return length, nil
+		}
+
+		var remoteErr Error
+		if errors.As(err, &remoteErr) {
+			if remoteErr.Exception() == replicaNotFoundException {
+				replicasNotFound++
+			}
+		} else if connected {
+			failure = err
+		}
+	}
+
+	if failure != nil {
+		return 0, fmt.Errorf("getting the length of block %d: %w", block.GetB().GetBlockId(), failure)
+	} else if replicasNotFound == len(locs) {
+		return 0, nil
+	}
+
+	return int64(block.GetB().GetNumBytes()), nil
+}
+
+// getReplicaVisibleLength asks a single datanode for the visible length of its
+// replica of a block. It also returns whether it managed to connect to the
+// datanode. If deadline is zero, the call is limited to datanodeIPCTimeout
+// instead.
+func (c *Client) getReplicaVisibleLength(id *hdfs.DatanodeIDProto, block *hdfs.ExtendedBlockProto,
+	deadline time.Time) (int64, bool, error) {
+	conn, err := c.newDatanodeConnection(id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	defer conn.Close()
+	if deadline.IsZero() {
+		deadline = time.Now().Add(datanodeIPCTimeout)
+	}
+
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return 0, true, err
+	}
+
+	req := &hdfs.GetReplicaVisibleLengthRequestProto{Block: block}
+	resp := &hdfs.GetReplicaVisibleLengthResponseProto{}
+	err = conn.Execute("getReplicaVisibleLength", req, resp)
+	if err != nil {
+		return 0, true, err
+	}
+
+	return int64(resp.GetLength()), true, nil
+}
+
 func (f *FileReader) getNewBlockReader() error {
 	off := uint64(f.offset)
 	for _, block := range f.blocks {
@@ -415,24 +864,40 @@ func (f *FileReader) getNewBlockReader() error {
 		end := start + block.GetB().GetNumBytes()
 
 		if start <= off && off < end {
-			dialFunc, err := f.client.wrapDatanodeDial(
-				f.client.options.DatanodeDialFunc,
-				block.GetBlockToken())
+			br, err := f.newBlockReader(block, int64(off-start))
 			if err != nil {
 				return err
 			}
 
-			f.blockReader = &transfer.BlockReader{
-				ClientName:          f.client.namenode.ClientName,
-				Block:               block,
-				Offset:              int64(off - start),
-				UseDatanodeHostname: f.client.options.UseDatanodeHostname,
-				DialFunc:            dialFunc,
-			}
-
-			return f.SetDeadline(f.deadline)
+			f.blockReader = br
+			return nil
 		}
 	}
 
 	return errors.New("invalid offset")
 }
+
+func (f *FileReader) newBlockReader(block *hdfs.LocatedBlockProto, offset int64) (*transfer.BlockReader, error) {
+	dialFunc, err := f.client.wrapDatanodeDial(
+		f.client.options.DatanodeDialFunc,
+		block.GetBlockToken())
+	if err != nil {
+		return nil, err
+	}
+
+	br := &transfer.BlockReader{
+		ClientName:          f.client.namenode.ClientName,
+		Block:               block,
+		Offset:              offset,
+		UseDatanodeHostname: f.client.options.UseDatanodeHostname,
+		DialFunc:            dialFunc,
+		HedgedReads:         f.client.hedgedReads,
+		ConnCache:           f.client.connCache,
+		ShortCircuit:        f.client.shortCircuit,
+		DeadNodes:           f.client.deadNodes,
+		Events:              f.client.transferEvents(f.name, block.GetB().GetBlockId()),
+	}
+
+	br.SetThrottler(f.throttler)
+	return br, br.SetDeadline(f.deadline)
+}
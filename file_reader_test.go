@@ -3,7 +3,9 @@ package hdfs
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"io"
@@ -11,11 +13,17 @@ import (
 	"math/rand"
 	"net"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/colinmarc/hdfs/v2/internal/rpc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
@@ -462,3 +470,353 @@ func TestFileChecksumDeadlineBefore(t *testing.T) {
 	_, err = file.Checksum()
 	assert.NotNil(t, err)
 }
+
+func TestFileReadUnderConstruction(t *testing.T) {
+	client := getClient(t)
+
+	baleet(t, "/_test/underconstruction.txt")
+	writer, err := client.Create("/_test/underconstruction.txt")
+	require.NoError(t, err)
+	defer writer.Close()
+
+	_, err = writer.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Hflush())
+
+	reader, err := client.Open("/_test/underconstruction.txt")
+	require.NoError(t, err)
+
+	bytes, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.EqualValues(t, "foo", string(bytes))
+
+	_, err = writer.Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Hflush())
+
+	require.NoError(t, reader.Refresh())
+	bytes, err = ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.EqualValues(t, "bar", string(bytes))
+}
+
+func TestFileReadAtHedged(t *testing.T) {
+	options := getClient(t).options
+	options.HedgedReadPoolSize = 2
+	options.HedgedReadThreshold = time.Millisecond
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+	defer client.Close()
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	buf := make([]byte, len(testStr))
+	n, err := file.ReadAt(buf, int64(testStrOff))
+	require.NoError(t, err)
+	assert.Equal(t, len(testStr), n)
+	assert.EqualValues(t, testStr, string(buf))
+
+	// ReadAt shouldn't affect the offset for Read.
+	off, err := file.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, off)
+
+	buf = make([]byte, 10)
+	n, err = file.ReadAt(buf, file.Stat().Size()-5)
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, 5, n)
+}
+
+func TestFileReadRanges(t *testing.T) {
+	client := getClient(t)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	ranges := []Range{
+		{Offset: testStr3Off, Length: len(testStr3)},
+		{Offset: testStrOff, Length: len(testStr)},
+		{Offset: testStr2Off, Length: len(testStr2)},
+		{Offset: testStr4Off, Length: len(testStr4)},
+		{Offset: testStr5Off, Length: len(testStr5)},
+		{Offset: 0, Length: 0},
+	}
+
+	bufs, err := file.ReadRanges(ranges)
+	require.NoError(t, err)
+	require.Equal(t, len(ranges), len(bufs))
+	assert.EqualValues(t, testStr3, string(bufs[0]))
+	assert.EqualValues(t, testStr, string(bufs[1]))
+	assert.EqualValues(t, testStr2, string(bufs[2]))
+	assert.EqualValues(t, testStr4, string(bufs[3]))
+	assert.EqualValues(t, testStr5, string(bufs[4]))
+	assert.Empty(t, bufs[5])
+
+	// ReadRanges shouldn't affect the offset for Read.
+	off, err := file.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, off)
+
+	// A range crossing a block boundary should be put back together.
+	file.Seek(0, 0)
+	expected, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+
+	blockSize := int64(file.blocks[0].GetB().GetNumBytes())
+	bufs, err = file.ReadRanges([]Range{{Offset: blockSize - 100, Length: 200}})
+	require.NoError(t, err)
+	assert.Equal(t, expected[blockSize-100:blockSize+100], bufs[0])
+
+	_, err = file.ReadRanges([]Range{{Offset: file.Stat().Size() - 5, Length: 10}})
+	assertPathError(t, err, "readranges", "/_test/mobydick.txt", io.ErrUnexpectedEOF)
+}
+
+func TestPlanRangeReads(t *testing.T) {
+	blocks := []*hdfs.LocatedBlockProto{
+		{Offset: proto.Uint64(0), B: &hdfs.ExtendedBlockProto{NumBytes: proto.Uint64(1024 * 1024)}},
+		{Offset: proto.Uint64(1024 * 1024), B: &hdfs.ExtendedBlockProto{NumBytes: proto.Uint64(1024 * 1024)}},
+	}
+
+	ranges := []Range{
+		{Offset: 10000, Length: 100},
+		{Offset: 100, Length: 100},
+		{Offset: 300, Length: 50},
+		{Offset: 1024*1024 - 10, Length: 20},
+	}
+
+	bufs := make([][]byte, len(ranges))
+	for i, r := range ranges {
+		bufs[i] = make([]byte, r.Length)
+	}
+
+	plan := planRangeReads(blocks, ranges, bufs)
+	require.Equal(t, 2, len(plan))
+
+	// The two close ranges at the start should be merged, but not the one
+	// further along.
+	require.Equal(t, 3, len(plan[0]))
+	assert.EqualValues(t, 100, plan[0][0].offset)
+	assert.EqualValues(t, 250, plan[0][0].length)
+	assert.Equal(t, 2, len(plan[0][0].pieces))
+	assert.EqualValues(t, 10000, plan[0][1].offset)
+	assert.EqualValues(t, 100, plan[0][1].length)
+
+	// The range crossing the block boundary should be split.
+	assert.EqualValues(t, 1024*1024-10, plan[0][2].offset)
+	assert.EqualValues(t, 10, plan[0][2].length)
+	require.Equal(t, 1, len(plan[1]))
+	assert.EqualValues(t, 0, plan[1][0].offset)
+	assert.EqualValues(t, 10, plan[1][0].length)
+}
+
+type memWriterAt struct {
+	buf []byte
+}
+
+func (w *memWriterAt) WriteAt(b []byte, off int64) (int, error) {
+	if end := int(off) + len(b); end > len(w.buf) {
+		w.buf = append(w.buf, make([]byte, end-len(w.buf))...)
+	}
+
+	return copy(w.buf[off:], b), nil
+}
+
+func TestFileParallelCopy(t *testing.T) {
+	client := getClient(t)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	expected, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+
+	file.Seek(0, io.SeekStart)
+	w := &memWriterAt{}
+	n, err := file.ParallelCopy(w, 4, 256*1024)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(expected), n)
+	assert.Equal(t, expected, w.buf)
+
+	off, err := file.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(expected), off)
+}
+
+func TestFileParallelCopyFromOffset(t *testing.T) {
+	client := getClient(t)
+
+	file, err := client.Open("/_test/mobydick.txt")
+	require.NoError(t, err)
+
+	_, err = file.Seek(testStrOff, io.SeekStart)
+	require.NoError(t, err)
+
+	w := &memWriterAt{}
+	n, err := file.ParallelCopy(w, 2, 0)
+	require.NoError(t, err)
+	assert.EqualValues(t, file.Stat().Size()-testStrOff, n)
+	assert.EqualValues(t, testStr, string(w.buf[testStrOff:testStrOff+len(testStr)]))
+	assert.EqualValues(t, testStr3, string(w.buf[testStr3Off:testStr3Off+len(testStr3)]))
+}
+
+func TestFileReadRefreshesBlockToken(t *testing.T) {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	require.NoError(t, err)
+
+	options := ClientOptionsFromConf(conf)
+	if options.KerberosClient != nil || options.DataTransferProtection != "" {
+		t.Skip("the fake datanode doesn't support SASL")
+	}
+
+	options.User = "gohdfs1"
+
+	// The first datanode connection rejects the block token, as if it had
+	// expired.
+	rejected := false
+	options.DatanodeDialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if rejected {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+
+		rejected = true
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			server.Read(make([]byte, 4096))
+
+			msg, _ := proto.Marshal(&hdfs.BlockOpResponseProto{
+				Status:  hdfs.Status_ERROR_ACCESS_TOKEN.Enum(),
+				Message: proto.String("Block token is expired"),
+			})
+			server.Write(append(binary.AppendUvarint(nil, uint64(len(msg))), msg...))
+		}()
+
+		return client, nil
+	}
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+	defer client.Close()
+
+	bytes, err := client.ReadFile("/_test/foo.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, "bar\n", string(bytes))
+	assert.True(t, rejected)
+	assert.Empty(t, client.DeadDatanodes())
+}
+
+func TestFileReadDataTransferCipher(t *testing.T) {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	require.NoError(t, err)
+
+	client := getClient(t)
+	file, err := client.Open("/_test/foo.txt")
+	require.NoError(t, err)
+
+	_, err = ioutil.ReadAll(file)
+	require.NoError(t, err)
+
+	switch {
+	case conf["dfs.encrypt.data.transfer"] != "true":
+		assert.Equal(t, "", client.DataTransferCipher())
+	case strings.Contains(conf["dfs.encrypt.data.transfer.cipher.suites"], "AES/CTR/NoPadding"):
+		assert.Equal(t, "AES/CTR/NoPadding", client.DataTransferCipher())
+	default:
+		assert.NotEqual(t, "AES/CTR/NoPadding", client.DataTransferCipher())
+	}
+}
+
+// visibleLengthTestBlock is a block under construction with two replicas, for
+// which the namenode reports a length of 10.
+func visibleLengthTestBlock() *hdfs.LocatedBlockProto {
+	return &hdfs.LocatedBlockProto{
+		B: &hdfs.ExtendedBlockProto{
+			PoolId:          proto.String("pool"),
+			BlockId:         proto.Uint64(1),
+			GenerationStamp: proto.Uint64(1),
+			NumBytes:        proto.Uint64(10),
+		},
+		Locs: []*hdfs.DatanodeInfoProto{
+			{Id: &hdfs.DatanodeIDProto{IpAddr: proto.String("127.0.0.1"), IpcPort: proto.Uint32(9867)}},
+			{Id: &hdfs.DatanodeIDProto{IpAddr: proto.String("127.0.0.2"), IpcPort: proto.Uint32(9867)}},
+		},
+	}
+}
+
+// visibleLengthTestReader returns a FileReader for a client whose datanode
+// connections are handled by serve.
+func visibleLengthTestReader(serve func(conn net.Conn)) *FileReader {
+	client := &Client{
+		namenode: &rpc.NamenodeConnection{User: "foo"},
+		options: ClientOptions{
+			DatanodeDialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				client, server := net.Pipe()
+				go serve(server)
+				return client, nil
+			},
+		},
+	}
+
+	return &FileReader{client: client, deadline: time.Now().Add(time.Second)}
+}
+
+// respondWithException stands in for a datanode that answers the first RPC
+// call (or, if the call ID is -3, the connection context) with an exception.
+func respondWithException(callID int32, status hadoop.RpcResponseHeaderProto_RpcStatusProto, exception string) func(net.Conn) {
+	return func(conn net.Conn) {
+		defer conn.Close()
+		go io.Copy(io.Discard, conn)
+
+		header, _ := proto.Marshal(&hadoop.RpcResponseHeaderProto{
+			CallId:             proto.Uint32(uint32(callID)),
+			Status:             status.Enum(),
+			ExceptionClassName: proto.String(exception),
+			ErrorMsg:           proto.String("test"),
+		})
+
+		msg := binary.AppendUvarint(nil, uint64(len(header)))
+		msg = append(msg, header...)
+		packet := binary.BigEndian.AppendUint32(nil, uint32(len(msg)))
+		conn.Write(append(packet, msg...))
+	}
+}
+
+func TestGetVisibleLengthUnresponsiveDatanode(t *testing.T) {
+	f := visibleLengthTestReader(func(conn net.Conn) { io.Copy(io.Discard, conn) })
+	f.deadline = time.Now().Add(50 * time.Millisecond)
+
+	_, err := f.getVisibleLength(visibleLengthTestBlock())
+	assert.Error(t, err)
+}
+
+func TestGetVisibleLengthReplicaNotFound(t *testing.T) {
+	f := visibleLengthTestReader(respondWithException(1,
+		hadoop.RpcResponseHeaderProto_ERROR, replicaNotFoundException))
+
+	length, err := f.getVisibleLength(visibleLengthTestBlock())
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, length)
+}
+
+func TestGetVisibleLengthRefused(t *testing.T) {
+	// This is how a datanode that requires kerberos rejects the connection.
+	f := visibleLengthTestReader(respondWithException(-3,
+		hadoop.RpcResponseHeaderProto_FATAL, permissionDeniedException))
+
+	length, err := f.getVisibleLength(visibleLengthTestBlock())
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, length)
+}
+
+func TestGetVisibleLengthUnreachable(t *testing.T) {
+	f := visibleLengthTestReader(nil)
+	f.client.options.DatanodeDialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	length, err := f.getVisibleLength(visibleLengthTestBlock())
+	require.NoError(t, err)
+	assert.EqualValues(t, 10, length)
+}
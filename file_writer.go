@@ -12,6 +12,20 @@ import (
 
 var ErrReplicating = errors.New("replication in progress")
 
+// ErrLeaseRecovery is returned when a file left open by another writer could
+// not be closed in time.
+var ErrLeaseRecovery = errors.New("lease recovery in progress")
+
+const (
+	leaseRecoveryRetries  = 30
+	leaseRecoveryInterval = time.Second
+
+	// addBlockRetries is the number of times addBlock is retried when the
+	// namenode hasn't yet heard from the datanodes about the previous block.
+	addBlockRetries = 5
+	addBlockBackoff = 400 * time.Millisecond
+)
+
 // IsErrReplicating returns true if the passed error is an os.PathError wrapping
 // ErrReplicating.
 func IsErrReplicating(err error) bool {
@@ -31,6 +45,18 @@ type FileWriter struct {
 
 	blockWriter *transfer.BlockWriter
 	deadline    time.Time
+	throttler   *transfer.Throttler
+
+	// persistBlocks is set when a block has been added since the last call to
+	// Hflush or Hsync, so the namenode needs to be told to persist it.
+	persistBlocks bool
+
+	// unackedBlock receives the result for the previous block, which may
+	// still be waiting on acks from the datanodes while the next one is being
+	// written. Once a block fails, blockErr is set, and returned from all
+	// further writes.
+	unackedBlock <-chan error
+	blockErr     error
 }
 
 // Create opens a new file in HDFS with the default replication, block size,
@@ -73,7 +99,7 @@ func (c *Client) CreateFile(name string, replication int, blockSize int64, perm
 	}
 	createResp := &hdfs.CreateResponseProto{}
 
-	err := c.namenode.Execute("create", createReq, createResp)
+	err := c.execute("create", createReq, createResp)
 	if err != nil {
 		return nil, &os.PathError{"create", name, interpretCreateException(err)}
 	}
@@ -84,6 +110,7 @@ func (c *Client) CreateFile(name string, replication int, blockSize int64, perm
 		replication: replication,
 		blockSize:   blockSize,
 		fileId:      createResp.Fs.FileId,
+		throttler:   c.writeThrottler,
 	}, nil
 }
 
@@ -103,7 +130,7 @@ func (c *Client) Append(name string) (*FileWriter, error) {
 	}
 	appendResp := &hdfs.AppendResponseProto{}
 
-	err = c.namenode.Execute("append", appendReq, appendResp)
+	err = c.execute("append", appendReq, appendResp)
 	if err != nil {
 		return nil, &os.PathError{"append", name, interpretException(err)}
 	}
@@ -114,6 +141,7 @@ func (c *Client) Append(name string) (*FileWriter, error) {
 		replication: int(appendResp.Stat.GetBlockReplication()),
 		blockSize:   int64(appendResp.Stat.GetBlocksize()),
 		fileId:      appendResp.Stat.FileId,
+		throttler:   c.writeThrottler,
 	}
 
 	// This returns nil if there are no blocks (it's an empty file) or if the
@@ -138,8 +166,10 @@ func (c *Client) Append(name string) (*FileWriter, error) {
 		Append:              true,
 		UseDatanodeHostname: f.client.options.UseDatanodeHostname,
 		DialFunc:            dialFunc,
+		Events:              f.client.transferEvents(f.name, block.GetB().GetBlockId()),
 	}
 
+	f.blockWriter.SetThrottler(f.throttler)
 	err = f.blockWriter.SetDeadline(f.deadline)
 	if err != nil {
 		return nil, err
@@ -159,6 +189,31 @@ func (c *Client) CreateEmptyFile(name string) error {
 	return f.Close()
 }
 
+// recoverLease asks the namenode to close a file that was left open by
+// another writer, such as a process that crashed partway through an upload.
+// Recovering the last block may take a while, so it polls until the file is
+// closed.
+func (c *Client) recoverLease(name string) error {
+	req := &hdfs.RecoverLeaseRequestProto{
+		Src:        proto.String(name),
+		ClientName: proto.String(c.namenode.ClientName),
+	}
+	resp := &hdfs.RecoverLeaseResponseProto{}
+
+	for i := 0; i < leaseRecoveryRetries; i++ {
+		err := c.execute("recoverLease", req, resp)
+		if err != nil {
+			return &os.PathError{"recoverLease", name, interpretException(err)}
+		} else if resp.GetResult() {
+			return nil
+		}
+
+		time.Sleep(leaseRecoveryInterval)
+	}
+
+	return &os.PathError{"recoverLease", name, ErrLeaseRecovery}
+}
+
 // SetDeadline sets the deadline for future Write, Flush, and Close calls. A
 // zero value for t means those calls will not time out.
 //
@@ -174,11 +229,29 @@ func (f *FileWriter) SetDeadline(t time.Time) error {
 	return nil
 }
 
+// SetBytesPerSecond limits the rate at which the file is written, in place of
+// the limit shared with other files set by ClientOptions.WriteBytesPerSecond.
+// If n is zero or negative, writes to this file aren't limited at all.
+func (f *FileWriter) SetBytesPerSecond(n int64) {
+	f.throttler = nil
+	if n > 0 {
+		f.throttler = transfer.NewThrottler(n)
+	}
+
+	if f.blockWriter != nil {
+		f.blockWriter.SetThrottler(f.throttler)
+	}
+}
+
 // Write implements io.Writer for writing to a file in HDFS. Internally, it
 // writes data to an internal buffer first, and then later out to HDFS. Because
 // of this, it is important that Close is called after all data has been
 // written.
 func (f *FileWriter) Write(b []byte) (int, error) {
+	if err := f.checkUnackedBlock(false); err != nil {
+		return 0, err
+	}
+
 	if f.blockWriter == nil {
 		err := f.startNewBlock()
 		if err != nil {
@@ -213,6 +286,70 @@ func (f *FileWriter) Flush() error {
 	return nil
 }
 
+// Hflush flushes any buffered data out to the datanodes, and waits for them to
+// acknowledge it. Once it returns, the data is visible to new readers, although
+// it may not yet have been written to disk. Like Flush, it is still necessary
+// to call Close once all data has been written.
+func (f *FileWriter) Hflush() error {
+	if err := f.checkUnackedBlock(true); err != nil {
+		return err
+	}
+
+	if f.blockWriter != nil {
+		err := f.blockWriter.Hflush()
+		if err != nil {
+			return err
+		}
+	}
+
+	if f.persistBlocks {
+		return f.fsync(-1)
+	}
+
+	return nil
+}
+
+// Hsync is like Hflush, but additionally waits for the datanodes to write the
+// data to disk, and updates the length of the file on the namenode, so that
+// Stat reflects the data written so far.
+func (f *FileWriter) Hsync() error {
+	if err := f.checkUnackedBlock(true); err != nil {
+		return err
+	}
+
+	if f.blockWriter == nil {
+		return f.fsync(-1)
+	}
+
+	err := f.blockWriter.Hsync()
+	if err != nil {
+		return err
+	}
+
+	return f.fsync(f.blockWriter.Offset)
+}
+
+// fsync asks the namenode to persist the file's block list. If
+// lastBlockLength isn't negative, it also updates the length of the last
+// block.
+func (f *FileWriter) fsync(lastBlockLength int64) error {
+	fsyncReq := &hdfs.FsyncRequestProto{
+		Src:             proto.String(f.name),
+		Client:          proto.String(f.client.namenode.ClientName),
+		LastBlockLength: proto.Int64(lastBlockLength),
+		FileId:          f.fileId,
+	}
+	fsyncResp := &hdfs.FsyncResponseProto{}
+
+	err := f.client.execute("fsync", fsyncReq, fsyncResp)
+	if err != nil {
+		return &os.PathError{"fsync", f.name, interpretException(err)}
+	}
+
+	f.persistBlocks = false
+	return nil
+}
+
 // Close closes the file, writing any remaining data out to disk and waiting
 // for acknowledgements from the datanodes. It is important that Close is called
 // after all data has been written.
@@ -236,6 +373,12 @@ func (f *FileWriter) Close() error {
 		}
 	}
 
+	// Wait for every block to be acknowledged.
+	err := f.checkUnackedBlock(true)
+	if err != nil {
+		return err
+	}
+
 	// retry complete for at most about 2 minutes
 	sleepMs := 400
 	retries := 9
@@ -248,13 +391,14 @@ func (f *FileWriter) Close() error {
 			FileId:     f.fileId,
 		}
 		completeResp := &hdfs.CompleteResponseProto{}
-		err := f.client.namenode.Execute("complete", completeReq, completeResp)
+		err := f.client.execute("complete", completeReq, completeResp)
 		if err != nil {
 			return &os.PathError{"create", f.name, err}
 		} else if completeResp.GetResult() == false {
 			if retries == 0 {
 				return &os.PathError{"create", f.name, ErrReplicating}
 			}
+			f.client.observeRetry("complete", f.name, ErrReplicating)
 			retries -= 1
 			time.Sleep(time.Duration(sleepMs) * time.Millisecond)
 			sleepMs *= 2
@@ -271,8 +415,7 @@ func (f *FileWriter) startNewBlock() error {
 	if f.blockWriter != nil {
 		previous = f.blockWriter.Block.GetB()
 
-		// TODO: We don't actually need to wait for previous blocks to ack before
-		// continuing.
+		// The previous block's acks can drain while we start on the next one.
 		err := f.finalizeBlock()
 		if err != nil {
 			return err
@@ -287,11 +430,26 @@ func (f *FileWriter) startNewBlock() error {
 	}
 	addBlockResp := &hdfs.AddBlockResponseProto{}
 
-	err := f.client.namenode.Execute("addBlock", addBlockReq, addBlockResp)
-	if err != nil {
-		return &os.PathError{"create", f.name, interpretException(err)}
+	// The namenode won't allocate a new block until the one before the
+	// previous one has been reported by the datanodes, which can lag a bit
+	// behind the acks.
+	backoff := addBlockBackoff
+	for retries := addBlockRetries; ; retries-- {
+		err := f.client.execute("addBlock", addBlockReq, addBlockResp)
+		if remoteErr, ok := err.(Error); ok && retries > 0 &&
+			remoteErr.Exception() == notReplicatedYetException {
+			f.client.observeRetry("addBlock", f.name, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		} else if err != nil {
+			return &os.PathError{"create", f.name, interpretException(err)}
+		}
+
+		break
 	}
 
+	f.persistBlocks = true
 	block := addBlockResp.GetBlock()
 	dialFunc, err := f.client.wrapDatanodeDial(
 		f.client.options.DatanodeDialFunc, block.GetBlockToken())
@@ -305,13 +463,25 @@ func (f *FileWriter) startNewBlock() error {
 		BlockSize:           f.blockSize,
 		UseDatanodeHostname: f.client.options.UseDatanodeHostname,
 		DialFunc:            dialFunc,
+		Events:              f.client.transferEvents(f.name, block.GetB().GetBlockId()),
 	}
 
+	f.blockWriter.SetThrottler(f.throttler)
 	return f.blockWriter.SetDeadline(f.deadline)
 }
 
+// finalizeBlock sends the rest of the current block to the datanodes. It
+// doesn't wait for the datanodes to acknowledge it; instead, checkUnackedBlock
+// collects the result later. Only one block is left unacknowledged at a time.
 func (f *FileWriter) finalizeBlock() error {
-	err := f.blockWriter.Close()
+	err := f.checkUnackedBlock(true)
+	if err != nil {
+		return err
+	}
+
+	// If the last packet couldn't even be sent, this returns the error now.
+	f.unackedBlock = f.blockWriter.CloseAsync()
+	err = f.checkUnackedBlock(false)
 	if err != nil {
 		return err
 	}
@@ -325,7 +495,7 @@ func (f *FileWriter) finalizeBlock() error {
 	}
 	updateResp := &hdfs.UpdateBlockForPipelineResponseProto{}
 
-	err = f.client.namenode.Execute("updateBlockForPipeline", updateReq, updateResp)
+	err = f.client.execute("updateBlockForPipeline", updateReq, updateResp)
 	if err != nil {
 		return err
 	}
@@ -333,3 +503,28 @@ func (f *FileWriter) finalizeBlock() error {
 	f.blockWriter = nil
 	return nil
 }
+
+// checkUnackedBlock returns an error if the previous block failed to be
+// acknowledged. If wait is true, it waits for the acks to finish first;
+// otherwise, it only checks whether they already have.
+func (f *FileWriter) checkUnackedBlock(wait bool) error {
+	if f.unackedBlock != nil {
+		var err error
+		if wait {
+			err = <-f.unackedBlock
+		} else {
+			select {
+			case err = <-f.unackedBlock:
+			default:
+				return f.blockErr
+			}
+		}
+
+		f.unackedBlock = nil
+		if err != nil {
+			f.blockErr = err
+		}
+	}
+
+	return f.blockErr
+}
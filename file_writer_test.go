@@ -1,6 +1,7 @@
 package hdfs
 
 import (
+	"bytes"
 	"hash/crc32"
 	"io"
 	"io/ioutil"
@@ -143,6 +144,29 @@ func TestFileBigWriteMultipleBlocks(t *testing.T) {
 	assert.EqualValues(t, 0x199d1ae6, hash.Sum32())
 }
 
+func TestFileBigWriteManyBlocks(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/create")
+	writer, err := client.CreateFile("/_test/create/manyblocks.txt", 1, 1048576, 0755)
+	require.NoError(t, err)
+
+	mobydick, err := ioutil.ReadFile("testdata/mobydick.txt")
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		n, err := writer.Write(mobydick)
+		require.NoError(t, err)
+		assert.EqualValues(t, len(mobydick), n)
+	}
+
+	assertClose(t, writer)
+
+	data, err := client.ReadFile("/_test/create/manyblocks.txt")
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat(mobydick, 4), data)
+}
+
 func TestFileBigWriteWeirdBlockSize(t *testing.T) {
 	client := getClient(t)
 
@@ -531,3 +555,51 @@ func TestFileAppendDeadlineBefore(t *testing.T) {
 	_, err = writer.Write([]byte("foo\n"))
 	assert.Error(t, err)
 }
+
+func TestFileWriteHflush(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/create")
+	baleet(t, "/_test/create/hflush.txt")
+	writer, err := client.Create("/_test/create/hflush.txt")
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Hflush())
+
+	_, err = writer.Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Hflush())
+	assertClose(t, writer)
+
+	bytes, err := client.ReadFile("/_test/create/hflush.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, "foobar", string(bytes))
+}
+
+func TestFileWriteHsync(t *testing.T) {
+	client := getClient(t)
+
+	mkdirp(t, "/_test/create")
+	baleet(t, "/_test/create/hsync.txt")
+	writer, err := client.Create("/_test/create/hsync.txt")
+	require.NoError(t, err)
+
+	_, err = writer.Write([]byte("foo"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Hsync())
+
+	fi, err := client.Stat("/_test/create/hsync.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, fi.Size())
+
+	_, err = writer.Write([]byte("bar"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Hsync())
+	assertClose(t, writer)
+
+	bytes, err := client.ReadFile("/_test/create/hsync.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, "foobar", string(bytes))
+}
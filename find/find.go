@@ -0,0 +1,260 @@
+// Package find implements predicates for matching files and directories in
+// HDFS, modeled after the tests available in find(1). Predicates operate on
+// os.FileInfo values, such as those passed to the WalkFunc by Client.Walk or
+// returned by Client.ReadDir, so they can be combined freely with either:
+//
+//	match := find.All(find.Type('f'), find.Name("*.parquet"))
+//	client.Walk("/data", func(p string, fi os.FileInfo, err error) error {
+//		if err == nil && match(p, fi) {
+//			fmt.Println(p)
+//		}
+//
+//		return err
+//	})
+package find
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var sizeUnits = map[byte]int64{
+	'c': 1,
+	'b': 512,
+	'k': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+}
+
+// A Predicate reports whether the file or directory at the given path matches.
+type Predicate func(p string, info os.FileInfo) bool
+
+// These interfaces are implemented by *hdfs.FileInfo, but not by os.FileInfo
+// in general.
+type ownerInfo interface {
+	Owner() string
+}
+
+type groupInfo interface {
+	OwnerGroup() string
+}
+
+type symlinkInfo interface {
+	IsSymlink() bool
+}
+
+// All returns a Predicate that matches if all of the given predicates match.
+// With no arguments, it matches everything.
+func All(preds ...Predicate) Predicate {
+	return func(p string, info os.FileInfo) bool {
+		for _, pred := range preds {
+			if !pred(p, info) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// Any returns a Predicate that matches if any of the given predicates match.
+// With no arguments, it matches nothing.
+func Any(preds ...Predicate) Predicate {
+	return func(p string, info os.FileInfo) bool {
+		for _, pred := range preds {
+			if pred(p, info) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Not returns a Predicate that negates pred.
+func Not(pred Predicate) Predicate {
+	return func(p string, info os.FileInfo) bool {
+		return !pred(p, info)
+	}
+}
+
+// Name returns a Predicate that matches the base name of the file against a
+// shell glob, using the syntax of path.Match.
+func Name(pattern string) (Predicate, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	return func(p string, info os.FileInfo) bool {
+		match, _ := path.Match(pattern, info.Name())
+		return match
+	}, nil
+}
+
+// IName is like Name, but the match is case-insensitive.
+func IName(pattern string) (Predicate, error) {
+	pattern = strings.ToLower(pattern)
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	return func(p string, info os.FileInfo) bool {
+		match, _ := path.Match(pattern, strings.ToLower(info.Name()))
+		return match
+	}, nil
+}
+
+// Type returns a Predicate that matches on the type of the file: 'f' for
+// regular files, 'd' for directories, and 'l' for symbolic links.
+func Type(t byte) (Predicate, error) {
+	switch t {
+	case 'f':
+		return func(p string, info os.FileInfo) bool {
+			return !info.IsDir() && !isSymlink(info)
+		}, nil
+	case 'd':
+		return func(p string, info os.FileInfo) bool {
+			return info.IsDir()
+		}, nil
+	case 'l':
+		return func(p string, info os.FileInfo) bool {
+			return isSymlink(info)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown file type: %q", t)
+	}
+}
+
+// Size returns a Predicate that compares the size of the file, in the format
+// used by find(1): an optional '+' (greater than) or '-' (less than), a
+// number, and an optional unit. The units are 'c' for bytes, 'k' for KiB, 'M'
+// for MiB, 'G' for GiB, and 'b' (the default) for 512-byte blocks. As with
+// find(1), the size is rounded up to the next unit before comparison, so
+// "-1M" only matches empty files.
+func Size(spec string) (Predicate, error) {
+	cmp, num, err := parseComparison(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid size: %q", spec)
+	}
+
+	unit := int64(512)
+	if len(num) > 0 {
+		if u, ok := sizeUnits[num[len(num)-1]]; ok {
+			unit = u
+			num = num[:len(num)-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid size: %q", spec)
+	}
+
+	return func(p string, info os.FileInfo) bool {
+		size := (info.Size() + unit - 1) / unit
+		return compare(cmp, size, n)
+	}, nil
+}
+
+// Mtime returns a Predicate that compares the number of whole days since the
+// file was last modified, relative to now. The spec is an optional '+' or '-'
+// followed by a number of days, like the -mtime test in find(1).
+func Mtime(spec string, now time.Time) (Predicate, error) {
+	cmp, num, err := parseComparison(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mtime: %q", spec)
+	}
+
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid mtime: %q", spec)
+	}
+
+	return func(p string, info os.FileInfo) bool {
+		days := int64(now.Sub(info.ModTime()) / (24 * time.Hour))
+		return compare(cmp, days, n)
+	}, nil
+}
+
+// User returns a Predicate that matches files owned by the given user.
+func User(name string) Predicate {
+	return func(p string, info os.FileInfo) bool {
+		oi, ok := info.(ownerInfo)
+		return ok && oi.Owner() == name
+	}
+}
+
+// Group returns a Predicate that matches files owned by the given group.
+func Group(name string) Predicate {
+	return func(p string, info os.FileInfo) bool {
+		gi, ok := info.(groupInfo)
+		return ok && gi.OwnerGroup() == name
+	}
+}
+
+// Perm returns a Predicate that compares the permission bits of the file
+// against an octal mode. As with find(1), a plain mode matches the bits
+// exactly, a mode prefixed with '-' matches if all of the bits are set, and
+// a mode prefixed with '/' matches if any of the bits are set.
+func Perm(spec string) (Predicate, error) {
+	var prefix byte
+	num := spec
+	if len(spec) > 0 && (spec[0] == '-' || spec[0] == '/') {
+		prefix = spec[0]
+		num = spec[1:]
+	}
+
+	mode, err := strconv.ParseUint(num, 8, 32)
+	if err != nil || mode > 07777 {
+		return nil, fmt.Errorf("invalid mode: %q", spec)
+	}
+
+	return func(p string, info os.FileInfo) bool {
+		perm := uint64(info.Mode()) & 07777
+		switch prefix {
+		case '-':
+			return perm&mode == mode
+		case '/':
+			return mode == 0 || perm&mode != 0
+		default:
+			return perm == mode
+		}
+	}, nil
+}
+
+func isSymlink(info os.FileInfo) bool {
+	if si, ok := info.(symlinkInfo); ok {
+		return si.IsSymlink()
+	}
+
+	return info.Mode()&os.ModeSymlink != 0
+}
+
+func parseComparison(spec string) (byte, string, error) {
+	if spec == "" {
+		return 0, "", errors.New("empty")
+	}
+
+	switch spec[0] {
+	case '+', '-':
+		return spec[0], spec[1:], nil
+	default:
+		return 0, spec, nil
+	}
+}
+
+func compare(cmp byte, a, b int64) bool {
+	switch cmp {
+	case '+':
+		return a > b
+	case '-':
+		return a < b
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,147 @@
+package find
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2020, 6, 15, 12, 0, 0, 0, time.UTC)
+
+type testFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	owner   string
+	group   string
+	symlink bool
+}
+
+func (fi testFileInfo) Name() string       { return fi.name }
+func (fi testFileInfo) Size() int64        { return fi.size }
+func (fi testFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi testFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi testFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi testFileInfo) Sys() interface{}   { return nil }
+func (fi testFileInfo) Owner() string      { return fi.owner }
+func (fi testFileInfo) OwnerGroup() string { return fi.group }
+func (fi testFileInfo) IsSymlink() bool    { return fi.symlink }
+
+var (
+	file    = testFileInfo{name: "Foo.txt", size: 1500, mode: 0644, modTime: now.Add(-36 * time.Hour), owner: "alice", group: "staff"}
+	empty   = testFileInfo{name: "empty", size: 0, mode: 0600, modTime: now, owner: "bob", group: "staff"}
+	dir     = testFileInfo{name: "dir", mode: os.ModeDir | 01777, modTime: now.Add(-10 * 24 * time.Hour), owner: "alice", group: "wheel"}
+	symlink = testFileInfo{name: "link", mode: 0777, modTime: now, owner: "bob", group: "wheel", symlink: true}
+)
+
+func matches(t *testing.T, pred Predicate, err error) []string {
+	require.NoError(t, err)
+
+	var res []string
+	for _, fi := range []os.FileInfo{file, empty, dir, symlink} {
+		if pred("/_test/"+fi.Name(), fi) {
+			res = append(res, fi.Name())
+		}
+	}
+
+	return res
+}
+
+func TestName(t *testing.T) {
+	pred, err := Name("*.txt")
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, pred, err))
+
+	pred, err = Name("foo*")
+	assert.Empty(t, matches(t, pred, err))
+
+	_, err = Name("[")
+	assert.Error(t, err)
+}
+
+func TestIName(t *testing.T) {
+	pred, err := IName("FOO*")
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, pred, err))
+}
+
+func TestType(t *testing.T) {
+	pred, err := Type('f')
+	assert.Equal(t, []string{"Foo.txt", "empty"}, matches(t, pred, err))
+
+	pred, err = Type('d')
+	assert.Equal(t, []string{"dir"}, matches(t, pred, err))
+
+	pred, err = Type('l')
+	assert.Equal(t, []string{"link"}, matches(t, pred, err))
+
+	_, err = Type('x')
+	assert.Error(t, err)
+}
+
+func TestSize(t *testing.T) {
+	pred, err := Size("+1k")
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, pred, err))
+
+	pred, err = Size("1500c")
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, pred, err))
+
+	// Rounded up to 3 blocks of 512 bytes.
+	pred, err = Size("3")
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, pred, err))
+
+	pred, err = Size("-1M")
+	assert.Equal(t, []string{"empty", "dir", "link"}, matches(t, pred, err))
+
+	for _, spec := range []string{"", "+", "1x", "--1"} {
+		_, err = Size(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestMtime(t *testing.T) {
+	pred, err := Mtime("1", now)
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, pred, err))
+
+	pred, err = Mtime("-1", now)
+	assert.Equal(t, []string{"empty", "link"}, matches(t, pred, err))
+
+	pred, err = Mtime("+7", now)
+	assert.Equal(t, []string{"dir"}, matches(t, pred, err))
+
+	_, err = Mtime("yesterday", now)
+	assert.Error(t, err)
+}
+
+func TestUserAndGroup(t *testing.T) {
+	assert.Equal(t, []string{"Foo.txt", "dir"}, matches(t, User("alice"), nil))
+	assert.Equal(t, []string{"dir", "link"}, matches(t, Group("wheel"), nil))
+}
+
+func TestPerm(t *testing.T) {
+	pred, err := Perm("644")
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, pred, err))
+
+	pred, err = Perm("-600")
+	assert.Equal(t, []string{"Foo.txt", "empty", "dir", "link"}, matches(t, pred, err))
+
+	pred, err = Perm("-1000")
+	assert.Equal(t, []string{"dir"}, matches(t, pred, err))
+
+	pred, err = Perm("/022")
+	assert.Equal(t, []string{"dir", "link"}, matches(t, pred, err))
+
+	_, err = Perm("rwx")
+	assert.Error(t, err)
+}
+
+func TestCombinators(t *testing.T) {
+	typeFile, _ := Type('f')
+	assert.Equal(t, []string{"Foo.txt"}, matches(t, All(typeFile, User("alice")), nil))
+	assert.Equal(t, []string{"Foo.txt", "empty", "dir"}, matches(t, Any(typeFile, User("alice")), nil))
+	assert.Equal(t, []string{"dir", "link"}, matches(t, Not(typeFile), nil))
+	assert.Len(t, matches(t, All(), nil), 4)
+	assert.Empty(t, matches(t, Any(), nil))
+}
@@ -0,0 +1,43 @@
+package rpc
+
+import (
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	"google.golang.org/protobuf/proto"
+)
+
+// CallInfo holds optional information that is sent in the header of an RPC
+// call, but isn't part of the request itself.
+type CallInfo struct {
+	// CallerContext describes the caller, and is recorded in the namenode's
+	// audit log if hadoop.caller.context.enabled is set. If it's empty, no
+	// caller context is sent.
+	CallerContext string
+	// CallerContextSignature optionally signs the caller context.
+	CallerContextSignature []byte
+	// TraceID and ParentID identify the trace span the call is part of. If
+	// both are zero, no trace information is sent.
+	TraceID  int64
+	ParentID int64
+}
+
+// apply sets the caller context and trace information in an RPC request
+// header. It's safe to call on a nil CallInfo.
+func (info *CallInfo) apply(rrh *hadoop.RpcRequestHeaderProto) {
+	if info == nil {
+		return
+	}
+
+	if info.CallerContext != "" {
+		rrh.CallerContext = &hadoop.RPCCallerContextProto{
+			Context:   proto.String(info.CallerContext),
+			Signature: info.CallerContextSignature,
+		}
+	}
+
+	if info.TraceID != 0 || info.ParentID != 0 {
+		rrh.TraceInfo = &hadoop.RPCTraceInfoProto{
+			TraceId:  proto.Int64(info.TraceID),
+			ParentId: proto.Int64(info.ParentID),
+		}
+	}
+}
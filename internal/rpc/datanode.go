@@ -0,0 +1,132 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DatanodeConnection represents an open connection to the IPC port of a
+// datanode, which serves ClientDatanodeProtocol calls. Unlike
+// NamenodeConnection, it talks to a single host, and doesn't fail over or
+// retry.
+//
+// Only simple authentication is currently supported; on clusters which
+// require kerberos or block token authentication for the datanode IPC port,
+// calls will fail.
+type DatanodeConnection struct {
+	ClientID []byte
+	User     string
+	RealUser string
+
+	currentRequestID int32
+
+	conn      net.Conn
+	transport transport
+	reqLock   sync.Mutex
+}
+
+// DatanodeConnectionOptions represents the configurable options available
+// for a DatanodeConnection.
+type DatanodeConnectionOptions struct {
+	// Address specifies the IPC address of the datanode to connect to.
+	Address string
+	// User specifies which HDFS user the client will act as.
+	User string
+	// RealUser, if set, specifies the user that User is a proxy for.
+	RealUser string
+	// DialFunc is used to connect to the datanode. If nil, then
+	// (&net.Dialer{}).DialContext is used.
+	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// NewDatanodeConnection creates a new connection to a datanode with the given
+// options and performs an initial handshake.
+func NewDatanodeConnection(options DatanodeConnectionOptions) (*DatanodeConnection, error) {
+	if options.User == "" {
+		return nil, errors.New("user not specified")
+	}
+
+	dialFunc := options.DialFunc
+	if dialFunc == nil {
+		dialFunc = (&net.Dialer{}).DialContext
+	}
+
+	conn, err := dialFunc(context.Background(), "tcp", options.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := newClientID()
+	c := &DatanodeConnection{
+		ClientID:  clientID,
+		User:      options.User,
+		RealUser:  options.RealUser,
+		conn:      conn,
+		transport: &basicTransport{clientID: clientID, protocol: datanodeProtocolClass},
+	}
+
+	err = c.doDatanodeHandshake()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// SetDeadline sets the deadline for future Execute calls. A zero value for t
+// means Execute will not time out.
+func (c *DatanodeConnection) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// Execute performs an rpc call. It does this by sending req over the wire and
+// unmarshaling the result into resp.
+func (c *DatanodeConnection) Execute(method string, req proto.Message, resp proto.Message) error {
+	c.reqLock.Lock()
+	defer c.reqLock.Unlock()
+
+	c.currentRequestID++
+	requestID := c.currentRequestID
+
+	err := c.transport.writeRequest(c.conn, method, requestID, req, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.transport.readResponse(c.conn, method, requestID, resp)
+}
+
+// doDatanodeHandshake is like doNamenodeHandshake, but always uses simple
+// authentication.
+func (c *DatanodeConnection) doDatanodeHandshake() error {
+	rpcHeader := []byte{
+		0x68, 0x72, 0x70, 0x63, // "hrpc"
+		rpcVersion, serviceClass, noneAuthProtocol,
+	}
+
+	_, err := c.conn.Write(rpcHeader)
+	if err != nil {
+		return err
+	}
+
+	rrh := newRPCRequestHeader(handshakeCallID, c.ClientID)
+	cc := newConnectionContext(c.User, c.RealUser, "", datanodeProtocolClass)
+	packet, err := makeRPCPacket(rrh, cc)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.Write(packet)
+	return err
+}
+
+// Close terminates the underlying socket connection.
+func (c *DatanodeConnection) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestDatanodeConnection(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	go func() {
+		header := make([]byte, 7)
+		_, err := io.ReadFull(server, header)
+		require.NoError(t, err)
+		assert.EqualValues(t, "hrpc", string(header[:4]))
+		assert.EqualValues(t, noneAuthProtocol, header[6])
+
+		rrh := &hadoop.RpcRequestHeaderProto{}
+		cc := &hadoop.IpcConnectionContextProto{}
+		require.NoError(t, readRPCPacket(server, rrh, cc))
+		assert.EqualValues(t, datanodeProtocolClass, cc.GetProtocol())
+		assert.EqualValues(t, "foo", cc.GetUserInfo().GetEffectiveUser())
+
+		rh := &hadoop.RequestHeaderProto{}
+		req := &hdfs.GetReplicaVisibleLengthRequestProto{}
+		require.NoError(t, readRPCPacket(server, rrh, rh, req))
+		assert.EqualValues(t, datanodeProtocolClass, rh.GetDeclaringClassProtocolName())
+		assert.EqualValues(t, "getReplicaVisibleLength", rh.GetMethodName())
+		assert.EqualValues(t, 7, req.GetBlock().GetBlockId())
+
+		packet, err := makeRPCPacket(
+			&hadoop.RpcResponseHeaderProto{
+				CallId: proto.Uint32(uint32(rrh.GetCallId())),
+				Status: hadoop.RpcResponseHeaderProto_SUCCESS.Enum(),
+			},
+			&hdfs.GetReplicaVisibleLengthResponseProto{Length: proto.Uint64(42)})
+		require.NoError(t, err)
+
+		_, err = server.Write(packet)
+		require.NoError(t, err)
+	}()
+
+	conn, err := NewDatanodeConnection(DatanodeConnectionOptions{
+		Address: "dn:9867",
+		User:    "foo",
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return client, nil
+		},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &hdfs.GetReplicaVisibleLengthRequestProto{
+		Block: &hdfs.ExtendedBlockProto{
+			PoolId:          proto.String("pool"),
+			BlockId:         proto.Uint64(7),
+			GenerationStamp: proto.Uint64(1),
+		},
+	}
+	resp := &hdfs.GetReplicaVisibleLengthResponseProto{}
+	err = conn.Execute("getReplicaVisibleLength", req, resp)
+	require.NoError(t, err)
+	assert.EqualValues(t, 42, resp.GetLength())
+}
@@ -5,18 +5,29 @@ import (
 	"fmt"
 	"net"
 	"regexp"
-	"sort"
 
 	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
-	"github.com/colinmarc/hdfs/v2/internal/sasl"
-	"github.com/jcmturner/gokrb5/v8/gssapi"
-	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
 	"github.com/jcmturner/gokrb5/v8/spnego"
 	krbtypes "github.com/jcmturner/gokrb5/v8/types"
 )
 
 const saslRpcCallId = -33
 
+// The RPC protection levels, as in hadoop.rpc.protection.
+const (
+	RPCProtectionAuthentication = "authentication"
+	RPCProtectionIntegrity      = "integrity"
+	RPCProtectionPrivacy        = "privacy"
+)
+
+// rpcProtectionLayers maps each protection level to the corresponding GSSAPI
+// security layer, from RFC 4752.
+var rpcProtectionLayers = map[string]byte{
+	RPCProtectionAuthentication: 0x01,
+	RPCProtectionIntegrity:      0x02,
+	RPCProtectionPrivacy:        0x04,
+}
+
 var (
 	errKerberosNotSupported = errors.New("kerberos authentication not supported by namenode")
 	krbSPNHost              = regexp.MustCompile(`\A[^/]+/(_HOST)([@/]|\z)`)
@@ -36,14 +47,10 @@ func (c *NamenodeConnection) doKerberosHandshake() error {
 		return err
 	}
 
-	var krbAuth, tokenAuth *hadoop.RpcSaslProto_SaslAuth
+	var krbAuth *hadoop.RpcSaslProto_SaslAuth
 	for _, m := range resp.GetAuths() {
-		switch *m.Method {
-		case "KERBEROS":
+		if m.GetMethod() == "KERBEROS" {
 			krbAuth = m
-		case "TOKEN":
-			tokenAuth = m
-		default:
 		}
 	}
 
@@ -57,34 +64,6 @@ func (c *NamenodeConnection) doKerberosHandshake() error {
 		return err
 	}
 
-	if tokenAuth != nil {
-		challenge, err := sasl.ParseChallenge(tokenAuth.Challenge)
-		if err != nil {
-			return err
-		}
-
-		// Some versions of HDP 3.x expect us to pick the highest Qop, and
-		// return a malformed response otherwise.
-		sort.Sort(challenge.Qop)
-		qop := challenge.Qop[0]
-
-		switch qop {
-		case sasl.QopPrivacy, sasl.QopIntegrity:
-			// Switch to SASL RPC handler
-			c.transport = &saslTransport{
-				basicTransport: basicTransport{
-					clientID: c.ClientID,
-				},
-				sessionKey: sessionKey,
-				privacy:    qop == sasl.QopPrivacy,
-			}
-		case sasl.QopAuthentication:
-			// No special transport is required.
-		default:
-			return errors.New("unexpected QOP in challenge")
-		}
-	}
-
 	err = c.writeSaslRequest(&hadoop.RpcSaslProto{
 		State: hadoop.RpcSaslProto_INITIATE.Enum(),
 		Token: token.MechTokenBytes,
@@ -94,39 +73,36 @@ func (c *NamenodeConnection) doKerberosHandshake() error {
 		return err
 	}
 
-	// In response, we get a server token to verify.
+	// In response, we get a server token to verify. Its payload is the
+	// security layers (that is, the QOPs) the namenode supports, followed by
+	// the maximum message size.
 	resp, err = c.readSaslResponse(hadoop.RpcSaslProto_CHALLENGE)
 	if err != nil {
 		return err
 	}
 
-	var nnToken gssapi.WrapToken
-	err = nnToken.Unmarshal(resp.GetToken(), true)
-	if err != nil {
-		return err
-	}
-
-	_, err = nnToken.Verify(sessionKey, keyusage.GSSAPI_ACCEPTOR_SEAL)
+	gss := newGSSContext(sessionKey)
+	payload, err := gss.unwrap(resp.GetToken(), false)
 	if err != nil {
 		return fmt.Errorf("invalid server token: %s", err)
+	} else if len(payload) != 4 {
+		return errors.New("invalid server token: unexpected payload")
 	}
 
-	// Sign the payload and send it back to the namenode.
-	// TODO: Make sure we can support what is required based on what's in the
-	// payload.
-	signed, err := gssapi.NewInitiatorWrapToken(nnToken.Payload, sessionKey)
+	protection, err := chooseRPCProtection(payload[0], c.rpcProtection)
 	if err != nil {
 		return err
 	}
 
-	signedBytes, err := signed.Marshal()
+	// Send back our choice, signed, with the same maximum message size.
+	signed, err := gss.wrap([]byte{rpcProtectionLayers[protection], payload[1], payload[2], payload[3]}, false)
 	if err != nil {
 		return err
 	}
 
 	err = c.writeSaslRequest(&hadoop.RpcSaslProto{
 		State: hadoop.RpcSaslProto_RESPONSE.Enum(),
-		Token: signedBytes,
+		Token: signed,
 	})
 	if err != nil {
 		return err
@@ -134,7 +110,50 @@ func (c *NamenodeConnection) doKerberosHandshake() error {
 
 	// Read the final response. If it's a SUCCESS, then we're done here.
 	_, err = c.readSaslResponse(hadoop.RpcSaslProto_SUCCESS)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// Switch to the SASL RPC handler if we need to sign or encrypt every
+	// message from now on.
+	if protection != RPCProtectionAuthentication {
+		c.transport = &saslTransport{
+			basicTransport: basicTransport{
+				clientID: c.ClientID,
+				protocol: protocolClass,
+			},
+			gss:     gss,
+			privacy: protection == RPCProtectionPrivacy,
+		}
+	}
+
+	c.protection = protection
+	return nil
+}
+
+// chooseRPCProtection picks the first of the preferred protection levels that
+// the namenode supports, given the bitmask of security layers it offered. If
+// there are no preferences, the strongest level is picked.
+func chooseRPCProtection(supported byte, preferred []string) (string, error) {
+	if len(preferred) == 0 {
+		preferred = []string{RPCProtectionPrivacy, RPCProtectionIntegrity, RPCProtectionAuthentication}
+	}
+
+	for _, p := range preferred {
+		if supported&rpcProtectionLayers[p] != 0 {
+			return p, nil
+		}
+	}
+
+	var offered []string
+	for _, p := range []string{RPCProtectionAuthentication, RPCProtectionIntegrity, RPCProtectionPrivacy} {
+		if supported&rpcProtectionLayers[p] != 0 {
+			offered = append(offered, p)
+		}
+	}
+
+	return "", fmt.Errorf("no acceptable RPC protection: namenode offered %v, but we require one of %v",
+		offered, preferred)
 }
 
 func (c *NamenodeConnection) writeSaslRequest(req *hadoop.RpcSaslProto) error {
@@ -176,6 +195,14 @@ func (c *NamenodeConnection) getKerberosTicket() (spnego.NegTokenInit, krbtypes.
 	host, _, _ := net.SplitHostPort(c.host.address)
 	spn := replaceSPNHostWildcard(c.kerberosServicePrincipleName, host)
 
+	// We may be reconnecting long after the client first logged in. A client
+	// with a keytab or password renews its TGT in the background, but make
+	// sure it's still valid anyway; AffirmLogin logs in again if it isn't.
+	err := c.kerberosClient.AffirmLogin()
+	if err != nil {
+		return spnego.NegTokenInit{}, krbtypes.EncryptionKey{}, err
+	}
+
 	ticket, key, err := c.kerberosClient.GetServiceTicket(spn)
 	if err != nil {
 		return spnego.NegTokenInit{}, key, err
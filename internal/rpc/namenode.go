@@ -20,6 +20,7 @@ const (
 	noneAuthProtocol      byte = 0x0
 	saslAuthProtocol      byte = 0xdf
 	protocolClass              = "org.apache.hadoop.hdfs.protocol.ClientProtocol"
+	datanodeProtocolClass      = "org.apache.hadoop.hdfs.protocol.ClientDatanodeProtocol"
 	protocolClassVersion       = 1
 	handshakeCallID            = -3
 	standbyExceptionClass      = "org.apache.hadoop.ipc.StandbyException"
@@ -35,13 +36,20 @@ type NamenodeConnection struct {
 	ClientID   []byte
 	ClientName string
 	User       string
-
+	// RealUser is the user that authenticated with the namenode, if that's
+	// different from User (that is, if User is a proxy user).
+	RealUser string
 	currentRequestID int32
 
 	kerberosClient               *krb.Client
 	kerberosServicePrincipleName string
 	kerberosRealm                string
+	rpcProtection                []string
+	// protection is the protection level negotiated for the current
+	// connection.
+	protection string
 
+	events    *Events
 	dialFunc  func(ctx context.Context, network, addr string) (net.Conn, error)
 	conn      net.Conn
 	host      *namenodeHost
@@ -75,6 +83,33 @@ type NamenodeConnectionOptions struct {
 	// setup (for example: 'nn/_HOST@EXAMPLE.COM'). It is required if
 	// KerberosClient is provided.
 	KerberosServicePrincipleName string
+	// ProxyUser, if set, specifies a user to impersonate. The client
+	// authenticates as User (or the kerberos principal), but acts as
+	// ProxyUser, like a proxy user created with
+	// UserGroupInformation.createProxyUser in Hadoop. The real user must be
+	// allowed to impersonate others by the hadoop.proxyuser.* properties on
+	// the namenode.
+	ProxyUser string
+	// RPCProtection lists the acceptable protection levels for kerberos
+	// connections, like hadoop.rpc.protection, in order of preference. If
+	// empty, the strongest level the namenode supports is used.
+	RPCProtection []string
+	// Events, if set, is notified of every call and failover, so that the
+	// caller can collect metrics.
+	Events *Events
+}
+
+// Events holds optional callbacks that a NamenodeConnection calls, so that
+// the caller can collect metrics. Either of them may be nil. They are called
+// while the connection is locked, so they must not use it.
+type Events struct {
+	// Call is called once each call finishes, with the address of the
+	// namenode it was sent to and the time it took, including any time spent
+	// connecting.
+	Call func(method, address string, d time.Duration, err error)
+	// Failover is called when the connection to one namenode fails, and
+	// another one is connected to instead.
+	Failover func(from, to string, err error)
 }
 
 type namenodeHost struct {
@@ -102,6 +137,18 @@ func NewNamenodeConnection(options NamenodeConnectionOptions) (*NamenodeConnecti
 		return nil, errors.New("user not specified")
 	}
 
+	for _, p := range options.RPCProtection {
+		if _, ok := rpcProtectionLayers[p]; !ok {
+			return nil, fmt.Errorf("invalid RPC protection: %s", p)
+		}
+	}
+
+	var realUser string
+	if options.ProxyUser != "" {
+		realUser = user
+		user = options.ProxyUser
+	}
+
 	// The ClientID is reused here both in the RPC headers (which requires a
 	// "globally unique" ID) and as the "client name" in various requests.
 	clientId := newClientID()
@@ -109,14 +156,17 @@ func NewNamenodeConnection(options NamenodeConnectionOptions) (*NamenodeConnecti
 		ClientID:   clientId,
 		ClientName: "go-hdfs-" + string(clientId),
 		User:       user,
+		RealUser:   realUser,
 
 		kerberosClient:               options.KerberosClient,
 		kerberosServicePrincipleName: options.KerberosServicePrincipleName,
 		kerberosRealm:                realm,
+		rpcProtection:                options.RPCProtection,
 
+		events:    options.Events,
 		dialFunc:  options.DialFunc,
 		hostList:  hostList,
-		transport: &basicTransport{clientID: clientId},
+		transport: &basicTransport{clientID: clientId, protocol: protocolClass},
 
 		done: make(chan struct{}),
 	}
@@ -138,8 +188,9 @@ func (c *NamenodeConnection) resolveConnection() error {
 	}
 
 	var err error
-	if c.host != nil {
-		err = c.host.lastError
+	previous := c.host
+	if previous != nil {
+		err = previous.lastError
 	}
 
 	for _, host := range c.hostList {
@@ -171,6 +222,11 @@ func (c *NamenodeConnection) resolveConnection() error {
 		return fmt.Errorf("no available namenodes: %s", err)
 	}
 
+	if previous != nil && previous != c.host && previous.lastError != nil &&
+		c.events != nil && c.events.Failover != nil {
+		c.events.Failover(previous.address, c.host.address, previous.lastError)
+	}
+
 	return nil
 }
 
@@ -183,12 +239,40 @@ func (c *NamenodeConnection) markFailure(err error) {
 	c.host.lastErrorAt = time.Now()
 }
 
+// resetConnection closes the current connection without marking the namenode
+// as failed, so that the next request reconnects to it.
+func (c *NamenodeConnection) resetConnection() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
 // Execute performs an rpc call. It does this by sending req over the wire and
 // unmarshaling the result into resp.
 func (c *NamenodeConnection) Execute(method string, req proto.Message, resp proto.Message) error {
+	return c.ExecuteWithInfo(method, req, resp, nil)
+}
+
+// ExecuteWithInfo performs an rpc call like Execute, and additionally sends
+// the caller context and trace information in info, if it's non-nil, along
+// with the request.
+func (c *NamenodeConnection) ExecuteWithInfo(method string, req proto.Message, resp proto.Message, info *CallInfo) (err error) {
 	c.reqLock.Lock()
 	defer c.reqLock.Unlock()
 
+	if c.events != nil && c.events.Call != nil {
+		start := time.Now()
+		defer func() {
+			var address string
+			if c.host != nil {
+				address = c.host.address
+			}
+
+			c.events.Call(method, address, time.Since(start), err)
+		}()
+	}
+
 	c.currentRequestID++
 	requestID := c.currentRequestID
 
@@ -198,7 +282,7 @@ func (c *NamenodeConnection) Execute(method string, req proto.Message, resp prot
 			return err
 		}
 
-		err = c.transport.writeRequest(c.conn, method, requestID, req)
+		err = c.transport.writeRequest(c.conn, method, requestID, req, info)
 		if err != nil {
 			c.markFailure(err)
 			continue
@@ -207,9 +291,16 @@ func (c *NamenodeConnection) Execute(method string, req proto.Message, resp prot
 		err = c.transport.readResponse(c.conn, method, requestID, resp)
 		if err != nil {
 			// Only retry on a standby exception.
-			if nerr, ok := err.(*NamenodeError); ok && nerr.exception == standbyExceptionClass {
+			nerr, ok := err.(*NamenodeError)
+			if ok && nerr.exception == standbyExceptionClass {
 				c.markFailure(err)
 				continue
+			} else if !ok {
+				// The connection is broken (for example, the namenode may have
+				// closed it for being idle). The request may have been
+				// processed, so it's not safe to retry, but the next request
+				// should reconnect and re-authenticate.
+				c.resetConnection()
 			}
 
 			return err
@@ -243,6 +334,10 @@ func (c *NamenodeConnection) Execute(method string, req proto.Message, resp prot
 // |  varint length + IpcConnectionContextProto                |
 // +-----------------------------------------------------------+
 func (c *NamenodeConnection) doNamenodeHandshake() error {
+	// Any protection negotiated for a previous connection doesn't apply.
+	c.transport = &basicTransport{clientID: c.ClientID, protocol: protocolClass}
+	c.protection = ""
+
 	authProtocol := noneAuthProtocol
 	kerberos := false
 	if c.kerberosClient != nil {
@@ -268,16 +363,35 @@ func (c *NamenodeConnection) doNamenodeHandshake() error {
 	}
 
 	rrh := newRPCRequestHeader(handshakeCallID, c.ClientID)
-	cc := newConnectionContext(c.User, c.kerberosRealm)
+	cc := newConnectionContext(c.User, c.RealUser, c.kerberosRealm, protocolClass)
 	packet, err := makeRPCPacket(rrh, cc)
 	if err != nil {
 		return err
 	}
 
+	// If we negotiated integrity or privacy, that applies to the connection
+	// context as well.
+	if t, ok := c.transport.(*saslTransport); ok {
+		packet, err = t.wrapPacket(packet)
+		if err != nil {
+			return err
+		}
+	}
+
 	_, err = c.conn.Write(packet)
 	return err
 }
 
+// RPCProtection returns the protection level negotiated with the namenode: one
+// of RPCProtectionAuthentication, RPCProtectionIntegrity or
+// RPCProtectionPrivacy. It's empty if kerberos isn't in use.
+func (c *NamenodeConnection) RPCProtection() string {
+	c.reqLock.Lock()
+	defer c.reqLock.Unlock()
+
+	return c.protection
+}
+
 // renewLeases periodically renews all leases for the connection.
 func (c *NamenodeConnection) renewLeases() {
 	ticker := time.NewTicker(leaseRenewInterval)
@@ -321,23 +435,35 @@ func newRPCRequestHeader(id int32, clientID []byte) *hadoop.RpcRequestHeaderProt
 	}
 }
 
-func newRequestHeader(methodName string) *hadoop.RequestHeaderProto {
+func newRequestHeader(protocol, methodName string) *hadoop.RequestHeaderProto {
 	return &hadoop.RequestHeaderProto{
 		MethodName:                 proto.String(methodName),
-		DeclaringClassProtocolName: proto.String(protocolClass),
+		DeclaringClassProtocolName: proto.String(protocol),
 		ClientProtocolVersion:      proto.Uint64(uint64(protocolClassVersion)),
 	}
 }
 
-func newConnectionContext(user, kerberosRealm string) *hadoop.IpcConnectionContextProto {
-	if kerberosRealm != "" {
-		user = user + "@" + kerberosRealm
+func newConnectionContext(user, realUser, kerberosRealm, protocol string) *hadoop.IpcConnectionContextProto {
+	userInfo := &hadoop.UserInformationProto{}
+	if realUser != "" {
+		// The effective user is just a name, and only the real user, which
+		// actually authenticated, is qualified with the realm.
+		if kerberosRealm != "" {
+			realUser = realUser + "@" + kerberosRealm
+		}
+
+		userInfo.EffectiveUser = proto.String(user)
+		userInfo.RealUser = proto.String(realUser)
+	} else {
+		if kerberosRealm != "" {
+			user = user + "@" + kerberosRealm
+		}
+
+		userInfo.EffectiveUser = proto.String(user)
 	}
 
 	return &hadoop.IpcConnectionContextProto{
-		UserInfo: &hadoop.UserInformationProto{
-			EffectiveUser: proto.String(user),
-		},
-		Protocol: proto.String(protocolClass),
+		UserInfo: userInfo,
+		Protocol: proto.String(protocol),
 	}
 }
@@ -0,0 +1,255 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// readConnectionContext reads the handshake sent by a client when it first
+// connects.
+func readConnectionContext(t *testing.T, conn net.Conn) *hadoop.IpcConnectionContextProto {
+	header := make([]byte, 7)
+	_, err := io.ReadFull(conn, header)
+	require.NoError(t, err)
+	assert.EqualValues(t, "hrpc", string(header[:4]))
+
+	rrh := &hadoop.RpcRequestHeaderProto{}
+	cc := &hadoop.IpcConnectionContextProto{}
+	require.NoError(t, readRPCPacket(conn, rrh, cc))
+	return cc
+}
+
+func TestNamenodeConnectionProxyUser(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	contexts := make(chan *hadoop.IpcConnectionContextProto, 1)
+	go func() {
+		contexts <- readConnectionContext(t, server)
+		io.Copy(io.Discard, server)
+	}()
+
+	conn, err := NewNamenodeConnection(NamenodeConnectionOptions{
+		Addresses: []string{"nn:9000"},
+		User:      "gateway",
+		ProxyUser: "alice",
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return client, nil
+		},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, "alice", conn.User)
+	assert.Equal(t, "gateway", conn.RealUser)
+
+	cc := <-contexts
+	assert.Equal(t, "alice", cc.GetUserInfo().GetEffectiveUser())
+	assert.Equal(t, "gateway", cc.GetUserInfo().GetRealUser())
+}
+
+func TestConnectionContext(t *testing.T) {
+	cc := newConnectionContext("alice", "", "", protocolClass)
+	assert.Equal(t, "alice", cc.GetUserInfo().GetEffectiveUser())
+	assert.Nil(t, cc.GetUserInfo().RealUser)
+
+	cc = newConnectionContext("alice", "", "EXAMPLE.COM", protocolClass)
+	assert.Equal(t, "alice@EXAMPLE.COM", cc.GetUserInfo().GetEffectiveUser())
+	assert.Nil(t, cc.GetUserInfo().RealUser)
+
+	cc = newConnectionContext("alice", "gateway", "EXAMPLE.COM", protocolClass)
+	assert.Equal(t, "alice", cc.GetUserInfo().GetEffectiveUser())
+	assert.Equal(t, "gateway@EXAMPLE.COM", cc.GetUserInfo().GetRealUser())
+}
+
+// serveRequests answers every request on conn with an empty response, until
+// the connection is closed.
+func serveRequests(conn net.Conn) {
+	for {
+		rrh := &hadoop.RpcRequestHeaderProto{}
+		rh := &hadoop.RequestHeaderProto{}
+		if readRPCPacket(conn, rrh, rh, &hdfs.GetServerDefaultsRequestProto{}) != nil {
+			return
+		}
+
+		packet, _ := makeRPCPacket(&hadoop.RpcResponseHeaderProto{
+			CallId:   proto.Uint32(uint32(rrh.GetCallId())),
+			Status:   hadoop.RpcResponseHeaderProto_SUCCESS.Enum(),
+			ClientId: rrh.GetClientId(),
+		})
+
+		if _, err := conn.Write(packet); err != nil {
+			return
+		}
+	}
+}
+
+func TestNamenodeConnectionReconnectsAfterBrokenConnection(t *testing.T) {
+	servers := make(chan net.Conn, 2)
+	contexts := make(chan *hadoop.IpcConnectionContextProto, 2)
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		servers <- server
+		go func() {
+			contexts <- readConnectionContext(t, server)
+			if len(servers) == 1 {
+				// Drop the first connection after reading the first request,
+				// like a namenode closing an idle connection.
+				readRPCPacket(server, &hadoop.RpcRequestHeaderProto{})
+				server.Close()
+			} else {
+				serveRequests(server)
+			}
+		}()
+
+		return client, nil
+	}
+
+	conn, err := NewNamenodeConnection(NamenodeConnectionOptions{
+		Addresses: []string{"nn:9000"},
+		User:      "alice",
+		DialFunc:  dial,
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &hdfs.GetServerDefaultsRequestProto{}
+	resp := &hdfs.GetServerDefaultsResponseProto{}
+	err = conn.Execute("getServerDefaults", req, resp)
+	assert.Error(t, err)
+
+	// The next request should reconnect, and redo the handshake.
+	err = conn.Execute("getServerDefaults", req, resp)
+	require.NoError(t, err)
+	assert.Len(t, servers, 2)
+	assert.Equal(t, "alice", (<-contexts).GetUserInfo().GetEffectiveUser())
+	assert.Equal(t, "alice", (<-contexts).GetUserInfo().GetEffectiveUser())
+
+	for len(servers) > 0 {
+		(<-servers).Close()
+	}
+}
+
+func TestNamenodeConnectionCallInfo(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	headers := make(chan *hadoop.RpcRequestHeaderProto, 2)
+	go func() {
+		readConnectionContext(t, server)
+		for {
+			rrh := &hadoop.RpcRequestHeaderProto{}
+			rh := &hadoop.RequestHeaderProto{}
+			if readRPCPacket(server, rrh, rh, &hdfs.GetServerDefaultsRequestProto{}) != nil {
+				return
+			}
+
+			headers <- rrh
+			packet, _ := makeRPCPacket(&hadoop.RpcResponseHeaderProto{
+				CallId: proto.Uint32(uint32(rrh.GetCallId())),
+				Status: hadoop.RpcResponseHeaderProto_SUCCESS.Enum(),
+			})
+			server.Write(packet)
+		}
+	}()
+
+	conn, err := NewNamenodeConnection(NamenodeConnectionOptions{
+		Addresses: []string{"nn:9000"},
+		User:      "alice",
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return client, nil
+		},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &hdfs.GetServerDefaultsRequestProto{}
+	resp := &hdfs.GetServerDefaultsResponseProto{}
+	require.NoError(t, conn.Execute("getServerDefaults", req, resp))
+
+	rrh := <-headers
+	assert.Nil(t, rrh.CallerContext)
+	assert.Nil(t, rrh.TraceInfo)
+
+	require.NoError(t, conn.ExecuteWithInfo("getServerDefaults", req, resp, &CallInfo{
+		CallerContext:          "ingest-job",
+		CallerContextSignature: []byte("sig"),
+		TraceID:                1234,
+		ParentID:               5678,
+	}))
+
+	rrh = <-headers
+	assert.Equal(t, "ingest-job", rrh.GetCallerContext().GetContext())
+	assert.Equal(t, []byte("sig"), rrh.GetCallerContext().GetSignature())
+	assert.EqualValues(t, 1234, rrh.GetTraceInfo().GetTraceId())
+	assert.EqualValues(t, 5678, rrh.GetTraceInfo().GetParentId())
+}
+
+func TestNamenodeConnectionEvents(t *testing.T) {
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			readConnectionContext(t, server)
+			if addr == "nn2:9000" {
+				serveRequests(server)
+				return
+			}
+
+			// The first namenode is in standby.
+			rrh := &hadoop.RpcRequestHeaderProto{}
+			if readRPCPacket(server, rrh, &hadoop.RequestHeaderProto{}, &hdfs.GetServerDefaultsRequestProto{}) != nil {
+				return
+			}
+
+			packet, _ := makeRPCPacket(&hadoop.RpcResponseHeaderProto{
+				CallId:             proto.Uint32(uint32(rrh.GetCallId())),
+				Status:             hadoop.RpcResponseHeaderProto_ERROR.Enum(),
+				ExceptionClassName: proto.String(standbyExceptionClass),
+			})
+			server.Write(packet)
+			io.Copy(io.Discard, server)
+		}()
+
+		return client, nil
+	}
+
+	type call struct {
+		method, address string
+		err             error
+	}
+
+	var calls []call
+	var failovers []string
+	conn, err := NewNamenodeConnection(NamenodeConnectionOptions{
+		Addresses: []string{"nn1:9000", "nn2:9000"},
+		User:      "alice",
+		DialFunc:  dial,
+		Events: &Events{
+			Call: func(method, address string, d time.Duration, err error) {
+				calls = append(calls, call{method, address, err})
+			},
+			Failover: func(from, to string, err error) {
+				assert.Error(t, err)
+				failovers = append(failovers, from+" -> "+to)
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	req := &hdfs.GetServerDefaultsRequestProto{}
+	resp := &hdfs.GetServerDefaultsResponseProto{}
+	require.NoError(t, conn.Execute("getServerDefaults", req, resp))
+
+	assert.Equal(t, []call{{"getServerDefaults", "nn2:9000", nil}}, calls)
+	assert.Equal(t, []string{"nn1:9000 -> nn2:9000"}, failovers)
+}
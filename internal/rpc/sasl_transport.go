@@ -2,6 +2,8 @@ package rpc
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 
@@ -13,16 +15,62 @@ import (
 	"google.golang.org/protobuf/proto"
 )
 
+// Flags in the header of a GSSAPI wrap token, from RFC 4121.
+const (
+	gssFlagSentByAcceptor = 0x01
+	gssFlagSealed         = 0x02
+	gssFlagAcceptorSubkey = 0x04
+)
+
+var errUnexpectedGSSToken = errors.New("unexpected GSSAPI wrap token from namenode")
+
 // saslTransport implements encrypted or signed RPC.
 type saslTransport struct {
 	basicTransport
 
-	// sessionKey is the encryption key used to decrypt and encrypt the payload.
-	sessionKey krbtypes.EncryptionKey
+	// gss is the security context used to wrap and unwrap the payloads.
+	gss *gssContext
 	// privacy indicates full message encryption
 	privacy bool
 }
 
+// writeRequest writes a SASL-wrapped RPC request.
+//
+// The request is marshaled exactly like a plain one, and the resulting packet
+// is then wrapped in a GSSAPI token and sent as the payload of a SASL WRAP
+// message.
+func (t *saslTransport) writeRequest(w io.Writer, method string, requestID int32, req proto.Message, info *CallInfo) error {
+	rrh := newRPCRequestHeader(requestID, t.clientID)
+	info.apply(rrh)
+	rh := newRequestHeader(t.protocol, method)
+
+	reqBytes, err := makeRPCPacket(rrh, rh, req)
+	if err != nil {
+		return err
+	}
+
+	packet, err := t.wrapPacket(reqBytes)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(packet)
+	return err
+}
+
+// wrapPacket wraps a complete RPC packet in a SASL WRAP message.
+func (t *saslTransport) wrapPacket(packet []byte) ([]byte, error) {
+	token, err := t.gss.wrap(packet, t.privacy)
+	if err != nil {
+		return nil, err
+	}
+
+	return makeRPCPacket(newRPCRequestHeader(saslRpcCallId, t.clientID), &hadoop.RpcSaslProto{
+		State: hadoop.RpcSaslProto_WRAP.Enum(),
+		Token: token,
+	})
+}
+
 // readResponse reads a SASL-wrapped RPC response.
 func (t *saslTransport) readResponse(r io.Reader, method string, requestID int32, resp proto.Message) error {
 	// First, read the sasl payload as a standard rpc response.
@@ -34,49 +82,172 @@ func (t *saslTransport) readResponse(r io.Reader, method string, requestID int32
 		return fmt.Errorf("unexpected SASL state: %s", sasl.GetState().String())
 	}
 
-	// The SaslProto contains the actual payload.
-	var wrapToken gssapi.WrapToken
-	err = wrapToken.Unmarshal(sasl.GetToken(), true)
+	// The SaslProto contains the actual payload, which (once decrypted or
+	// verified) looks like a normal RPC response.
+	payload, err := t.gss.unwrap(sasl.GetToken(), t.privacy)
 	if err != nil {
 		return err
 	}
 
 	rrh := &hadoop.RpcResponseHeaderProto{}
+	err = readRPCPacket(bytes.NewReader(payload), rrh, resp)
+	if err != nil {
+		return err
+	}
+
+	return checkResponseHeader(rrh, method, requestID)
+}
+
+// gssContext wraps and unwraps messages using an established kerberos
+// security context, as described in RFC 4121. We're always the initiator.
+//
+// Each side numbers the tokens it sends. The namenode's tokens must arrive in
+// order, without gaps or replays, or unwrap returns an error.
+type gssContext struct {
+	key krbtypes.EncryptionKey
 
-	if t.privacy {
-		// Decrypt the blob, which then looks like a normal RPC response.
-		decrypted, err := crypto.DecryptMessage(wrapToken.Payload, t.sessionKey, keyusage.GSSAPI_ACCEPTOR_SEAL)
+	sendSeqNum  uint64
+	recvSeqNum  uint64
+	recvStarted bool
+}
+
+func newGSSContext(key krbtypes.EncryptionKey) *gssContext {
+	return &gssContext{key: key}
+}
+
+// wrap returns a wrap token for payload, which is either signed or, if seal is
+// true, encrypted.
+func (g *gssContext) wrap(payload []byte, seal bool) ([]byte, error) {
+	seqNum := g.sendSeqNum
+	g.sendSeqNum++
+
+	if !seal {
+		token, err := gssapi.NewInitiatorWrapToken(payload, g.key)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		err = readRPCPacket(bytes.NewReader(decrypted), rrh, resp)
+		// NewInitiatorWrapToken always uses a sequence number of zero, so we
+		// have to recompute the checksum.
+		token.SndSeqNum = seqNum
+		token.CheckSum = nil
+		err = token.SetCheckSum(g.key, keyusage.GSSAPI_INITIATOR_SEAL)
 		if err != nil {
-			return err
+			return nil, err
 		}
-	} else {
-		// Verify the checksum; the blob is just a normal RPC response.
-		_, err = wrapToken.Verify(t.sessionKey, keyusage.GSSAPI_ACCEPTOR_SEAL)
+
+		return token.Marshal()
+	}
+
+	et, err := crypto.GetEtype(g.key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+
+	// For sealed tokens, the header is encrypted along with the payload, and
+	// no filler is needed for the etypes we support.
+	header := gssHeader(gssFlagSealed, 0, seqNum)
+	plaintext := make([]byte, 0, len(payload)+len(header))
+	plaintext = append(append(plaintext, payload...), header...)
+
+	_, ciphertext, err := et.EncryptMessage(g.key.KeyValue, plaintext, keyusage.GSSAPI_INITIATOR_SEAL)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(header, ciphertext...), nil
+}
+
+// unwrap verifies or decrypts a wrap token from the namenode, and returns the
+// payload. The token must be sealed if and only if sealed is true.
+func (g *gssContext) unwrap(b []byte, sealed bool) ([]byte, error) {
+	if len(b) < gssapi.HdrLen || b[0] != 0x05 || b[1] != 0x04 || b[3] != gssapi.FillerByte {
+		return nil, errUnexpectedGSSToken
+	}
+
+	flags := b[2]
+	if flags&gssFlagSentByAcceptor == 0 {
+		return nil, errUnexpectedGSSToken
+	} else if flags&gssFlagAcceptorSubkey != 0 {
+		return nil, errors.New("unsupported GSSAPI wrap token from namenode: acceptor subkey in use")
+	} else if (flags&gssFlagSealed != 0) != sealed {
+		if sealed {
+			return nil, errors.New("unencrypted GSSAPI wrap token from namenode, but privacy was negotiated")
+		}
+
+		return nil, errors.New("encrypted GSSAPI wrap token from namenode, but privacy was not negotiated")
+	}
+
+	ec := int(binary.BigEndian.Uint16(b[4:6]))
+	rrc := int(binary.BigEndian.Uint16(b[6:8]))
+	seqNum := binary.BigEndian.Uint64(b[8:16])
+
+	// The sender may have rotated the data after the header to the right.
+	data := b[gssapi.HdrLen:]
+	if len(data) > 0 && rrc%len(data) != 0 {
+		rrc = rrc % len(data)
+		data = append(append([]byte{}, data[rrc:]...), data[:rrc]...)
+	}
+
+	var payload []byte
+	if sealed {
+		plaintext, err := crypto.DecryptMessage(data, g.key, keyusage.GSSAPI_ACCEPTOR_SEAL)
 		if err != nil {
-			return fmt.Errorf("unverifiable message from namenode: %s", err)
+			return nil, err
+		}
+
+		// The decrypted data ends with any filler and then a copy of the
+		// header, which must match the one we got (apart from the RRC).
+		if len(plaintext) < ec+gssapi.HdrLen {
+			return nil, errUnexpectedGSSToken
+		}
+
+		headerCopy := plaintext[len(plaintext)-gssapi.HdrLen:]
+		if !bytes.Equal(headerCopy[:6], b[:6]) || !bytes.Equal(headerCopy[8:], b[8:16]) {
+			return nil, errors.New("invalid GSSAPI wrap token from namenode: header mismatch")
+		}
+
+		payload = plaintext[:len(plaintext)-ec-gssapi.HdrLen]
+	} else {
+		if ec > len(data) {
+			return nil, errUnexpectedGSSToken
+		}
+
+		token := gssapi.WrapToken{
+			Flags:     flags,
+			EC:        uint16(ec),
+			SndSeqNum: seqNum,
+			Payload:   data[:len(data)-ec],
+			CheckSum:  data[len(data)-ec:],
 		}
 
-		err = readRPCPacket(bytes.NewReader(wrapToken.Payload), rrh, resp)
+		_, err := token.Verify(g.key, keyusage.GSSAPI_ACCEPTOR_SEAL)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("unverifiable message from namenode: %s", err)
 		}
+
+		payload = token.Payload
 	}
 
-	if int32(rrh.GetCallId()) != requestID {
-		return errUnexpectedSequenceNumber
-	} else if rrh.GetStatus() != hadoop.RpcResponseHeaderProto_SUCCESS {
-		return &NamenodeError{
-			method:    method,
-			message:   rrh.GetErrorMsg(),
-			code:      int(rrh.GetErrorDetail()),
-			exception: rrh.GetExceptionClassName(),
-		}
+	// Only check the sequence number once we know the token is genuine.
+	if g.recvStarted && seqNum != g.recvSeqNum {
+		return nil, fmt.Errorf("unexpected GSSAPI sequence number from namenode: expected %d, got %d",
+			g.recvSeqNum, seqNum)
 	}
 
-	return nil
+	g.recvStarted = true
+	g.recvSeqNum = seqNum + 1
+	return payload, nil
+}
+
+// gssHeader returns the header for a wrap token that we send.
+func gssHeader(flags byte, ec uint16, seqNum uint64) []byte {
+	header := make([]byte, gssapi.HdrLen)
+	header[0] = 0x05
+	header[1] = 0x04
+	header[2] = flags
+	header[3] = gssapi.FillerByte
+	binary.BigEndian.PutUint16(header[4:6], ec)
+	binary.BigEndian.PutUint64(header[8:16], seqNum)
+	return header
 }
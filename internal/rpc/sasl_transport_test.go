@@ -0,0 +1,212 @@
+package rpc
+
+import (
+	"bytes"
+	"testing"
+
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/jcmturner/gokrb5/v8/crypto"
+	"github.com/jcmturner/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/keyusage"
+	krbtypes "github.com/jcmturner/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+var testSessionKey = krbtypes.EncryptionKey{
+	KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+	KeyValue: bytes.Repeat([]byte{0x42}, 32),
+}
+
+// acceptorWrap creates a wrap token like the namenode would.
+func acceptorWrap(t *testing.T, payload []byte, seal bool, seqNum uint64) []byte {
+	if !seal {
+		token := gssapi.WrapToken{
+			Flags:     gssFlagSentByAcceptor,
+			EC:        12,
+			SndSeqNum: seqNum,
+			Payload:   payload,
+		}
+
+		require.NoError(t, token.SetCheckSum(testSessionKey, keyusage.GSSAPI_ACCEPTOR_SEAL))
+		b, err := token.Marshal()
+		require.NoError(t, err)
+		return b
+	}
+
+	header := gssHeader(gssFlagSentByAcceptor|gssFlagSealed, 0, seqNum)
+	et, err := crypto.GetEtype(testSessionKey.KeyType)
+	require.NoError(t, err)
+
+	plaintext := append(append([]byte{}, payload...), header...)
+	_, ciphertext, err := et.EncryptMessage(testSessionKey.KeyValue, plaintext, keyusage.GSSAPI_ACCEPTOR_SEAL)
+	require.NoError(t, err)
+	return append(header, ciphertext...)
+}
+
+// acceptorUnwrap checks a wrap token from the client, like the namenode
+// would, and returns the payload and sequence number.
+func acceptorUnwrap(t *testing.T, b []byte, sealed bool) ([]byte, uint64) {
+	var token gssapi.WrapToken
+	if !sealed {
+		require.NoError(t, token.Unmarshal(b, false))
+		assert.Zero(t, token.Flags&gssFlagSealed)
+		_, err := token.Verify(testSessionKey, keyusage.GSSAPI_INITIATOR_SEAL)
+		require.NoError(t, err)
+		return token.Payload, token.SndSeqNum
+	}
+
+	require.NoError(t, token.Unmarshal(b, false))
+	assert.NotZero(t, token.Flags&gssFlagSealed)
+	plaintext, err := crypto.DecryptMessage(b[gssapi.HdrLen:], testSessionKey, keyusage.GSSAPI_INITIATOR_SEAL)
+	require.NoError(t, err)
+	assert.Equal(t, b[:gssapi.HdrLen], plaintext[len(plaintext)-gssapi.HdrLen:])
+	return plaintext[:len(plaintext)-gssapi.HdrLen], token.SndSeqNum
+}
+
+func TestGSSContextWrap(t *testing.T) {
+	for _, seal := range []bool{false, true} {
+		gss := newGSSContext(testSessionKey)
+		for i := 0; i < 3; i++ {
+			b, err := gss.wrap([]byte("foobar"), seal)
+			require.NoError(t, err)
+
+			payload, seqNum := acceptorUnwrap(t, b, seal)
+			assert.Equal(t, "foobar", string(payload))
+			assert.EqualValues(t, i, seqNum)
+		}
+	}
+}
+
+func TestGSSContextUnwrap(t *testing.T) {
+	for _, seal := range []bool{false, true} {
+		gss := newGSSContext(testSessionKey)
+		for i := 0; i < 3; i++ {
+			payload, err := gss.unwrap(acceptorWrap(t, []byte("foobar"), seal, uint64(100+i)), seal)
+			require.NoError(t, err)
+			assert.Equal(t, "foobar", string(payload))
+		}
+
+		// The protection level must match what was negotiated.
+		_, err := newGSSContext(testSessionKey).unwrap(acceptorWrap(t, []byte("foobar"), !seal, 0), seal)
+		assert.Error(t, err)
+	}
+}
+
+func TestGSSContextUnwrapRotated(t *testing.T) {
+	b := acceptorWrap(t, []byte("foobar"), true, 0)
+
+	// Rotate the data after the header right by 28 bytes, as some
+	// implementations do.
+	data := b[gssapi.HdrLen:]
+	rotated := append(append([]byte{}, data[len(data)-28:]...), data[:len(data)-28]...)
+	b = append(b[:gssapi.HdrLen:gssapi.HdrLen], rotated...)
+	b[7] = 28
+
+	payload, err := newGSSContext(testSessionKey).unwrap(b, true)
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(payload))
+}
+
+func TestGSSContextUnwrapSequence(t *testing.T) {
+	for _, seal := range []bool{false, true} {
+		gss := newGSSContext(testSessionKey)
+		_, err := gss.unwrap(acceptorWrap(t, []byte("foo"), seal, 5), seal)
+		require.NoError(t, err)
+
+		// Replayed.
+		_, err = gss.unwrap(acceptorWrap(t, []byte("foo"), seal, 5), seal)
+		assert.Error(t, err)
+
+		// Skipped one.
+		_, err = gss.unwrap(acceptorWrap(t, []byte("foo"), seal, 7), seal)
+		assert.Error(t, err)
+
+		_, err = gss.unwrap(acceptorWrap(t, []byte("foo"), seal, 6), seal)
+		assert.NoError(t, err)
+	}
+}
+
+func TestGSSContextUnwrapTampered(t *testing.T) {
+	for _, seal := range []bool{false, true} {
+		b := acceptorWrap(t, []byte("foobar"), seal, 0)
+		b[gssapi.HdrLen] ^= 0xff
+		_, err := newGSSContext(testSessionKey).unwrap(b, seal)
+		assert.Error(t, err)
+
+		// Changing the sequence number in the header should also be caught.
+		b = acceptorWrap(t, []byte("foobar"), seal, 0)
+		b[15] = 1
+		_, err = newGSSContext(testSessionKey).unwrap(b, seal)
+		assert.Error(t, err)
+	}
+}
+
+func TestSaslTransport(t *testing.T) {
+	for _, privacy := range []bool{false, true} {
+		tr := &saslTransport{
+			basicTransport: basicTransport{clientID: []byte("client"), protocol: protocolClass},
+			gss:            newGSSContext(testSessionKey),
+			privacy:        privacy,
+		}
+
+		// Requests are wrapped in a SASL message.
+		var buf bytes.Buffer
+		req := &hdfs.GetFileInfoRequestProto{Src: proto.String("/foo")}
+		require.NoError(t, tr.writeRequest(&buf, "getFileInfo", 7, req, nil))
+
+		rrh := &hadoop.RpcRequestHeaderProto{}
+		saslMsg := &hadoop.RpcSaslProto{}
+		require.NoError(t, readRPCPacket(&buf, rrh, saslMsg))
+		assert.EqualValues(t, saslRpcCallId, rrh.GetCallId())
+		assert.Equal(t, hadoop.RpcSaslProto_WRAP, saslMsg.GetState())
+
+		payload, _ := acceptorUnwrap(t, saslMsg.GetToken(), privacy)
+		rh := &hadoop.RequestHeaderProto{}
+		unwrappedReq := &hdfs.GetFileInfoRequestProto{}
+		require.NoError(t, readRPCPacket(bytes.NewReader(payload), rrh, rh, unwrappedReq))
+		assert.EqualValues(t, 7, rrh.GetCallId())
+		assert.Equal(t, "getFileInfo", rh.GetMethodName())
+		assert.Equal(t, "/foo", unwrappedReq.GetSrc())
+
+		// And so are responses.
+		inner, err := makeRPCPacket(&hadoop.RpcResponseHeaderProto{
+			CallId: proto.Uint32(7),
+			Status: hadoop.RpcResponseHeaderProto_SUCCESS.Enum(),
+		}, &hdfs.GetFileInfoResponseProto{})
+		require.NoError(t, err)
+
+		outer, err := makeRPCPacket(&hadoop.RpcResponseHeaderProto{
+			CallId: proto.Uint32(uint32(saslRpcCallId & 0xffffffff)),
+			Status: hadoop.RpcResponseHeaderProto_SUCCESS.Enum(),
+		}, &hadoop.RpcSaslProto{
+			State: hadoop.RpcSaslProto_WRAP.Enum(),
+			Token: acceptorWrap(t, inner, privacy, 0),
+		})
+		require.NoError(t, err)
+
+		resp := &hdfs.GetFileInfoResponseProto{}
+		require.NoError(t, tr.readResponse(bytes.NewReader(outer), "getFileInfo", 7, resp))
+	}
+}
+
+func TestChooseRPCProtection(t *testing.T) {
+	all := byte(0x07)
+	p, err := chooseRPCProtection(all, nil)
+	require.NoError(t, err)
+	assert.Equal(t, RPCProtectionPrivacy, p)
+
+	p, err = chooseRPCProtection(all, []string{RPCProtectionIntegrity, RPCProtectionPrivacy})
+	require.NoError(t, err)
+	assert.Equal(t, RPCProtectionIntegrity, p)
+
+	p, err = chooseRPCProtection(0x01, nil)
+	require.NoError(t, err)
+	assert.Equal(t, RPCProtectionAuthentication, p)
+
+	_, err = chooseRPCProtection(0x01, []string{RPCProtectionPrivacy})
+	assert.Error(t, err)
+}
@@ -11,7 +11,7 @@ import (
 var errUnexpectedSequenceNumber = errors.New("unexpected sequence number")
 
 type transport interface {
-	writeRequest(w io.Writer, method string, requestID int32, req proto.Message) error
+	writeRequest(w io.Writer, method string, requestID int32, req proto.Message, info *CallInfo) error
 	readResponse(r io.Reader, method string, requestID int32, resp proto.Message) error
 }
 
@@ -19,6 +19,8 @@ type transport interface {
 type basicTransport struct {
 	// clientID is the client ID of this writer.
 	clientID []byte
+	// protocol is the name of the protocol the requests are part of.
+	protocol string
 }
 
 // writeRequest writes an RPC message.
@@ -33,9 +35,10 @@ type basicTransport struct {
 // +-----------------------------------------------------------+
 // |  varint length + Request                                  |
 // +-----------------------------------------------------------+
-func (t *basicTransport) writeRequest(w io.Writer, method string, requestID int32, req proto.Message) error {
+func (t *basicTransport) writeRequest(w io.Writer, method string, requestID int32, req proto.Message, info *CallInfo) error {
 	rrh := newRPCRequestHeader(requestID, t.clientID)
-	rh := newRequestHeader(method)
+	info.apply(rrh)
+	rh := newRequestHeader(t.protocol, method)
 
 	reqBytes, err := makeRPCPacket(rrh, rh, req)
 	if err != nil {
@@ -61,9 +64,21 @@ func (t *basicTransport) readResponse(r io.Reader, method string, requestID int3
 	err := readRPCPacket(r, rrh, resp)
 	if err != nil {
 		return err
-	} else if int32(rrh.GetCallId()) != requestID {
+	}
+
+	return checkResponseHeader(rrh, method, requestID)
+}
+
+// checkResponseHeader returns an error if the response header doesn't match
+// the request, or describes a failure. A fatal error, which closes the
+// connection, may be reported against an earlier call ID than the request's
+// (for example, if the server rejected the connection context), so it's
+// returned regardless.
+func checkResponseHeader(rrh *hadoop.RpcResponseHeaderProto, method string, requestID int32) error {
+	status := rrh.GetStatus()
+	if int32(rrh.GetCallId()) != requestID && status != hadoop.RpcResponseHeaderProto_FATAL {
 		return errUnexpectedSequenceNumber
-	} else if rrh.GetStatus() != hadoop.RpcResponseHeaderProto_SUCCESS {
+	} else if status != hadoop.RpcResponseHeaderProto_SUCCESS {
 		return &NamenodeError{
 			method:    method,
 			message:   rrh.GetErrorMsg(),
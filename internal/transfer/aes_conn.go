@@ -3,20 +3,35 @@ package transfer
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"errors"
+	"fmt"
 	"net"
 	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
 )
 
+// CipherAESCTRNoPadding is the name Hadoop uses for the AES cipher suite, as
+// in dfs.encrypt.data.transfer.cipher.suites.
+const CipherAESCTRNoPadding = "AES/CTR/NoPadding"
+
+// aesConn encrypts a connection to a datanode with AES/CTR, once the keys have
+// been negotiated during the SASL handshake.
 type aesConn struct {
 	conn net.Conn
 
-	encStream cipher.StreamWriter
-	decStream cipher.StreamReader
+	enc      cipher.Stream
+	dec      cipher.Stream
+	writeBuf []byte
 }
 
 func newAesConn(conn net.Conn, inKey, outKey, inIv, outIv []byte) (net.Conn, error) {
 	c := &aesConn{conn: conn}
 
+	if len(inIv) != aes.BlockSize || len(outIv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid IV length for %s", CipherAESCTRNoPadding)
+	}
+
 	encBlock, err := aes.NewCipher(inKey)
 	if err != nil {
 		return nil, err
@@ -27,11 +42,52 @@ func newAesConn(conn net.Conn, inKey, outKey, inIv, outIv []byte) (net.Conn, err
 		return nil, err
 	}
 
-	c.encStream = cipher.StreamWriter{S: cipher.NewCTR(encBlock, inIv), W: conn}
-	c.decStream = cipher.StreamReader{S: cipher.NewCTR(decBlock, outIv), R: conn}
+	c.enc = cipher.NewCTR(encBlock, inIv)
+	c.dec = cipher.NewCTR(decBlock, outIv)
 	return c, nil
 }
 
+// negotiatedAesConn switches to AES for the rest of the connection, using the
+// cipher option the datanode picked. The keys in the option are themselves
+// wrapped with the SASL session, and have to be unwrapped first.
+func negotiatedAesConn(conn net.Conn, wrapped digestMD5Conn, opt *hdfs.CipherOptionProto) (net.Conn, error) {
+	if opt.GetSuite() != hdfs.CipherSuiteProto_AES_CTR_NOPADDING {
+		return nil, fmt.Errorf("unsupported cipher suite from datanode: %s", opt.GetSuite())
+	} else if opt.InKey == nil || opt.OutKey == nil {
+		return nil, errors.New("invalid cipher option from datanode: missing keys")
+	}
+
+	// decode reuses its input, so the keys have to be copied out.
+	decoded, err := wrapped.decode(opt.InKey)
+	if err != nil {
+		return nil, err
+	}
+
+	inKey := make([]byte, len(decoded))
+	copy(inKey, decoded)
+
+	outKey, err := wrapped.decode(opt.OutKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAesConn(conn, inKey, outKey, opt.InIv, opt.OutIv)
+}
+
+// NegotiatedCipher returns the cipher used to encrypt a connection returned by
+// SaslDialer: CipherAESCTRNoPadding, the DIGEST-MD5 cipher (for example,
+// "rc4"), or an empty string if the connection isn't encrypted.
+func NegotiatedCipher(conn net.Conn) string {
+	switch c := conn.(type) {
+	case *aesConn:
+		return CipherAESCTRNoPadding
+	case *digestMD5PrivacyConn:
+		return c.cipher
+	default:
+		return ""
+	}
+}
+
 func (d *aesConn) Close() error {
 	return d.conn.Close()
 }
@@ -56,10 +112,20 @@ func (d *aesConn) SetWriteDeadline(t time.Time) error {
 	return d.conn.SetWriteDeadline(t)
 }
 
-func (d *aesConn) Write(b []byte) (n int, err error) {
-	return d.encStream.Write(b)
+// Write encrypts b into a buffer that's reused between writes, to avoid
+// allocating for every packet.
+func (d *aesConn) Write(b []byte) (int, error) {
+	if cap(d.writeBuf) < len(b) {
+		d.writeBuf = make([]byte, len(b))
+	}
+
+	buf := d.writeBuf[:len(b)]
+	d.enc.XORKeyStream(buf, b)
+	return d.conn.Write(buf)
 }
 
-func (d *aesConn) Read(b []byte) (n int, err error) {
-	return d.decStream.Read(b)
+func (d *aesConn) Read(b []byte) (int, error) {
+	n, err := d.conn.Read(b)
+	d.dec.XORKeyStream(b[:n], b[:n])
+	return n, err
 }
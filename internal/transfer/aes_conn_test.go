@@ -0,0 +1,104 @@
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+// plainDigestConn is a digestMD5Conn that doesn't actually wrap anything.
+type plainDigestConn struct {
+	net.Conn
+}
+
+func (c plainDigestConn) decode(input []byte) ([]byte, error) {
+	return input, nil
+}
+
+func TestAesConn(t *testing.T) {
+	inKey := bytes.Repeat([]byte{0x01}, 16)
+	outKey := bytes.Repeat([]byte{0x02}, 16)
+	inIv := bytes.Repeat([]byte{0x03}, 16)
+	outIv := bytes.Repeat([]byte{0x04}, 16)
+
+	clientConn, serverConn := net.Pipe()
+	client, err := newAesConn(clientConn, inKey, outKey, inIv, outIv)
+	require.NoError(t, err)
+	defer client.Close()
+
+	// The datanode uses the same keys, the other way around.
+	server, err := newAesConn(serverConn, outKey, inKey, outIv, inIv)
+	require.NoError(t, err)
+	defer server.Close()
+
+	// Several writes of different sizes, so that the write buffer gets reused.
+	messages := [][]byte{
+		bytes.Repeat([]byte("a"), 100),
+		bytes.Repeat([]byte("b"), 10),
+		bytes.Repeat([]byte("c"), 1000),
+	}
+
+	go func() {
+		for _, msg := range messages {
+			client.Write(msg)
+		}
+	}()
+
+	for _, msg := range messages {
+		b := make([]byte, len(msg))
+		_, err := io.ReadFull(server, b)
+		require.NoError(t, err)
+		assert.Equal(t, msg, b)
+	}
+
+	go server.Write([]byte("pong"))
+	b := make([]byte, 4)
+	_, err = io.ReadFull(client, b)
+	require.NoError(t, err)
+	assert.Equal(t, "pong", string(b))
+}
+
+func TestNegotiatedAesConnInvalidOption(t *testing.T) {
+	conn, _ := net.Pipe()
+	defer conn.Close()
+
+	key := bytes.Repeat([]byte{0x01}, 16)
+	iv := bytes.Repeat([]byte{0x02}, 16)
+	valid := &hdfs.CipherOptionProto{
+		Suite:  hdfs.CipherSuiteProto_AES_CTR_NOPADDING.Enum(),
+		InKey:  key,
+		InIv:   iv,
+		OutKey: key,
+		OutIv:  iv,
+	}
+
+	c, err := negotiatedAesConn(conn, plainDigestConn{conn}, valid)
+	require.NoError(t, err)
+	assert.Equal(t, CipherAESCTRNoPadding, NegotiatedCipher(c))
+
+	_, err = negotiatedAesConn(conn, plainDigestConn{conn}, &hdfs.CipherOptionProto{
+		Suite: hdfs.CipherSuiteProto_UNKNOWN.Enum(),
+		InKey: key, InIv: iv, OutKey: key, OutIv: iv,
+	})
+	assert.Error(t, err)
+
+	_, err = negotiatedAesConn(conn, plainDigestConn{conn}, &hdfs.CipherOptionProto{
+		Suite: hdfs.CipherSuiteProto_AES_CTR_NOPADDING.Enum(),
+		InKey: key, InIv: iv[:8], OutKey: key, OutIv: iv,
+	})
+	assert.Error(t, err)
+
+	_, err = negotiatedAesConn(conn, plainDigestConn{conn}, &hdfs.CipherOptionProto{
+		Suite: hdfs.CipherSuiteProto_AES_CTR_NOPADDING.Enum(),
+		InKey: key[:5], InIv: iv, OutKey: key, OutIv: iv,
+	})
+	assert.Error(t, err)
+
+	assert.Equal(t, "", NegotiatedCipher(conn))
+}
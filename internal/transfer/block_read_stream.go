@@ -18,6 +18,7 @@ var errInvalidChecksum = errors.New("invalid checksum")
 // block from a single datanode.
 type blockReadStream struct {
 	reader       io.Reader
+	throttler    *Throttler
 	checksumTab  *crc32.Table
 	chunkSize    int
 	checksumSize int
@@ -40,7 +41,23 @@ func newBlockReadStream(reader io.Reader, chunkSize int, checksumTab *crc32.Tabl
 	}
 }
 
+// Read implements io.Reader. If the stream has a Throttler, it blocks as
+// necessary to keep to its rate.
 func (s *blockReadStream) Read(b []byte) (int, error) {
+	n, err := s.read(b)
+	s.throttler.wait(n)
+	return n, err
+}
+
+func (s *blockReadStream) read(b []byte) (int, error) {
+	// For small reads, we need to buffer a single chunk. If we did that
+	// previously, read the rest of the buffer, so we're aligned back on a
+	// chunk boundary.
+	if s.chunk.Len() > 0 {
+		n, _ := s.chunk.Read(b)
+		return n, nil
+	}
+
 	if s.chunkIndex == s.numChunks {
 		if s.lastPacket {
 			return 0, io.EOF
@@ -54,13 +71,7 @@ func (s *blockReadStream) Read(b []byte) (int, error) {
 
 	remainingInPacket := (s.packetLength - (s.chunkIndex * s.chunkSize))
 
-	// For small reads, we need to buffer a single chunk. If we did that
-	// previously, read the rest of the buffer, so we're aligned back on a
-	// chunk boundary.
-	if s.chunk.Len() > 0 {
-		n, _ := s.chunk.Read(b)
-		return n, nil
-	} else if len(b) < s.chunkSize {
+	if len(b) < s.chunkSize {
 		chunkSize := s.chunkSize
 		if chunkSize > remainingInPacket {
 			chunkSize = remainingInPacket
@@ -124,6 +135,28 @@ func (s *blockReadStream) Read(b []byte) (int, error) {
 	return n, err
 }
 
+// finish reads the empty packet marking the end of the stream, once all the
+// data has been read, so that the connection can be reused. It returns an
+// error if there's any data left over.
+func (s *blockReadStream) finish() error {
+	for s.chunkIndex < s.numChunks || !s.lastPacket {
+		if s.chunkIndex < s.numChunks || s.chunk.Len() > 0 {
+			return errors.New("unread data in stream")
+		}
+
+		err := s.startPacket()
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.chunk.Len() > 0 {
+		return errors.New("unread data in stream")
+	}
+
+	return nil
+}
+
 func (s *blockReadStream) validateChecksum(b []byte) error {
 	if s.checksumTab == nil {
 		return nil
@@ -31,16 +31,49 @@ type BlockReader struct {
 	// DialFunc is used to connect to the datanodes. If nil, then
 	// (&net.Dialer{}).DialContext is used.
 	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
-
-	datanodes *datanodeFailover
-	stream    *blockReadStream
-	conn      net.Conn
-	deadline  time.Time
-	closed    bool
+	// HedgedReads, if set, enables hedged reads for ReadAt.
+	HedgedReads *HedgedReadPool
+	// ConnCache, if set, is used to reuse idle connections to the datanodes.
+	// Once a read finishes cleanly, the connection is returned to it.
+	ConnCache *ConnCache
+	// ShortCircuit, if set, enables reading the block straight from disk if
+	// one of the datanodes is on the same host. If that fails, the block is
+	// read over the network as usual.
+	ShortCircuit *ShortCircuitReads
+	// DeadNodes, if set, is used to record datanode failures, so that other
+	// reads can avoid the failed datanodes.
+	DeadNodes *DeadNodeDetector
+	// Events, if set, is notified of the bytes read, checksum failures, and
+	// retries.
+	Events *Events
+
+	datanodes   *datanodeFailover
+	local       *localReplica
+	triedLocal  bool
+	stream      *blockReadStream
+	conn        net.Conn
+	address     string
+	deadline    time.Time
+	throttler   *Throttler
+	readLength  int64
+	readEnd     int64
+	bytesRead   int64
+	lastAddress string
+	closed      bool
 }
 
 const maxSkip = 65536
 
+// SetThrottler sets a Throttler to limit the rate at which the block is read
+// from the datanodes, or removes the limit if t is nil. Short-circuit reads
+// aren't limited.
+func (br *BlockReader) SetThrottler(t *Throttler) {
+	br.throttler = t
+	if br.stream != nil {
+		br.stream.throttler = t
+	}
+}
+
 // SetDeadline sets the deadline for future Read calls. A zero value for t
 // means Read will not time out.
 func (br *BlockReader) SetDeadline(t time.Time) error {
@@ -60,8 +93,8 @@ func (br *BlockReader) SetDeadline(t time.Time) error {
 // transparently. In the case that all the datanodes fail, the error
 // from the most recent attempt will be returned.
 //
-// Any datanode failures are recorded in a global cache, so subsequent reads,
-// even reads for different blocks, will prioritize them lower.
+// Any datanode failures are recorded with DeadNodes, so subsequent reads, even
+// reads for different blocks, will prioritize them lower.
 func (br *BlockReader) Read(b []byte) (int, error) {
 	if br.closed {
 		return 0, io.ErrClosedPipe
@@ -70,14 +103,29 @@ func (br *BlockReader) Read(b []byte) (int, error) {
 		return 0, io.EOF
 	}
 
-	if br.datanodes == nil {
-		locs := br.Block.GetLocs()
-		datanodes := make([]string, len(locs))
-		for i, loc := range locs {
-			datanodes[i] = getDatanodeAddress(loc.GetId(), br.UseDatanodeHostname)
+	if !br.triedLocal {
+		br.openLocal()
+	}
+
+	if br.local != nil {
+		n, err := br.local.ReadAt(b, br.Offset)
+		br.Offset += int64(n)
+		br.bytesRead += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
 		}
 
-		br.datanodes = newDatanodeFailover(datanodes)
+		// Something is wrong with the local replica (a checksum failure, for
+		// example), so fall back to reading over the network.
+		br.Events.readFailed("", err, true)
+		br.closeLocal()
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	if br.datanodes == nil {
+		br.datanodes = br.newDatanodeFailover()
 	}
 
 	// This is the main retry loop.
@@ -88,6 +136,10 @@ func (br *BlockReader) Read(b []byte) (int, error) {
 			err := br.connectNext()
 			if err != nil {
 				br.datanodes.recordFailure(err)
+				if isAccessError(err) {
+					return 0, err
+				}
+
 				continue
 			}
 		}
@@ -96,6 +148,8 @@ func (br *BlockReader) Read(b []byte) (int, error) {
 		// a partial read (n < len(b)).
 		n, err := br.stream.Read(b)
 		br.Offset += int64(n)
+		br.bytesRead += int64(n)
+		br.lastAddress = br.address
 		if err != nil && err != io.EOF {
 			br.stream = nil
 			br.datanodes.recordFailure(err)
@@ -117,6 +171,158 @@ func (br *BlockReader) Read(b []byte) (int, error) {
 	return 0, err
 }
 
+// ReadAt reads len(b) bytes from the block, starting at off, over a new
+// connection. Unlike Read, it returns an error unless all the bytes could be
+// read, and it doesn't change Offset.
+//
+// If HedgedReads is set and the first datanode hasn't returned the data within
+// the pool's threshold, the same read is started against another datanode,
+// and whichever finishes first wins. Otherwise, datanodes are tried one after
+// the other, as with Read.
+func (br *BlockReader) ReadAt(b []byte, off int64) (int, error) {
+	if br.closed {
+		return 0, io.ErrClosedPipe
+	} else if off < 0 || uint64(off)+uint64(len(b)) > br.Block.GetB().GetNumBytes() {
+		return 0, errors.New("invalid offset")
+	} else if len(b) == 0 {
+		return 0, nil
+	}
+
+	if !br.triedLocal {
+		br.openLocal()
+	}
+
+	if br.local != nil {
+		n, err := br.local.ReadAt(b, off)
+		if err == nil {
+			br.bytesRead += int64(n)
+			return n, nil
+		}
+
+		br.Events.readFailed("", err, true)
+		br.closeLocal()
+	}
+
+	type result struct {
+		address string
+		buf     []byte
+		err     error
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	datanodes := br.newDatanodeFailover()
+	results := make(chan result, datanodes.numRemaining())
+	inFlight := 0
+	start := func(release func()) {
+		address := datanodes.next()
+		inFlight++
+		go func() {
+			if release != nil {
+				defer release()
+			}
+
+			buf := make([]byte, len(b))
+			err := br.readAtFrom(ctx, address, buf, off)
+			results <- result{address: address, buf: buf, err: err}
+		}()
+	}
+
+	var hedge <-chan time.Time
+	if br.HedgedReads != nil {
+		timer := time.NewTicker(br.HedgedReads.threshold())
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	start(nil)
+	for inFlight > 0 {
+		select {
+		case r := <-results:
+			inFlight--
+			if r.err == nil {
+				br.bytesRead += int64(len(r.buf))
+				br.lastAddress = r.address
+				return copy(b, r.buf), nil
+			}
+
+			datanodes.recordFailureAt(r.address, r.err)
+			if isAccessError(r.err) {
+				return 0, r.err
+			}
+
+			if inFlight == 0 && datanodes.numRemaining() > 0 {
+				start(nil)
+			}
+		case <-hedge:
+			// If the pool is exhausted, just keep waiting for the reads we
+			// already have in flight.
+			if datanodes.numRemaining() > 0 && br.HedgedReads.acquire() {
+				start(br.HedgedReads.release)
+			}
+		}
+	}
+
+	err := datanodes.lastError()
+	if err == nil {
+		err = errors.New("no available datanodes")
+	}
+
+	return 0, err
+}
+
+// readAtFrom reads len(b) bytes at off from a specific datanode. The read is
+// abandoned if ctx is canceled.
+func (br *BlockReader) readAtFrom(ctx context.Context, address string, b []byte, off int64) error {
+	dialFunc := br.DialFunc
+	if dialFunc == nil {
+		dialFunc = (&net.Dialer{}).DialContext
+	}
+
+	// Closing the connection interrupts a blocked read, or cleans it up once
+	// we're done.
+	done := make(chan struct{})
+	defer close(done)
+
+	reader := &BlockReader{
+		ClientName:          br.ClientName,
+		Block:               br.Block,
+		Offset:              off,
+		UseDatanodeHostname: br.UseDatanodeHostname,
+		deadline:            br.deadline,
+		throttler:           br.throttler,
+		readLength:          int64(len(b)),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialFunc(ctx, network, addr)
+			if err == nil {
+				go func() {
+					select {
+					case <-ctx.Done():
+					case <-done:
+					}
+
+					conn.Close()
+				}()
+			}
+
+			return conn, err
+		},
+	}
+
+	err := reader.connect(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.ReadFull(reader.stream, b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
 // Skip attempts to discard bytes in the stream in order to skip forward. This
 // is an optimization for the case that the amount to skip is very small. It
 // returns an error if skip was not attempted at all (because the BlockReader
@@ -129,11 +335,17 @@ func (br *BlockReader) Skip(n int64) error {
 	blockSize := int64(br.Block.GetB().GetNumBytes())
 	resultingOffset := br.Offset + n
 
-	if br.stream == nil || n < 0 || n > maxSkip || resultingOffset >= blockSize {
+	if n < 0 || resultingOffset >= blockSize {
+		return errors.New("unable to skip")
+	} else if br.local != nil {
+		br.Offset = resultingOffset
+		return nil
+	} else if br.stream == nil || n > maxSkip {
 		return errors.New("unable to skip")
 	}
 
-	_, err := io.CopyN(io.Discard, br.stream, n)
+	copied, err := io.CopyN(io.Discard, br.stream, n)
+	br.Offset += copied
 	if err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
@@ -146,31 +358,122 @@ func (br *BlockReader) Skip(n int64) error {
 	return err
 }
 
-// Close implements io.Closer.
+// Close implements io.Closer. If everything requested from the datanode was
+// read, and ConnCache is set, the connection is kept for reuse.
 func (br *BlockReader) Close() error {
+	if !br.closed {
+		br.Events.blockRead(br.lastAddress, br.bytesRead)
+	}
+
 	br.closed = true
+	br.closeLocal()
 	if br.conn != nil {
-		br.conn.Close()
+		if br.stream != nil && br.Offset == br.readEnd {
+			br.releaseConn()
+		} else {
+			br.conn.Close()
+		}
+
+		br.conn = nil
+		br.stream = nil
 	}
 
 	return nil
 }
 
+// releaseConn tells the datanode that the read succeeded, and then returns the
+// connection to the cache.
+func (br *BlockReader) releaseConn() {
+	if br.ConnCache == nil || br.stream.finish() != nil {
+		br.conn.Close()
+		return
+	}
+
+	status := hdfs.Status_SUCCESS
+	if br.stream.checksumTab != nil {
+		status = hdfs.Status_CHECKSUM_OK
+	}
+
+	msg, err := makePrefixedMessage(&hdfs.ClientReadStatusProto{Status: status.Enum()})
+	if err == nil {
+		_, err = br.conn.Write(msg)
+	}
+
+	if err == nil {
+		err = br.conn.SetDeadline(time.Time{})
+	}
+
+	if err != nil {
+		br.conn.Close()
+		return
+	}
+
+	br.ConnCache.Put(br.address, br.conn)
+}
+
+// openLocal tries to set up a short-circuit read. It's only attempted once.
+func (br *BlockReader) openLocal() {
+	br.triedLocal = true
+	if br.ShortCircuit == nil {
+		return
+	}
+
+	local, err := br.ShortCircuit.open(br.Block)
+	if err == nil {
+		br.local = local
+	}
+}
+
+func (br *BlockReader) closeLocal() {
+	if br.local != nil {
+		br.local.Close()
+		br.local = nil
+	}
+}
+
+func (br *BlockReader) newDatanodeFailover() *datanodeFailover {
+	return newDatanodeFailover(br.Block.GetLocs(), br.UseDatanodeHostname, br.DeadNodes, br.Events)
+}
+
 // connectNext pops a datanode from the list based on previous failures, and
 // connects to it.
 func (br *BlockReader) connectNext() error {
-	address := br.datanodes.next()
+	return br.connect(context.Background(), br.datanodes.next())
+}
+
+func (br *BlockReader) connect(ctx context.Context, address string) error {
+	// Try an idle connection first. The datanode may have closed it in the
+	// meantime, in which case we just fall back to a new one.
+	if conn := br.ConnCache.Get(address); conn != nil {
+		err := br.startRead(conn, address)
+		if err == nil {
+			return nil
+		}
+
+		conn.Close()
+	}
 
 	if br.DialFunc == nil {
 		br.DialFunc = (&net.Dialer{}).DialContext
 	}
 
-	conn, err := br.DialFunc(context.Background(), "tcp", address)
+	conn, err := br.DialFunc(ctx, "tcp", address)
 	if err != nil {
 		return err
 	}
 
-	err = br.writeBlockReadRequest(conn)
+	err = br.startRead(conn, address)
+	if err != nil {
+		conn.Close()
+	}
+
+	return err
+}
+
+// startRead sends the read request over conn, and sets up the stream to read
+// the response.
+func (br *BlockReader) startRead(conn net.Conn, address string) error {
+	err := br.writeBlockReadRequest(conn)
 	if err != nil {
 		return err
 	}
@@ -179,7 +482,7 @@ func (br *BlockReader) connectNext() error {
 	if err != nil {
 		return err
 	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
-		return fmt.Errorf("read failed: %s (%s)", resp.GetStatus().String(), resp.GetMessage())
+		return blockOpError("read", resp.GetStatus(), resp.GetMessage())
 	}
 
 	readInfo := resp.GetReadOpChecksumInfo()
@@ -205,6 +508,7 @@ func (br *BlockReader) connectNext() error {
 	chunkOffset := int64(readInfo.GetChunkOffset())
 	chunkSize := int(checksumInfo.GetBytesPerChecksum())
 	stream := newBlockReadStream(conn, chunkSize, checksumTab, checksumSize)
+	stream.throttler = br.throttler
 
 	// The read will start aligned to a chunk boundary, so we need to skip
 	// forward to the requested offset.
@@ -223,6 +527,8 @@ func (br *BlockReader) connectNext() error {
 
 	br.stream = stream
 	br.conn = conn
+	br.address = address
+	br.readEnd = br.Offset + br.requestLength()
 	err = br.conn.SetDeadline(br.deadline)
 	if err != nil {
 		return err
@@ -240,7 +546,7 @@ func (br *BlockReader) connectNext() error {
 // |  varint length + OpReadBlockProto                         |
 // +-----------------------------------------------------------+
 func (br *BlockReader) writeBlockReadRequest(w io.Writer) error {
-	needed := br.Block.GetB().GetNumBytes() - uint64(br.Offset)
+	needed := uint64(br.requestLength())
 	op := &hdfs.OpReadBlockProto{
 		Header: &hdfs.ClientOperationHeaderProto{
 			BaseHeader: &hdfs.BaseHeaderProto{
@@ -255,3 +561,12 @@ func (br *BlockReader) writeBlockReadRequest(w io.Writer) error {
 
 	return writeBlockOpRequest(w, readBlockOp, op)
 }
+
+// requestLength returns the number of bytes to ask the datanode for.
+func (br *BlockReader) requestLength() int64 {
+	if br.readLength > 0 {
+		return br.readLength
+	}
+
+	return int64(br.Block.GetB().GetNumBytes()) - br.Offset
+}
@@ -0,0 +1,50 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReadInvalidBlockToken(t *testing.T) {
+	dials := 0
+	deadNodes := &DeadNodeDetector{}
+	br := &BlockReader{
+		Block:     testBlock("token-a", "token-b"),
+		DeadNodes: deadNodes,
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials++
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				header := make([]byte, 3)
+				_, err := io.ReadFull(server, header)
+				require.NoError(t, err)
+				require.NoError(t, readPrefixedMessage(server, &hdfs.OpReadBlockProto{}))
+
+				resp, err := makePrefixedMessage(&hdfs.BlockOpResponseProto{
+					Status:  hdfs.Status_ERROR_ACCESS_TOKEN.Enum(),
+					Message: proto.String("Block token is expired"),
+				})
+				require.NoError(t, err)
+				server.Write(resp)
+			}()
+
+			return client, nil
+		},
+	}
+
+	_, err := br.Read(make([]byte, 10))
+	assert.ErrorIs(t, err, ErrInvalidBlockToken)
+
+	// The other datanode would reject the token too, and neither should be
+	// considered dead.
+	assert.Equal(t, 1, dials)
+	assert.Empty(t, deadNodes.DeadNodes())
+}
@@ -50,10 +50,11 @@ func init() {
 type blockWriteStream struct {
 	block *hdfs.LocatedBlockProto
 
-	conn   io.ReadWriter
-	buf    bytes.Buffer
-	offset int64
-	closed bool
+	conn      io.ReadWriter
+	throttler *Throttler
+	buf       bytes.Buffer
+	offset    int64
+	closed    bool
 
 	packets chan int
 	seqno   int
@@ -61,6 +62,9 @@ type blockWriteStream struct {
 	ackError        error
 	acksDone        chan struct{}
 	lastPacketSeqno int
+	ackedSeqno      int
+	ackLock         sync.Mutex
+	ackCond         *sync.Cond
 
 	heartbeats chan struct{}
 	writeLock  sync.Mutex
@@ -70,6 +74,7 @@ type outboundPacket struct {
 	seqno     int
 	offset    int64
 	last      bool
+	sync      bool
 	checksums []byte
 	data      []byte
 }
@@ -96,6 +101,8 @@ func newBlockWriteStream(conn io.ReadWriter, offset int64) *blockWriteStream {
 		heartbeats: make(chan struct{}),
 	}
 
+	s.ackCond = sync.NewCond(&s.ackLock)
+
 	// Send idle heartbeats every 30 seconds.
 	go s.writeHeartbeats()
 
@@ -131,17 +138,31 @@ func (s *blockWriteStream) Write(b []byte) (int, error) {
 		return 0, err
 	}
 
+	s.throttler.wait(len(b))
 	n, _ := s.buf.Write(b)
 	err := s.flush(false)
 	return n, err
 }
 
 // finish flushes the rest of the buffered bytes, and then sends a final empty
-// packet signifying the end of the block.
+// packet signifying the end of the block. It waits for the datanodes to
+// acknowledge every packet.
 func (s *blockWriteStream) finish() error {
 	if s.closed {
 		return nil
 	}
+
+	err := s.sendLastPacket()
+	if err != nil {
+		return err
+	}
+
+	return s.waitForAcks()
+}
+
+// sendLastPacket flushes the rest of the buffered bytes, and then sends the
+// final packet, without waiting for any acks.
+func (s *blockWriteStream) sendLastPacket() error {
 	s.closed = true
 
 	// Stop sending heartbeats.
@@ -170,16 +191,16 @@ func (s *blockWriteStream) finish() error {
 		return err
 	}
 
-	// Wait for the ack loop to finish.
 	close(s.packets)
+	return nil
+}
+
+// waitForAcks waits for the ack loop to finish, after sendLastPacket.
+func (s *blockWriteStream) waitForAcks() error {
 	<-s.acksDone
 
 	// Check one more time for any ack errors.
-	if err := s.getAckError(); err != nil {
-		return err
-	}
-
-	return nil
+	return s.getAckError()
 }
 
 // flush parcels out the buffered bytes into packets, which it then flushes to
@@ -190,18 +211,85 @@ func (s *blockWriteStream) flush(force bool) error {
 	defer s.writeLock.Unlock()
 
 	for s.buf.Len() > 0 && (force || s.buf.Len() >= outboundPacketSize) {
+		err := s.sendPacket(s.makePacket())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sync flushes all the buffered bytes, and then waits for every outstanding
+// packet to be acked by the whole pipeline. If syncBlock is true, the last
+// packet asks the datanodes to persist the block to disk before acking it;
+// if there's no buffered data, an empty packet is sent to carry the flag.
+func (s *blockWriteStream) sync(syncBlock bool) error {
+	if s.closed {
+		return io.ErrClosedPipe
+	}
+
+	if err := s.getAckError(); err != nil {
+		return err
+	}
+
+	s.writeLock.Lock()
+	synced := false
+	for s.buf.Len() > 0 {
 		packet := s.makePacket()
-		s.packets <- packet.seqno
-		s.offset += int64(len(packet.data))
-		s.seqno++
+		if syncBlock && s.buf.Len() == 0 {
+			packet.sync = true
+			synced = true
+		}
 
-		err := s.writePacket(packet)
+		err := s.sendPacket(packet)
 		if err != nil {
+			s.writeLock.Unlock()
 			return err
 		}
 	}
 
-	return nil
+	if syncBlock && !synced {
+		err := s.sendPacket(outboundPacket{
+			seqno:     s.seqno,
+			offset:    s.offset,
+			sync:      true,
+			checksums: []byte{},
+			data:      []byte{},
+		})
+		if err != nil {
+			s.writeLock.Unlock()
+			return err
+		}
+	}
+
+	seqno := s.seqno - 1
+	s.writeLock.Unlock()
+
+	return s.waitForAck(seqno)
+}
+
+// sendPacket queues a packet to be acked and writes it out. It must be called
+// with writeLock held.
+func (s *blockWriteStream) sendPacket(packet outboundPacket) error {
+	s.packets <- packet.seqno
+	s.offset += int64(len(packet.data))
+	s.seqno++
+
+	return s.writePacket(packet)
+}
+
+// waitForAck blocks until the packet with the given seqno, and every one
+// before it, has been acked, or until the ack loop fails.
+func (s *blockWriteStream) waitForAck(seqno int) error {
+	s.ackLock.Lock()
+	defer s.ackLock.Unlock()
+
+	for s.ackedSeqno < seqno && s.ackError == nil {
+		s.ackCond.Wait()
+	}
+
+	return s.ackError
 }
 
 func (s *blockWriteStream) makePacket() outboundPacket {
@@ -264,7 +352,7 @@ Acks:
 			ack := &hdfs.PipelineAckProto{}
 			err := readPrefixedMessage(reader, ack)
 			if err != nil {
-				s.ackError = err
+				s.setAckError(err)
 				break Acks
 			}
 
@@ -272,7 +360,7 @@ Acks:
 
 			for i, status := range ack.GetReply() {
 				if status != hdfs.Status_SUCCESS {
-					s.ackError = ackError{status: status, seqno: seqno, pipelineIndex: i}
+					s.setAckError(ackError{status: status, seqno: seqno, pipelineIndex: i})
 					break Acks
 				}
 			}
@@ -283,9 +371,14 @@ Acks:
 		}
 
 		if seqno != p {
-			s.ackError = ErrInvalidSeqno
+			s.setAckError(ErrInvalidSeqno)
 			break Acks
 		}
+
+		s.ackLock.Lock()
+		s.ackedSeqno = seqno
+		s.ackCond.Broadcast()
+		s.ackLock.Unlock()
 	}
 
 	// Once we've seen an error, just keep reading packets off the channel (but
@@ -295,9 +388,22 @@ Acks:
 	}
 }
 
+// setAckError records an ack failure, and wakes up anyone waiting in
+// waitForAck.
+func (s *blockWriteStream) setAckError(err error) {
+	s.ackLock.Lock()
+	defer s.ackLock.Unlock()
+
+	s.ackError = err
+	s.ackCond.Broadcast()
+}
+
 func (s *blockWriteStream) getAckError() error {
 	select {
 	case <-s.acksDone:
+		s.ackLock.Lock()
+		defer s.ackLock.Unlock()
+
 		if s.ackError != nil {
 			return s.ackError
 		}
@@ -327,6 +433,10 @@ func (s *blockWriteStream) writePacket(p outboundPacket) error {
 		DataLen:           proto.Int32(int32(len(p.data))),
 	}
 
+	if p.sync {
+		headerInfo.SyncBlock = proto.Bool(true)
+	}
+
 	// Don't ask me why this doesn't include the header proto...
 	totalLength := len(p.data) + len(p.checksums) + 4
 
@@ -3,7 +3,6 @@ package transfer
 import (
 	"context"
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"time"
@@ -37,11 +36,17 @@ type BlockWriter struct {
 	// DialFunc is used to connect to the datanodes. If nil, then
 	// (&net.Dialer{}).DialContext is used.
 	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
-
-	conn     net.Conn
-	deadline time.Time
-	stream   *blockWriteStream
-	closed   bool
+	// Events, if set, is notified of the bytes written once the block is
+	// closed.
+	Events *Events
+
+	conn      net.Conn
+	address   string
+	deadline  time.Time
+	throttler *Throttler
+	stream    *blockWriteStream
+	written   int64
+	closed    bool
 }
 
 // SetDeadline sets the deadline for future Write, Flush, and Close calls. A
@@ -56,6 +61,15 @@ func (bw *BlockWriter) SetDeadline(t time.Time) error {
 	return nil
 }
 
+// SetThrottler sets a Throttler to limit the rate at which the block is
+// written, or removes the limit if t is nil.
+func (bw *BlockWriter) SetThrottler(t *Throttler) {
+	bw.throttler = t
+	if bw.stream != nil {
+		bw.stream.throttler = t
+	}
+}
+
 // Write implements io.Writer.
 //
 // Unlike BlockReader, BlockWriter currently has no ability to recover from
@@ -83,6 +97,7 @@ func (bw *BlockWriter) Write(b []byte) (int, error) {
 	// TODO: handle failures, set up recovery pipeline
 	n, err := bw.stream.Write(b)
 	bw.Offset += int64(n)
+	bw.written += int64(n)
 	if err == nil && blockFull {
 		err = ErrEndOfBlock
 	}
@@ -99,6 +114,26 @@ func (bw *BlockWriter) Flush() error {
 	return nil
 }
 
+// Hflush flushes any unwritten packets out to the datanodes, and then waits
+// for the whole pipeline to acknowledge them.
+func (bw *BlockWriter) Hflush() error {
+	if bw.stream != nil {
+		return bw.stream.sync(false)
+	}
+
+	return nil
+}
+
+// Hsync is like Hflush, but additionally asks the datanodes to persist the
+// block to disk before acknowledging it.
+func (bw *BlockWriter) Hsync() error {
+	if bw.stream != nil {
+		return bw.stream.sync(true)
+	}
+
+	return nil
+}
+
 // Close implements io.Closer. It flushes any unwritten packets out to the
 // datanode, and sends a final packet indicating the end of the block. The
 // block must still be finalized with the namenode.
@@ -111,6 +146,7 @@ func (bw *BlockWriter) Close() error {
 	if bw.stream != nil {
 		// TODO: handle failures, set up recovery pipeline
 		err := bw.stream.finish()
+		bw.Events.blockWritten(bw.address, bw.written, err)
 		if err != nil {
 			return err
 		}
@@ -119,6 +155,35 @@ func (bw *BlockWriter) Close() error {
 	return nil
 }
 
+// CloseAsync is like Close, but it doesn't wait for the datanodes to
+// acknowledge the end of the block. Instead, the result is sent on the
+// returned channel once they have, and then the connection is closed.
+func (bw *BlockWriter) CloseAsync() <-chan error {
+	bw.closed = true
+	done := make(chan error, 1)
+	if bw.stream == nil {
+		done <- nil
+		return done
+	}
+
+	err := bw.stream.sendLastPacket()
+	if err != nil {
+		bw.conn.Close()
+		bw.Events.blockWritten(bw.address, bw.written, err)
+		done <- err
+		return done
+	}
+
+	go func() {
+		err := bw.stream.waitForAcks()
+		bw.conn.Close()
+		bw.Events.blockWritten(bw.address, bw.written, err)
+		done <- err
+	}()
+
+	return done
+}
+
 func (bw *BlockWriter) connectNext() error {
 	address := getDatanodeAddress(bw.currentPipeline()[0].GetId(), bw.UseDatanodeHostname)
 
@@ -145,11 +210,13 @@ func (bw *BlockWriter) connectNext() error {
 	if err != nil {
 		return err
 	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
-		return fmt.Errorf("write failed: %s (%s)", resp.GetStatus().String(), resp.GetMessage())
+		return blockOpError("write", resp.GetStatus(), resp.GetMessage())
 	}
 
 	bw.conn = conn
+	bw.address = address
 	bw.stream = newBlockWriteStream(conn, bw.Offset)
+	bw.stream.throttler = bw.throttler
 	return nil
 }
 
@@ -1,9 +1,16 @@
 package transfer
 
 import (
+	"encoding/binary"
+	"io"
+	"net"
 	"testing"
+	"time"
 
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 func TestPacketSize(t *testing.T) {
@@ -31,3 +38,170 @@ func TestPacketSizeAlignment(t *testing.T) {
 
 	assert.EqualValues(t, outboundChunkSize-5, len(packet.data))
 }
+
+// fakeDatanode reads packets off of conn, acking each one and sending the
+// headers to the returned channel.
+func fakeDatanode(t *testing.T, conn net.Conn) chan *hdfs.PacketHeaderProto {
+	headers := make(chan *hdfs.PacketHeaderProto, 10)
+	go func() {
+		defer close(headers)
+		for {
+			lengths := make([]byte, 6)
+			_, err := io.ReadFull(conn, lengths)
+			if err != nil {
+				return
+			}
+
+			packetLength := binary.BigEndian.Uint32(lengths)
+			headerLength := binary.BigEndian.Uint16(lengths[4:])
+			b := make([]byte, int(headerLength)+int(packetLength)-4)
+			_, err = io.ReadFull(conn, b)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			header := &hdfs.PacketHeaderProto{}
+			if !assert.NoError(t, proto.Unmarshal(b[:headerLength], header)) {
+				return
+			}
+
+			headers <- header
+
+			ack, err := makePrefixedMessage(&hdfs.PipelineAckProto{
+				Seqno: header.Seqno,
+				Reply: []hdfs.Status{hdfs.Status_SUCCESS},
+			})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			_, err = conn.Write(ack)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return headers
+}
+
+func TestSyncWaitsForAcks(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	headers := fakeDatanode(t, server)
+
+	bws := newBlockWriteStream(client, 0)
+	_, err := bws.Write([]byte("foo"))
+	require.NoError(t, err)
+
+	require.NoError(t, bws.sync(false))
+	assert.EqualValues(t, 1, bws.ackedSeqno)
+
+	header := <-headers
+	assert.EqualValues(t, 3, header.GetDataLen())
+	assert.False(t, header.GetSyncBlock())
+}
+
+func TestSyncBlock(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	headers := fakeDatanode(t, server)
+
+	bws := newBlockWriteStream(client, 0)
+	_, err := bws.Write([]byte("foo"))
+	require.NoError(t, err)
+
+	require.NoError(t, bws.sync(true))
+	header := <-headers
+	assert.EqualValues(t, 3, header.GetDataLen())
+	assert.True(t, header.GetSyncBlock())
+
+	// With nothing buffered, an empty packet carries the flag.
+	require.NoError(t, bws.sync(true))
+	header = <-headers
+	assert.EqualValues(t, 0, header.GetDataLen())
+	assert.EqualValues(t, 3, header.GetOffsetInBlock())
+	assert.True(t, header.GetSyncBlock())
+}
+
+func TestCloseAsync(t *testing.T) {
+	client, server := net.Pipe()
+	headers := fakeDatanode(t, server)
+
+	bw := &BlockWriter{conn: client, stream: newBlockWriteStream(client, 0)}
+	_, err := bw.stream.Write([]byte("foo"))
+	require.NoError(t, err)
+
+	acked := bw.CloseAsync()
+	header := <-headers
+	assert.EqualValues(t, 3, header.GetDataLen())
+	header = <-headers
+	assert.True(t, header.GetLastPacketInBlock())
+
+	require.NoError(t, <-acked)
+}
+
+func TestCloseAsyncAckError(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		lengths := make([]byte, 6)
+		_, err := io.ReadFull(server, lengths)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		ack, err := makePrefixedMessage(&hdfs.PipelineAckProto{
+			Seqno: proto.Int64(1),
+			Reply: []hdfs.Status{hdfs.Status_ERROR},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		server.Write(ack)
+		io.Copy(io.Discard, server)
+	}()
+
+	bw := &BlockWriter{conn: client, stream: newBlockWriteStream(client, 0)}
+	acked := bw.CloseAsync()
+	assert.IsType(t, ackError{}, <-acked)
+}
+
+func TestCloseAsyncEvents(t *testing.T) {
+	client, server := net.Pipe()
+	fakeDatanode(t, server)
+
+	var written int64
+	bw := &BlockWriter{
+		BlockSize: 1024,
+		conn:      client,
+		address:   "foo:9866",
+		stream:    newBlockWriteStream(client, 0),
+		Events: &Events{
+			BlockWritten: func(address string, n int64, err error) {
+				assert.Equal(t, "foo:9866", address)
+				assert.NoError(t, err)
+				written = n
+			},
+		},
+	}
+
+	_, err := bw.Write([]byte("foobar"))
+	require.NoError(t, err)
+	require.NoError(t, <-bw.CloseAsync())
+	assert.EqualValues(t, 6, written)
+}
+
+func TestWriteThrottled(t *testing.T) {
+	client, server := net.Pipe()
+	fakeDatanode(t, server)
+
+	throttler, _, slept := testThrottler(100)
+	bw := &BlockWriter{BlockSize: 1024, conn: client, stream: newBlockWriteStream(client, 0)}
+	bw.SetThrottler(throttler)
+
+	_, err := bw.Write(make([]byte, 200))
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, *slept)
+	require.NoError(t, <-bw.CloseAsync())
+}
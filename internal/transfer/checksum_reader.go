@@ -21,6 +21,10 @@ type ChecksumReader struct {
 	UseDatanodeHostname bool
 	// DialFunc is used to connect to the datanodes. If nil, then (&net.Dialer{}).DialContext is used
 	DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+	// ConnCache, if set, is used to reuse idle connections to the datanodes.
+	ConnCache *ConnCache
+	// DeadNodes, if set, is used to record datanode failures.
+	DeadNodes *DeadNodeDetector
 
 	deadline  time.Time
 	datanodes *datanodeFailover
@@ -36,37 +40,57 @@ func (cr *ChecksumReader) SetDeadline(t time.Time) error {
 
 // ReadChecksum returns the checksum of the block.
 func (cr *ChecksumReader) ReadChecksum() ([]byte, error) {
-	if cr.datanodes == nil {
-		locs := cr.Block.GetLocs()
-		datanodes := make([]string, len(locs))
-		for i, loc := range locs {
-			dn := loc.GetId()
-			datanodes[i] = getDatanodeAddress(dn, cr.UseDatanodeHostname)
-		}
+	resp, err := cr.ReadBlockChecksum()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.GetBlockChecksum(), nil
+}
 
-		cr.datanodes = newDatanodeFailover(datanodes)
+// ReadBlockChecksum returns the full checksum response for the block, which
+// includes the parameters (the checksum type and the number of bytes per
+// checksum) used to calculate it.
+func (cr *ChecksumReader) ReadBlockChecksum() (*hdfs.OpBlockChecksumResponseProto, error) {
+	if cr.datanodes == nil {
+		cr.datanodes = newDatanodeFailover(cr.Block.GetLocs(), cr.UseDatanodeHostname, cr.DeadNodes, nil)
 	}
 
 	for cr.datanodes.numRemaining() > 0 {
 		address := cr.datanodes.next()
-		checksum, err := cr.readChecksum(address)
+		resp, err := cr.readChecksum(address)
 		if err != nil {
 			cr.datanodes.recordFailure(err)
+			if isAccessError(err) {
+				return nil, err
+			}
+
 			continue
 		}
 
-		return checksum, nil
+		return resp, nil
 	}
 
 	err := cr.datanodes.lastError()
-	if err != nil {
+	if err == nil {
 		err = errors.New("No available datanodes for block.")
 	}
 
 	return nil, err
 }
 
-func (cr *ChecksumReader) readChecksum(address string) ([]byte, error) {
+func (cr *ChecksumReader) readChecksum(address string) (*hdfs.OpBlockChecksumResponseProto, error) {
+	// As with BlockReader, an idle connection may have been closed by the
+	// datanode, so we fall back to a new one if it fails.
+	if conn := cr.ConnCache.Get(address); conn != nil {
+		resp, err := cr.readChecksumFrom(conn, address)
+		if err == nil {
+			return resp, nil
+		}
+
+		conn.Close()
+	}
+
 	if cr.DialFunc == nil {
 		cr.DialFunc = (&net.Dialer{}).DialContext
 	}
@@ -76,7 +100,19 @@ func (cr *ChecksumReader) readChecksum(address string) ([]byte, error) {
 		return nil, err
 	}
 
-	err = conn.SetDeadline(cr.deadline)
+	resp, err := cr.readChecksumFrom(conn, address)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// readChecksumFrom requests the checksum over conn. If it succeeds, the
+// connection is returned to the cache.
+func (cr *ChecksumReader) readChecksumFrom(conn net.Conn, address string) (*hdfs.OpBlockChecksumResponseProto, error) {
+	err := conn.SetDeadline(cr.deadline)
 	if err != nil {
 		return nil, err
 	}
@@ -87,11 +123,19 @@ func (cr *ChecksumReader) readChecksum(address string) ([]byte, error) {
 	}
 
 	resp, err := cr.readBlockChecksumResponse(conn)
+	if err != nil {
+		return nil, err
+	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
+		return nil, blockOpError("checksum", resp.GetStatus(), resp.GetMessage())
+	}
+
+	err = conn.SetDeadline(time.Time{})
 	if err != nil {
 		return nil, err
 	}
 
-	return resp.GetChecksumResponse().GetBlockChecksum(), nil
+	cr.ConnCache.Put(address, conn)
+	return resp.GetChecksumResponse(), nil
 }
 
 // A checksum request to a datanode:
@@ -0,0 +1,198 @@
+package transfer
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultConnCacheCapacity is used if a ConnCache is created with a zero
+	// capacity. It matches the default for dfs.client.socketcache.capacity.
+	DefaultConnCacheCapacity = 16
+	// DefaultConnCacheExpiry is used if a ConnCache is created with a zero
+	// expiry. It matches the default for dfs.client.socketcache.expiryMsec,
+	// and is a bit shorter than the time datanodes keep idle connections
+	// open for (dfs.datanode.socket.reuse.keepalive).
+	DefaultConnCacheExpiry = 3 * time.Second
+)
+
+// ConnCache keeps idle datanode connections around, so that they can be reused
+// for the next operation against the same datanode instead of dialing (and
+// possibly doing a SASL handshake) again. It's meant to be shared between all
+// the BlockReaders and ChecksumReaders for a client, like the PeerCache used by
+// the Java client.
+//
+// A nil *ConnCache is valid, and never caches anything.
+type ConnCache struct {
+	// Capacity is the maximum number of idle connections to keep.
+	Capacity int
+	// Expiry is how long a connection can sit idle before it's closed.
+	Expiry time.Duration
+
+	conns  map[string][]cachedConn
+	count  int
+	closed bool
+	lock   sync.Mutex
+}
+
+type cachedConn struct {
+	conn  net.Conn
+	added time.Time
+}
+
+// NewConnCache creates a ConnCache holding up to capacity connections, each
+// for no longer than expiry.
+func NewConnCache(capacity int, expiry time.Duration) *ConnCache {
+	return &ConnCache{
+		Capacity: capacity,
+		Expiry:   expiry,
+		conns:    make(map[string][]cachedConn),
+	}
+}
+
+// Get returns an idle connection to the given address, or nil if there isn't
+// one.
+func (c *ConnCache) Get(address string) net.Conn {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.evictExpired()
+
+	conns := c.conns[address]
+	if len(conns) == 0 {
+		return nil
+	}
+
+	// Use the most recently added connection, since it's the least likely to
+	// have been closed on the other end.
+	cc := conns[len(conns)-1]
+	c.remove(address, len(conns)-1)
+	return cc.conn
+}
+
+// Put adds an idle connection to the cache. If the cache is full, the oldest
+// connection is closed to make room.
+func (c *ConnCache) Put(address string, conn net.Conn) {
+	if c == nil {
+		conn.Close()
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		conn.Close()
+		return
+	}
+
+	c.evictExpired()
+	if c.count >= c.capacity() {
+		c.evictOldest()
+	}
+
+	if c.conns == nil {
+		c.conns = make(map[string][]cachedConn)
+	}
+
+	c.conns[address] = append(c.conns[address], cachedConn{conn: conn, added: time.Now()})
+	c.count++
+}
+
+// Close closes all the cached connections. Connections added afterwards are
+// closed immediately.
+func (c *ConnCache) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, conns := range c.conns {
+		for _, cc := range conns {
+			cc.conn.Close()
+		}
+	}
+
+	c.conns = make(map[string][]cachedConn)
+	c.count = 0
+	c.closed = true
+	return nil
+}
+
+func (c *ConnCache) capacity() int {
+	if c.Capacity <= 0 {
+		return DefaultConnCacheCapacity
+	}
+
+	return c.Capacity
+}
+
+func (c *ConnCache) expiry() time.Duration {
+	if c.Expiry <= 0 {
+		return DefaultConnCacheExpiry
+	}
+
+	return c.Expiry
+}
+
+// evictExpired closes any connections that have been idle for too long. It
+// must be called with the lock held.
+func (c *ConnCache) evictExpired() {
+	cutoff := time.Now().Add(-c.expiry())
+	for address, conns := range c.conns {
+		// Connections for each address are kept in the order they were added.
+		i := 0
+		for i < len(conns) && conns[i].added.Before(cutoff) {
+			conns[i].conn.Close()
+			i++
+		}
+
+		if i > 0 {
+			c.count -= i
+			if i == len(conns) {
+				delete(c.conns, address)
+			} else {
+				c.conns[address] = conns[i:]
+			}
+		}
+	}
+}
+
+// evictOldest closes the connection that has been idle the longest. It must be
+// called with the lock held.
+func (c *ConnCache) evictOldest() {
+	var oldestAddress string
+	var oldest time.Time
+	for address, conns := range c.conns {
+		if len(conns) > 0 && (oldest.IsZero() || conns[0].added.Before(oldest)) {
+			oldestAddress = address
+			oldest = conns[0].added
+		}
+	}
+
+	if conns, ok := c.conns[oldestAddress]; ok {
+		conns[0].conn.Close()
+		c.remove(oldestAddress, 0)
+	}
+}
+
+// remove takes a connection out of the cache, without closing it. It must be
+// called with the lock held.
+func (c *ConnCache) remove(address string, i int) {
+	conns := c.conns[address]
+	conns = append(conns[:i:i], conns[i+1:]...)
+	if len(conns) == 0 {
+		delete(c.conns, address)
+	} else {
+		c.conns[address] = conns
+	}
+
+	c.count--
+}
@@ -0,0 +1,200 @@
+package transfer
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestConnCache(t *testing.T) {
+	cache := NewConnCache(2, time.Minute)
+	assert.Nil(t, cache.Get("foo:9866"))
+
+	a, _ := net.Pipe()
+	b, _ := net.Pipe()
+	cache.Put("foo:9866", a)
+	cache.Put("foo:9866", b)
+
+	assert.Equal(t, b, cache.Get("foo:9866"))
+	assert.Equal(t, a, cache.Get("foo:9866"))
+	assert.Nil(t, cache.Get("foo:9866"))
+}
+
+func TestConnCacheCapacity(t *testing.T) {
+	cache := NewConnCache(2, time.Minute)
+
+	a, aServer := net.Pipe()
+	b, _ := net.Pipe()
+	c, _ := net.Pipe()
+	cache.Put("foo:9866", a)
+	cache.Put("bar:9866", b)
+	cache.Put("baz:9866", c)
+
+	// The oldest connection should have been closed to make room.
+	_, err := aServer.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, cache.Get("foo:9866"))
+	assert.Equal(t, b, cache.Get("bar:9866"))
+	assert.Equal(t, c, cache.Get("baz:9866"))
+}
+
+func TestConnCacheExpiry(t *testing.T) {
+	cache := NewConnCache(2, 10*time.Millisecond)
+
+	a, aServer := net.Pipe()
+	cache.Put("foo:9866", a)
+	time.Sleep(20 * time.Millisecond)
+
+	assert.Nil(t, cache.Get("foo:9866"))
+	_, err := aServer.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestConnCacheClose(t *testing.T) {
+	cache := NewConnCache(2, time.Minute)
+
+	a, aServer := net.Pipe()
+	cache.Put("foo:9866", a)
+	require.NoError(t, cache.Close())
+
+	_, err := aServer.Read(make([]byte, 1))
+	assert.Equal(t, io.EOF, err)
+	assert.Nil(t, cache.Get("foo:9866"))
+}
+
+func TestBlockReaderReusesConn(t *testing.T) {
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	statuses := make(chan hdfs.Status, 2)
+	dials := 0
+	dialFunc := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dials++
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			for i := 0; i < 2; i++ {
+				respondBlockRead(t, server, data)
+
+				// The status message is too short for readPrefixedMessage.
+				b := make([]byte, 3)
+				_, err := io.ReadFull(server, b)
+				require.NoError(t, err)
+
+				status := &hdfs.ClientReadStatusProto{}
+				require.NoError(t, proto.Unmarshal(b[1:1+b[0]], status))
+				statuses <- status.GetStatus()
+			}
+		}()
+
+		return client, nil
+	}
+
+	cache := NewConnCache(0, 0)
+	for _, offset := range []int64{0, 512} {
+		br := &BlockReader{
+			Block:     testBlock("reuse"),
+			Offset:    offset,
+			DialFunc:  dialFunc,
+			ConnCache: cache,
+		}
+
+		b, err := io.ReadAll(br)
+		require.NoError(t, err)
+		assert.Equal(t, data[offset:], b)
+		require.NoError(t, br.Close())
+		assert.Equal(t, hdfs.Status_SUCCESS, <-statuses)
+	}
+
+	assert.Equal(t, 1, dials)
+}
+
+func TestBlockReaderStaleConn(t *testing.T) {
+	data := make([]byte, 1024)
+	stale, staleServer := net.Pipe()
+	staleServer.Close()
+
+	cache := NewConnCache(0, 0)
+	cache.Put("stale:9866", stale)
+
+	br := &BlockReader{
+		Block: testBlock("stale"),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveBlockRead(t, server, data)
+			return client, nil
+		},
+		ConnCache: cache,
+	}
+
+	b, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, data, b)
+}
+
+func TestBlockReaderDoesntReusePartialRead(t *testing.T) {
+	data := make([]byte, 1024)
+	cache := NewConnCache(0, 0)
+
+	br := &BlockReader{
+		Block: testBlock("partial"),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go serveBlockRead(t, server, data)
+			return client, nil
+		},
+		ConnCache: cache,
+	}
+
+	_, err := br.Read(make([]byte, 512))
+	require.NoError(t, err)
+	require.NoError(t, br.Close())
+	assert.Nil(t, cache.Get("partial:9866"))
+}
+
+func TestBlockReaderReusesConnAfterSkip(t *testing.T) {
+	data := make([]byte, 1024)
+	statuses := make(chan hdfs.Status, 1)
+	cache := NewConnCache(0, 0)
+
+	br := &BlockReader{
+		Block: testBlock("skip"),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer server.Close()
+				respondBlockRead(t, server, data)
+
+				b := make([]byte, 3)
+				if _, err := io.ReadFull(server, b); assert.NoError(t, err) {
+					status := &hdfs.ClientReadStatusProto{}
+					assert.NoError(t, proto.Unmarshal(b[1:1+b[0]], status))
+					statuses <- status.GetStatus()
+				}
+			}()
+
+			return client, nil
+		},
+		ConnCache: cache,
+	}
+
+	_, err := io.ReadFull(br, make([]byte, 512))
+	require.NoError(t, err)
+	require.NoError(t, br.Skip(256))
+	assert.EqualValues(t, 768, br.Offset)
+
+	_, err = io.ReadFull(br, make([]byte, 256))
+	require.NoError(t, err)
+	require.NoError(t, br.Close())
+	assert.Equal(t, hdfs.Status_SUCCESS, <-statuses)
+	assert.NotNil(t, cache.Get("skip:9866"))
+}
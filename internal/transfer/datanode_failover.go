@@ -1,35 +1,56 @@
 package transfer
 
 import (
-	"sync"
 	"time"
-)
 
-// datanodeFailures is a global map of address to the last recorded failure
-var datanodeFailures = make(map[string]time.Time)
-var datanodeFailuresLock sync.Mutex
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
 
 // a datanodeFailover provides some common code for trying multiple datanodes
-// in the context of a single operation on a single block.
+// in the context of a single operation on a single block. Failures are
+// recorded with the DeadNodeDetector, so that later operations (even for
+// different blocks) prioritize the failed datanodes lower.
 type datanodeFailover struct {
 	datanodes       []string
+	ids             map[string]*hdfs.DatanodeIDProto
+	deadNodes       *DeadNodeDetector
+	events          *Events
 	currentDatanode string
 	err             error
 }
 
-func newDatanodeFailover(datanodes []string) *datanodeFailover {
+func newDatanodeFailover(locs []*hdfs.DatanodeInfoProto, useHostname bool, deadNodes *DeadNodeDetector, events *Events) *datanodeFailover {
+	datanodes := make([]string, len(locs))
+	ids := make(map[string]*hdfs.DatanodeIDProto, len(locs))
+	for i, loc := range locs {
+		address := getDatanodeAddress(loc.GetId(), useHostname)
+		datanodes[i] = address
+		ids[address] = loc.GetId()
+	}
+
 	return &datanodeFailover{
 		datanodes:       datanodes,
+		ids:             ids,
+		deadNodes:       deadNodes,
+		events:          events,
 		currentDatanode: "",
 		err:             nil,
 	}
 }
 
 func (df *datanodeFailover) recordFailure(err error) {
-	datanodeFailuresLock.Lock()
-	defer datanodeFailuresLock.Unlock()
+	df.recordFailureAt(df.currentDatanode, err)
+}
+
+// recordFailureAt is like recordFailure, but for a datanode other than the
+// current one, for when several are in use at once.
+func (df *datanodeFailover) recordFailureAt(address string, err error) {
+	// If our credentials were rejected, it's not the datanode's fault.
+	if !isAccessError(err) {
+		df.deadNodes.recordFailure(address, df.ids[address])
+	}
 
-	datanodeFailures[df.currentDatanode] = time.Now()
+	df.events.readFailed(address, err, !isAccessError(err) && df.numRemaining() > 0)
 	df.err = err
 }
 
@@ -42,9 +63,7 @@ func (df *datanodeFailover) next() string {
 	var oldestFailure time.Time
 
 	for i, address := range df.datanodes {
-		datanodeFailuresLock.Lock()
-		failedAt, hasFailed := datanodeFailures[address]
-		datanodeFailuresLock.Unlock()
+		failedAt, hasFailed := df.deadNodes.failedAt(address)
 
 		if !hasFailed {
 			picked = i
@@ -8,21 +8,70 @@ import (
 )
 
 func TestPicksFirstDatanode(t *testing.T) {
-	df := newDatanodeFailover([]string{"foo:6000", "bar:6000"})
-	assert.EqualValues(t, df.next(), "foo:6000")
+	df := newDatanodeFailover(testBlock("foo", "bar").GetLocs(), false, &DeadNodeDetector{}, nil)
+	assert.EqualValues(t, df.next(), "foo:9866")
 }
 
 func TestPicksDatanodesWithoutFailures(t *testing.T) {
-	df := newDatanodeFailover([]string{"foo:6000", "foo:7000", "bar:6000"})
-	datanodeFailures["foo:6000"] = time.Now()
+	deadNodes := &DeadNodeDetector{}
+	df := newDatanodeFailover(testBlock("foo", "baz", "bar").GetLocs(), false, deadNodes, nil)
+	deadNodes.recordFailure("foo:9866", nil)
 
-	assert.EqualValues(t, df.next(), "foo:7000")
+	assert.EqualValues(t, df.next(), "baz:9866")
 }
 
 func TestPicksDatanodesWithOldestFailures(t *testing.T) {
-	df := newDatanodeFailover([]string{"foo:6000", "bar:6000"})
-	datanodeFailures["foo:6000"] = time.Now().Add(-10 * time.Minute)
-	datanodeFailures["bar:6000"] = time.Now()
+	deadNodes := &DeadNodeDetector{}
+	df := newDatanodeFailover(testBlock("foo", "bar").GetLocs(), false, deadNodes, nil)
+	deadNodes.nodes = map[string]deadNode{
+		"foo:9866": {failedAt: time.Now().Add(-5 * time.Minute)},
+		"bar:9866": {failedAt: time.Now()},
+	}
 
-	assert.EqualValues(t, df.next(), "foo:6000")
+	assert.EqualValues(t, df.next(), "foo:9866")
+}
+
+func TestForgetsExpiredFailures(t *testing.T) {
+	deadNodes := &DeadNodeDetector{Expiry: time.Minute}
+	df := newDatanodeFailover(testBlock("foo", "bar").GetLocs(), false, deadNodes, nil)
+	deadNodes.nodes = map[string]deadNode{
+		"foo:9866": {failedAt: time.Now().Add(-5 * time.Minute)},
+	}
+
+	assert.EqualValues(t, df.next(), "foo:9866")
+	assert.Empty(t, deadNodes.DeadNodes())
+}
+
+func TestRecordsFailuresPerDetector(t *testing.T) {
+	first := &DeadNodeDetector{}
+	second := &DeadNodeDetector{}
+
+	df := newDatanodeFailover(testBlock("foo", "bar").GetLocs(), false, first, nil)
+	assert.EqualValues(t, df.next(), "foo:9866")
+	df.recordFailure(assert.AnError)
+
+	assert.Contains(t, first.DeadNodes(), "foo:9866")
+	assert.Empty(t, second.DeadNodes())
+	assert.EqualValues(t, "foo:9866", newDatanodeFailover(testBlock("foo", "bar").GetLocs(), false, second, nil).next())
+	assert.EqualValues(t, "bar:9866", newDatanodeFailover(testBlock("foo", "bar").GetLocs(), false, first, nil).next())
+}
+
+func TestReportsFailureEvents(t *testing.T) {
+	var checksumFailures, retries []string
+	events := &Events{
+		ChecksumFailure: func(address string) { checksumFailures = append(checksumFailures, address) },
+		Retry:           func(address string, err error) { retries = append(retries, address) },
+	}
+
+	df := newDatanodeFailover(testBlock("foo", "bar").GetLocs(), false, &DeadNodeDetector{}, events)
+	df.next()
+	df.recordFailure(errInvalidChecksum)
+	assert.Equal(t, []string{"foo:9866"}, checksumFailures)
+	assert.Equal(t, []string{"foo:9866"}, retries)
+
+	// There's nothing left to retry against.
+	df.next()
+	df.recordFailure(assert.AnError)
+	assert.Equal(t, []string{"foo:9866"}, checksumFailures)
+	assert.Equal(t, []string{"foo:9866"}, retries)
 }
@@ -0,0 +1,244 @@
+package transfer
+
+import (
+	"sync"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+const (
+	// DefaultDeadNodeExpiry is used if a DeadNodeDetector is created with a
+	// zero expiry.
+	DefaultDeadNodeExpiry = 10 * time.Minute
+	// DefaultDeadNodeProbeInterval is used if a DeadNodeDetector is created
+	// with a zero probe interval. It matches the default for
+	// dfs.client.deadnode.detection.probe.deadnode.interval.ms.
+	DefaultDeadNodeProbeInterval = 60 * time.Second
+)
+
+// DeadNodeDetector keeps track of datanodes that have recently failed, so
+// that later operations try other replicas first. It's meant to be shared
+// between all the BlockReaders and ChecksumReaders for a client.
+//
+// Failures are forgotten once they're older than Expiry. If Probe is set, the
+// failed datanodes are also checked on in the background, and forgotten as
+// soon as they seem healthy again.
+//
+// A nil *DeadNodeDetector is valid, and never records anything.
+type DeadNodeDetector struct {
+	// Expiry is how long a failure counts against a datanode.
+	Expiry time.Duration
+	// Probe, if set, is used to check whether a failed datanode is healthy
+	// again. It should return nil if it is.
+	Probe func(datanode *hdfs.DatanodeIDProto) error
+	// ProbeInterval is how often the failed datanodes are probed.
+	ProbeInterval time.Duration
+
+	nodes   map[string]deadNode
+	probing bool
+	closed  bool
+	done    chan struct{}
+	lock    sync.Mutex
+}
+
+type deadNode struct {
+	id       *hdfs.DatanodeIDProto
+	failedAt time.Time
+}
+
+// NewDeadNodeDetector creates a DeadNodeDetector that forgets failures after
+// expiry. If probe is non-nil, it's called every probeInterval for each failed
+// datanode.
+func NewDeadNodeDetector(expiry time.Duration, probe func(*hdfs.DatanodeIDProto) error,
+	probeInterval time.Duration) *DeadNodeDetector {
+	return &DeadNodeDetector{
+		Expiry:        expiry,
+		Probe:         probe,
+		ProbeInterval: probeInterval,
+	}
+}
+
+// DeadNodes returns the address of each datanode that has failed recently,
+// along with the time of its latest failure.
+func (d *DeadNodeDetector) DeadNodes() map[string]time.Time {
+	res := make(map[string]time.Time)
+	if d == nil {
+		return res
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.evictExpired()
+	for address, node := range d.nodes {
+		res[address] = node.failedAt
+	}
+
+	return res
+}
+
+// Clear forgets any failures for the datanode at address.
+func (d *DeadNodeDetector) Clear(address string) {
+	if d == nil {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delete(d.nodes, address)
+}
+
+// ClearAll forgets all recorded failures.
+func (d *DeadNodeDetector) ClearAll() {
+	if d == nil {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.nodes = nil
+}
+
+// Close stops any background probing. Failures can still be recorded
+// afterwards, but they're only forgotten once they expire.
+func (d *DeadNodeDetector) Close() error {
+	if d == nil {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.closed {
+		d.closed = true
+		if d.done != nil {
+			close(d.done)
+		}
+	}
+
+	return nil
+}
+
+// recordFailure marks the datanode at address as dead, and starts probing it
+// if need be.
+func (d *DeadNodeDetector) recordFailure(address string, id *hdfs.DatanodeIDProto) {
+	if d == nil {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.nodes == nil {
+		d.nodes = make(map[string]deadNode)
+	}
+
+	d.nodes[address] = deadNode{id: id, failedAt: time.Now()}
+	if d.Probe != nil && !d.probing && !d.closed {
+		if d.done == nil {
+			d.done = make(chan struct{})
+		}
+
+		d.probing = true
+		go d.probeLoop()
+	}
+}
+
+// failedAt returns the time of the most recent failure for the datanode at
+// address, if there was one.
+func (d *DeadNodeDetector) failedAt(address string) (time.Time, bool) {
+	if d == nil {
+		return time.Time{}, false
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.evictExpired()
+	node, ok := d.nodes[address]
+	return node.failedAt, ok
+}
+
+func (d *DeadNodeDetector) expiry() time.Duration {
+	if d.Expiry <= 0 {
+		return DefaultDeadNodeExpiry
+	}
+
+	return d.Expiry
+}
+
+func (d *DeadNodeDetector) probeInterval() time.Duration {
+	if d.ProbeInterval <= 0 {
+		return DefaultDeadNodeProbeInterval
+	}
+
+	return d.ProbeInterval
+}
+
+// evictExpired forgets any failures older than the expiry. It must be called
+// with the lock held.
+func (d *DeadNodeDetector) evictExpired() {
+	cutoff := time.Now().Add(-d.expiry())
+	for address, node := range d.nodes {
+		if node.failedAt.Before(cutoff) {
+			delete(d.nodes, address)
+		}
+	}
+}
+
+// probeLoop periodically probes the dead datanodes, until there aren't any
+// left or the DeadNodeDetector is closed.
+func (d *DeadNodeDetector) probeLoop() {
+	ticker := time.NewTicker(d.probeInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		if !d.probeDeadNodes() {
+			return
+		}
+	}
+}
+
+// probeDeadNodes probes each dead datanode once, and clears the ones that are
+// healthy. It returns false if there was nothing left to probe.
+func (d *DeadNodeDetector) probeDeadNodes() bool {
+	d.lock.Lock()
+	d.evictExpired()
+	if len(d.nodes) == 0 || d.closed {
+		d.probing = false
+		d.lock.Unlock()
+		return false
+	}
+
+	nodes := make(map[string]deadNode, len(d.nodes))
+	for address, node := range d.nodes {
+		nodes[address] = node
+	}
+
+	d.lock.Unlock()
+
+	for address, node := range nodes {
+		if node.id == nil || d.Probe(node.id) != nil {
+			continue
+		}
+
+		// Don't clear the datanode if it failed again while we were probing.
+		d.lock.Lock()
+		if current, ok := d.nodes[address]; ok && !current.failedAt.After(node.failedAt) {
+			delete(d.nodes, address)
+		}
+
+		d.lock.Unlock()
+	}
+
+	return true
+}
@@ -0,0 +1,81 @@
+package transfer
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadNodeDetectorClear(t *testing.T) {
+	d := NewDeadNodeDetector(0, nil, 0)
+	d.recordFailure("foo:9866", nil)
+	d.recordFailure("bar:9866", nil)
+	require.Len(t, d.DeadNodes(), 2)
+
+	d.Clear("foo:9866")
+	assert.NotContains(t, d.DeadNodes(), "foo:9866")
+	assert.Contains(t, d.DeadNodes(), "bar:9866")
+
+	d.ClearAll()
+	assert.Empty(t, d.DeadNodes())
+}
+
+func TestDeadNodeDetectorNil(t *testing.T) {
+	var d *DeadNodeDetector
+	d.recordFailure("foo:9866", nil)
+	_, failed := d.failedAt("foo:9866")
+	assert.False(t, failed)
+	assert.Empty(t, d.DeadNodes())
+	assert.NoError(t, d.Close())
+}
+
+func TestDeadNodeDetectorProbe(t *testing.T) {
+	var healthy atomic.Bool
+	var probes atomic.Int32
+	d := NewDeadNodeDetector(time.Hour, func(id *hdfs.DatanodeIDProto) error {
+		probes.Add(1)
+		assert.Equal(t, "foo", id.GetHostName())
+		if !healthy.Load() {
+			return errors.New("still dead")
+		}
+
+		return nil
+	}, 10*time.Millisecond)
+	defer d.Close()
+
+	d.recordFailure("foo:9866", testBlock("foo").GetLocs()[0].GetId())
+	assert.Eventually(t, func() bool { return probes.Load() >= 2 }, time.Second, time.Millisecond)
+	assert.Contains(t, d.DeadNodes(), "foo:9866")
+
+	healthy.Store(true)
+	assert.Eventually(t, func() bool { return len(d.DeadNodes()) == 0 }, time.Second, time.Millisecond)
+
+	// The probe loop should stop once there's nothing left to probe.
+	assert.Eventually(t, func() bool {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		return !d.probing
+	}, time.Second, time.Millisecond)
+}
+
+func TestDeadNodeDetectorClose(t *testing.T) {
+	var probes atomic.Int32
+	d := NewDeadNodeDetector(time.Hour, func(id *hdfs.DatanodeIDProto) error {
+		probes.Add(1)
+		return errors.New("dead")
+	}, 10*time.Millisecond)
+
+	d.recordFailure("foo:9866", testBlock("foo").GetLocs()[0].GetId())
+	assert.Eventually(t, func() bool { return probes.Load() >= 1 }, time.Second, time.Millisecond)
+	require.NoError(t, d.Close())
+
+	time.Sleep(20 * time.Millisecond)
+	n := probes.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, n, probes.Load())
+}
@@ -200,18 +200,14 @@ func chooseCipher(options []string) string {
 		s[c] = true
 	}
 
-	// TODO: Support 3DES
-
-	switch {
-	case s["rc4"]:
+	// TODO: Support 3DES, and the reduced-strength rc4-56 and rc4-40, which
+	// need the RC4 key truncated. Until then, offering them would mean
+	// claiming a cipher we don't actually use.
+	if s["rc4"] {
 		return "rc4"
-	case s["rc4-56"]:
-		return "rc4-56"
-	case s["rc4-40"]:
-		return "rc4-40"
-	default:
-		return ""
 	}
+
+	return ""
 }
 
 func lenEncodeBytes(seqnum int) (out [4]byte) {
@@ -16,6 +16,7 @@ import (
 
 type digestMD5PrivacyConn struct {
 	conn         net.Conn
+	cipher       string
 	readDeadline time.Time
 
 	sendSeqNum int
@@ -33,12 +34,13 @@ type digestMD5PrivacyConn struct {
 
 // digestMD5PrivacyConn returns a net.Conn wrapper that peforms md5-digest
 // encryption on data passing over it.
-func newDigestMD5PrivacyConn(conn net.Conn, kic, kis, kcc, kcs []byte) digestMD5Conn {
+func newDigestMD5PrivacyConn(conn net.Conn, cipher string, kic, kis, kcc, kcs []byte) digestMD5Conn {
 	encryptor, _ := rc4.NewCipher(kcc)
 	decryptor, _ := rc4.NewCipher(kcs)
 
 	return &digestMD5PrivacyConn{
 		conn:      conn,
+		cipher:    cipher,
 		encryptor: encryptor,
 		decryptor: decryptor,
 		decodeMAC: hmac.New(md5.New, kis),
@@ -2,6 +2,7 @@ package transfer
 
 import (
 	"encoding/binary"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -196,7 +197,7 @@ func TestDigestMD5Conn(t *testing.T) {
 	require.NoError(t, err)
 	defer wrapped.Close()
 
-	require.NoError(t, err)
+	assert.Equal(t, CipherAESCTRNoPadding, NegotiatedCipher(wrapped))
 
 	// Send an encrypted value.
 	n, err := wrapped.Write([]byte{0xDE, 0xAD, 0xBE, 0xEF})
@@ -205,3 +206,32 @@ func TestDigestMD5Conn(t *testing.T) {
 
 	<-serverDone
 }
+
+func TestSaslUnknownKey(t *testing.T) {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		// The magic number, followed by an empty message.
+		io.ReadFull(server, make([]byte, 7))
+
+		resp, _ := makePrefixedMessage(&hdfs.DataTransferEncryptorMessageProto{
+			Status:  hdfs.DataTransferEncryptorMessageProto_ERROR_UNKNOWN_KEY.Enum(),
+			Message: proto.String("Can't re-compute encryption key for nonce, since the required block key (keyID=1) doesn't exist."),
+		})
+		server.Write(resp)
+	}()
+
+	d := &SaslDialer{
+		Token: testBlock("foo").GetBlockToken(),
+		Key:   &hdfs.DataEncryptionKeyProto{Nonce: []byte("nonce"), EncryptionKey: []byte("key")},
+	}
+
+	_, err := d.wrapDatanodeConn(client)
+	assert.ErrorIs(t, err, ErrInvalidEncryptionKey)
+}
+
+func TestChooseCipher(t *testing.T) {
+	assert.Equal(t, "rc4", chooseCipher([]string{"3des", "rc4", "des", "rc4-56", "rc4-40"}))
+	assert.Equal(t, "", chooseCipher([]string{"rc4-56", "rc4-40"}))
+	assert.Equal(t, "", chooseCipher(nil))
+}
@@ -0,0 +1,53 @@
+package transfer
+
+import (
+	"errors"
+)
+
+// Events holds optional callbacks that a BlockReader or BlockWriter calls as
+// it talks to datanodes, so that the client can collect metrics. Any of them
+// may be nil, as may the Events itself. The address is empty for short-circuit
+// reads.
+type Events struct {
+	// BlockRead is called when a BlockReader is closed, with the number of
+	// bytes that were read from the block, and the datanode the last of them
+	// came from.
+	BlockRead func(address string, n int64)
+	// BlockWritten is called when a BlockWriter is closed, with the number of
+	// bytes written to the block, and the result of closing it.
+	BlockWritten func(address string, n int64, err error)
+	// ChecksumFailure is called when data from a datanode doesn't match its
+	// checksum.
+	ChecksumFailure func(address string)
+	// Retry is called when a read from a datanode fails, and another datanode
+	// is going to be tried.
+	Retry func(address string, err error)
+}
+
+func (e *Events) blockRead(address string, n int64) {
+	if e != nil && e.BlockRead != nil {
+		e.BlockRead(address, n)
+	}
+}
+
+func (e *Events) blockWritten(address string, n int64, err error) {
+	if e != nil && e.BlockWritten != nil {
+		e.BlockWritten(address, n, err)
+	}
+}
+
+// readFailed reports a failed read from a datanode, which will be retried
+// against another one if retry is true.
+func (e *Events) readFailed(address string, err error, retry bool) {
+	if e == nil {
+		return
+	}
+
+	if e.ChecksumFailure != nil && errors.Is(err, errInvalidChecksum) {
+		e.ChecksumFailure(address)
+	}
+
+	if e.Retry != nil && retry {
+		e.Retry(address, err)
+	}
+}
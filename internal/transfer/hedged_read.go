@@ -0,0 +1,51 @@
+package transfer
+
+import "time"
+
+// DefaultHedgedReadThreshold is used if a HedgedReadPool is created with a
+// zero threshold. It matches the default for
+// dfs.client.hedged.read.threshold.millis.
+const DefaultHedgedReadThreshold = 500 * time.Millisecond
+
+// HedgedReadPool limits the number of hedged reads in flight at once. It's
+// meant to be shared between all the BlockReaders for a client, like the
+// thread pool used by the Java client.
+type HedgedReadPool struct {
+	// Threshold is how long to wait for a datanode before starting a hedged
+	// read against another one.
+	Threshold time.Duration
+
+	slots chan struct{}
+}
+
+// NewHedgedReadPool creates a HedgedReadPool allowing up to size concurrent
+// hedged reads.
+func NewHedgedReadPool(size int, threshold time.Duration) *HedgedReadPool {
+	return &HedgedReadPool{
+		Threshold: threshold,
+		slots:     make(chan struct{}, size),
+	}
+}
+
+func (p *HedgedReadPool) threshold() time.Duration {
+	if p.Threshold <= 0 {
+		return DefaultHedgedReadThreshold
+	}
+
+	return p.Threshold
+}
+
+// acquire reserves a slot for a hedged read, returning false if the pool is
+// exhausted.
+func (p *HedgedReadPool) acquire() bool {
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *HedgedReadPool) release() {
+	<-p.slots
+}
@@ -0,0 +1,155 @@
+package transfer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	hadoop "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_common"
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// serveBlockRead responds to a single read request on conn with data from
+// the block, without checksums.
+func serveBlockRead(t *testing.T, conn net.Conn, block []byte) {
+	defer conn.Close()
+	respondBlockRead(t, conn, block)
+}
+
+// respondBlockRead reads a single read request from conn, and responds to it
+// with data from the block, without checksums.
+func respondBlockRead(t *testing.T, conn net.Conn, block []byte) {
+	header := make([]byte, 3)
+	_, err := io.ReadFull(conn, header)
+	require.NoError(t, err)
+
+	op := &hdfs.OpReadBlockProto{}
+	require.NoError(t, readPrefixedMessage(conn, op))
+
+	resp, err := makePrefixedMessage(&hdfs.BlockOpResponseProto{
+		Status: hdfs.Status_SUCCESS.Enum(),
+		ReadOpChecksumInfo: &hdfs.ReadOpChecksumInfoProto{
+			Checksum: &hdfs.ChecksumProto{
+				Type:             hdfs.ChecksumTypeProto_CHECKSUM_NULL.Enum(),
+				BytesPerChecksum: proto.Uint32(512),
+			},
+			ChunkOffset: op.Offset,
+		},
+	})
+	require.NoError(t, err)
+
+	start := op.GetOffset()
+	data := block[start : start+op.GetLen()]
+	packetHeader, err := proto.Marshal(&hdfs.PacketHeaderProto{
+		OffsetInBlock:     proto.Int64(int64(start)),
+		Seqno:             proto.Int64(0),
+		LastPacketInBlock: proto.Bool(true),
+		DataLen:           proto.Int32(int32(len(data))),
+	})
+	require.NoError(t, err)
+
+	lengths := make([]byte, 6)
+	binary.BigEndian.PutUint32(lengths, uint32(len(data)+4))
+	binary.BigEndian.PutUint16(lengths[4:], uint16(len(packetHeader)))
+
+	packet := append(resp, lengths...)
+	packet = append(packet, packetHeader...)
+	packet = append(packet, data...)
+	conn.Write(packet)
+}
+
+func testBlock(addresses ...string) *hdfs.LocatedBlockProto {
+	locs := make([]*hdfs.DatanodeInfoProto, len(addresses))
+	for i, addr := range addresses {
+		locs[i] = &hdfs.DatanodeInfoProto{
+			Id: &hdfs.DatanodeIDProto{
+				IpAddr:       proto.String(addr),
+				HostName:     proto.String(addr),
+				DatanodeUuid: proto.String(addr),
+				XferPort:     proto.Uint32(9866),
+				InfoPort:     proto.Uint32(9864),
+				IpcPort:      proto.Uint32(9867),
+			},
+		}
+	}
+
+	return &hdfs.LocatedBlockProto{
+		B: &hdfs.ExtendedBlockProto{
+			PoolId:          proto.String("pool"),
+			BlockId:         proto.Uint64(1),
+			GenerationStamp: proto.Uint64(1),
+			NumBytes:        proto.Uint64(1024),
+		},
+		Offset:  proto.Uint64(0),
+		Locs:    locs,
+		Corrupt: proto.Bool(false),
+		BlockToken: &hadoop.TokenProto{
+			Identifier: []byte{},
+			Password:   []byte{},
+			Kind:       proto.String(""),
+			Service:    proto.String(""),
+		},
+	}
+}
+
+func TestReadAtHedged(t *testing.T) {
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	br := &BlockReader{
+		Block:       testBlock("hedge-slow", "hedge-fast"),
+		HedgedReads: NewHedgedReadPool(1, 10*time.Millisecond),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			client, server := net.Pipe()
+			if addr == "hedge-fast:9866" {
+				go serveBlockRead(t, server, data)
+			} else {
+				// Never respond.
+				go io.Copy(io.Discard, server)
+			}
+
+			return client, nil
+		},
+	}
+
+	b := make([]byte, 100)
+	n, err := br.ReadAt(b, 600)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, data[600:700], b)
+}
+
+func TestReadAtFailover(t *testing.T) {
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	br := &BlockReader{
+		Block: testBlock("failover-bad", "failover-good"),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr != "failover-good:9866" {
+				return nil, errors.New("connection refused")
+			}
+
+			client, server := net.Pipe()
+			go serveBlockRead(t, server, data)
+			return client, nil
+		},
+	}
+
+	b := make([]byte, 10)
+	n, err := br.ReadAt(b, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, data[5:15], b)
+}
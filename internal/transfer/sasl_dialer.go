@@ -113,7 +113,7 @@ func (d *SaslDialer) wrapDatanodeConn(conn net.Conn) (net.Conn, error) {
 
 	// The response includes a challenge. Compute it and send it back.
 	resp := &hdfs.DataTransferEncryptorMessageProto{}
-	err = readPrefixedMessage(conn, msg)
+	err = readSaslMessage(conn, msg)
 	if err != nil {
 		return nil, err
 	}
@@ -148,7 +148,9 @@ func (d *SaslDialer) wrapDatanodeConn(conn net.Conn) (net.Conn, error) {
 	msg.Payload = []byte(challengeResponse)
 
 	if privacy {
-		// Indicate to the server that we want AES.
+		// Indicate to the server that we want AES, which is much faster than
+		// any of the DIGEST-MD5 ciphers. The datanode only agrees if
+		// dfs.encrypt.data.transfer.cipher.suites is set on its end.
 		opt := &hdfs.CipherOptionProto{}
 		opt.Suite = hdfs.CipherSuiteProto_AES_CTR_NOPADDING.Enum()
 		msg.CipherOption = append(msg.CipherOption, opt)
@@ -165,7 +167,7 @@ func (d *SaslDialer) wrapDatanodeConn(conn net.Conn) (net.Conn, error) {
 	}
 
 	// Read another response from the server.
-	err = readPrefixedMessage(conn, resp)
+	err = readSaslMessage(conn, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -190,31 +192,34 @@ func (d *SaslDialer) wrapDatanodeConn(conn net.Conn) (net.Conn, error) {
 		}
 
 		kcc, kcs := generatePrivacyKeys(dgst.a1(), dgst.cipher)
-		wrapped = newDigestMD5PrivacyConn(conn, kic, kis, kcc, kcs)
+		wrapped = newDigestMD5PrivacyConn(conn, dgst.cipher, kic, kis, kcc, kcs)
 	} else {
 		wrapped = newDigestMD5IntegrityConn(conn, kic, kis)
 	}
 
-	// If we're going to encrypt, we use the above wrapped connection just for
+	// If the datanode picked AES, we use the above wrapped connection just for
 	// finishing the handshake.
-	if len(resp.GetCipherOption()) > 0 {
-		cipher := resp.GetCipherOption()[0]
-		var outKey []byte
-
-		decoded, err := wrapped.decode(cipher.InKey)
-		if err != nil {
-			return nil, err
-		}
-
-		inKey := make([]byte, len(decoded))
-		copy(inKey, decoded)
+	if privacy && len(resp.GetCipherOption()) > 0 {
+		return negotiatedAesConn(conn, wrapped, resp.GetCipherOption()[0])
+	}
 
-		if outKey, err = wrapped.decode(cipher.OutKey); err != nil {
-			return nil, err
-		}
+	return wrapped, nil
+}
 
-		return newAesConn(conn, inKey, outKey, cipher.InIv, cipher.OutIv)
+// readSaslMessage reads a message from the datanode during the handshake,
+// and checks its status.
+func readSaslMessage(conn net.Conn, msg *hdfs.DataTransferEncryptorMessageProto) error {
+	err := readPrefixedMessage(conn, msg)
+	if err != nil {
+		return err
 	}
 
-	return wrapped, nil
+	switch msg.GetStatus() {
+	case hdfs.DataTransferEncryptorMessageProto_SUCCESS:
+		return nil
+	case hdfs.DataTransferEncryptorMessageProto_ERROR_UNKNOWN_KEY:
+		return fmt.Errorf("negotiating data protection: %w (%s)", ErrInvalidEncryptionKey, msg.GetMessage())
+	default:
+		return fmt.Errorf("negotiating data protection: %s (%s)", msg.GetStatus().String(), msg.GetMessage())
+	}
 }
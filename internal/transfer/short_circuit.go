@@ -0,0 +1,385 @@
+package transfer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// DefaultShortCircuitDisableInterval is used if ShortCircuitReads has a
+	// zero DisableInterval. It matches the default for
+	// dfs.client.domain.socket.disable.interval.seconds.
+	DefaultShortCircuitDisableInterval = 10 * time.Minute
+
+	requestShortCircuitFdsOp  = 0x57
+	shortCircuitAccessVersion = 1
+	shortCircuitTimeout       = 60 * time.Second
+
+	// The meta file starts with a 2-byte version, followed by the checksum
+	// type (1 byte) and the number of bytes per checksum (4 bytes).
+	blockMetadataVersion    = 1
+	blockMetadataHeaderSize = 7
+
+	// maxLocalReadChunks limits how much is read from disk at once, so that a
+	// large read doesn't need an equally large buffer.
+	maxLocalReadChunks = 128
+)
+
+var errShortCircuitUnsupported = errors.New("short-circuit reads are not supported on this platform")
+
+// ShortCircuitReads enables reading blocks straight from the local disk, when
+// one of the datanodes with a replica is running on the same host as the
+// client. Instead of streaming the block over TCP, the datanode passes open
+// file descriptors for the block and its checksums over a UNIX domain socket,
+// and the data is read and verified locally. It's meant to be shared between
+// all the BlockReaders for a client.
+//
+// The datanode must have dfs.client.read.shortcircuit enabled, and
+// dfs.domain.socket.path set. If a short-circuit read isn't possible for any
+// reason, BlockReader falls back to reading over TCP.
+type ShortCircuitReads struct {
+	// SocketPath is the path of the UNIX domain socket the datanodes listen
+	// on. Any occurrence of "_PORT" is replaced with the datanode's transfer
+	// port.
+	SocketPath string
+	// DisableInterval is how long a socket path is skipped for, after it
+	// fails once.
+	DisableInterval time.Duration
+
+	disabled  map[string]time.Time
+	localIPs  map[string]bool
+	localOnce sync.Once
+	lock      sync.Mutex
+}
+
+// NewShortCircuitReads creates a ShortCircuitReads for datanodes listening on
+// socketPath.
+func NewShortCircuitReads(socketPath string) *ShortCircuitReads {
+	return &ShortCircuitReads{SocketPath: socketPath}
+}
+
+// open requests the block and meta files for a block from a local datanode.
+func (s *ShortCircuitReads) open(block *hdfs.LocatedBlockProto) (*localReplica, error) {
+	for _, loc := range block.GetLocs() {
+		id := loc.GetId()
+		if !s.isLocal(id.GetIpAddr()) {
+			continue
+		}
+
+		path := s.socketPath(id)
+		if s.isDisabled(path) {
+			continue
+		}
+
+		data, meta, err := requestShortCircuitFds(path, block)
+		if err != nil {
+			// Only give up on the socket if the problem is with the socket or
+			// the datanode itself, rather than with this block (an expired
+			// token, for example).
+			var scErr shortCircuitError
+			if !errors.As(err, &scErr) || scErr.status == hdfs.Status_ERROR_UNSUPPORTED {
+				s.disable(path)
+			}
+
+			return nil, err
+		}
+
+		replica, err := newLocalReplica(data, meta, int64(block.GetB().GetNumBytes()))
+		if err != nil {
+			data.Close()
+			meta.Close()
+			return nil, err
+		}
+
+		return replica, nil
+	}
+
+	return nil, errors.New("no local datanodes")
+}
+
+func (s *ShortCircuitReads) socketPath(datanode *hdfs.DatanodeIDProto) string {
+	return strings.ReplaceAll(s.SocketPath, "_PORT", strconv.Itoa(int(datanode.GetXferPort())))
+}
+
+func (s *ShortCircuitReads) disableInterval() time.Duration {
+	if s.DisableInterval <= 0 {
+		return DefaultShortCircuitDisableInterval
+	}
+
+	return s.DisableInterval
+}
+
+func (s *ShortCircuitReads) isDisabled(path string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	until, ok := s.disabled[path]
+	if ok && time.Now().After(until) {
+		delete(s.disabled, path)
+		return false
+	}
+
+	return ok
+}
+
+func (s *ShortCircuitReads) disable(path string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.disabled == nil {
+		s.disabled = make(map[string]time.Time)
+	}
+
+	s.disabled[path] = time.Now().Add(s.disableInterval())
+}
+
+// isLocal returns true if the IP address belongs to this host.
+func (s *ShortCircuitReads) isLocal(ipAddr string) bool {
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		return false
+	} else if ip.IsLoopback() {
+		return true
+	}
+
+	s.localOnce.Do(func() {
+		s.localIPs = make(map[string]bool)
+		addrs, err := net.InterfaceAddrs()
+		if err != nil {
+			return
+		}
+
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				s.localIPs[ipNet.IP.String()] = true
+			}
+		}
+	})
+
+	return s.localIPs[ip.String()]
+}
+
+// A request for short-circuit access to a block:
+// +-----------------------------------------------------------+
+// |  Data Transfer Protocol Version, int16                    |
+// +-----------------------------------------------------------+
+// |  Op code, 1 byte (REQUEST_SHORT_CIRCUIT_FDS = 0x57)       |
+// +-----------------------------------------------------------+
+// |  varint length + OpRequestShortCircuitAccessProto         |
+// +-----------------------------------------------------------+
+//
+// The datanode responds with a BlockOpResponseProto, and then, if successful,
+// a single byte carrying the file descriptors for the block and meta files.
+// Finally, the client sends a single zero byte to confirm that it got them.
+func writeShortCircuitRequest(w io.Writer, block *hdfs.LocatedBlockProto) error {
+	op := &hdfs.OpRequestShortCircuitAccessProto{
+		Header: &hdfs.BaseHeaderProto{
+			Block: block.GetB(),
+			Token: block.GetBlockToken(),
+		},
+		MaxVersion:                  proto.Uint32(shortCircuitAccessVersion),
+		SupportsReceiptVerification: proto.Bool(true),
+	}
+
+	return writeBlockOpRequest(w, requestShortCircuitFdsOp, op)
+}
+
+// readShortCircuitResponse reads the datanode's response to a short-circuit
+// request. Unlike readPrefixedMessage, it's careful not to read past the end
+// of the message, since the next byte carries the file descriptors.
+func readShortCircuitResponse(r io.Reader) error {
+	var length uint64
+	b := make([]byte, 1)
+	for shift := 0; ; shift += 7 {
+		if shift >= 35 {
+			return errInvalidResponse
+		}
+
+		_, err := io.ReadFull(r, b)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		} else if err != nil {
+			return err
+		}
+
+		length |= uint64(b[0]&0x7f) << shift
+		if b[0] < 0x80 {
+			break
+		}
+	}
+
+	msgBytes := make([]byte, length)
+	_, err := io.ReadFull(r, msgBytes)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	resp := &hdfs.BlockOpResponseProto{}
+	err = proto.Unmarshal(msgBytes, resp)
+	if err != nil {
+		return err
+	} else if resp.GetStatus() != hdfs.Status_SUCCESS {
+		return shortCircuitError{status: resp.GetStatus(), message: resp.GetMessage()}
+	}
+
+	return nil
+}
+
+// shortCircuitError is returned when a datanode refuses a request for
+// short-circuit access to a block.
+type shortCircuitError struct {
+	status  hdfs.Status
+	message string
+}
+
+func (e shortCircuitError) Error() string {
+	return fmt.Sprintf("short-circuit read failed: %s (%s)", e.status.String(), e.message)
+}
+
+// localReplica implements io.ReaderAt for a block, using the block and meta
+// files from the datanode.
+type localReplica struct {
+	data   *os.File
+	meta   *os.File
+	length int64
+
+	checksumTab  *crc32.Table
+	checksumSize int
+	chunkSize    int
+}
+
+func newLocalReplica(data, meta *os.File, length int64) (*localReplica, error) {
+	header := make([]byte, blockMetadataHeaderSize)
+	_, err := meta.ReadAt(header, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	version := binary.BigEndian.Uint16(header)
+	if version != blockMetadataVersion {
+		return nil, fmt.Errorf("unsupported block metadata version: %d", version)
+	}
+
+	r := &localReplica{
+		data:      data,
+		meta:      meta,
+		length:    length,
+		chunkSize: int(binary.BigEndian.Uint32(header[3:])),
+	}
+
+	// These are the IDs for DataChecksum.Type in the Java client.
+	switch header[2] {
+	case 0:
+	case 1:
+		r.checksumTab = crc32.IEEETable
+		r.checksumSize = 4
+	case 2:
+		r.checksumTab = crc32.MakeTable(crc32.Castagnoli)
+		r.checksumSize = 4
+	default:
+		return nil, fmt.Errorf("unsupported checksum type: %d", header[2])
+	}
+
+	if r.chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid bytes per checksum: %d", r.chunkSize)
+	}
+
+	return r, nil
+}
+
+// ReadAt implements io.ReaderAt. Every chunk read is verified against its
+// checksum.
+func (r *localReplica) ReadAt(b []byte, off int64) (int, error) {
+	if off >= r.length {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(b))
+	var err error
+	if end > r.length {
+		end = r.length
+		err = io.EOF
+	}
+
+	n := 0
+	for off < end {
+		m, readErr := r.readChunks(b[n:end-off+int64(n)], off)
+		n += m
+		off += int64(m)
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+
+	return n, err
+}
+
+// readChunks fills as much of b as it can from a limited number of chunks,
+// starting at off.
+func (r *localReplica) readChunks(b []byte, off int64) (int, error) {
+	chunkSize := int64(r.chunkSize)
+	firstChunk := off / chunkSize
+	lastChunk := (off + int64(len(b)) - 1) / chunkSize
+	if lastChunk-firstChunk >= maxLocalReadChunks {
+		lastChunk = firstChunk + maxLocalReadChunks - 1
+	}
+
+	start := firstChunk * chunkSize
+	stop := (lastChunk + 1) * chunkSize
+	if stop > r.length {
+		stop = r.length
+	}
+
+	buf := make([]byte, stop-start)
+	_, err := r.data.ReadAt(buf, start)
+	if err == io.EOF {
+		return 0, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return 0, err
+	}
+
+	if r.checksumTab != nil {
+		checksums := make([]byte, int(lastChunk-firstChunk+1)*r.checksumSize)
+		_, err = r.meta.ReadAt(checksums, blockMetadataHeaderSize+firstChunk*int64(r.checksumSize))
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+
+		for i := 0; i < len(buf); i += r.chunkSize {
+			chunk := buf[i:]
+			if len(chunk) > r.chunkSize {
+				chunk = chunk[:r.chunkSize]
+			}
+
+			checksumOffset := (i / r.chunkSize) * r.checksumSize
+			checksum := binary.BigEndian.Uint32(checksums[checksumOffset:])
+			if crc32.Checksum(chunk, r.checksumTab) != checksum {
+				return 0, errInvalidChecksum
+			}
+		}
+	}
+
+	return copy(b, buf[off-start:]), nil
+}
+
+// Close closes the block and meta files.
+func (r *localReplica) Close() error {
+	r.meta.Close()
+	return r.data.Close()
+}
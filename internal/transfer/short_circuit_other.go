@@ -0,0 +1,13 @@
+//go:build !unix
+
+package transfer
+
+import (
+	"os"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+func requestShortCircuitFds(path string, block *hdfs.LocatedBlockProto) (*os.File, *os.File, error) {
+	return nil, nil, errShortCircuitUnsupported
+}
@@ -0,0 +1,260 @@
+//go:build linux
+
+package transfer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeLocalReplica writes a block and meta file in the same format as a
+// datanode would, with CRC32C checksums every chunkSize bytes.
+func writeLocalReplica(t *testing.T, dir string, data []byte, chunkSize int) (*os.File, *os.File) {
+	blockPath := filepath.Join(dir, "blk_1")
+	require.NoError(t, os.WriteFile(blockPath, data, 0644))
+
+	meta := make([]byte, blockMetadataHeaderSize)
+	binary.BigEndian.PutUint16(meta, blockMetadataVersion)
+	meta[2] = 2
+	binary.BigEndian.PutUint32(meta[3:], uint32(chunkSize))
+
+	tab := crc32.MakeTable(crc32.Castagnoli)
+	for i := 0; i < len(data); i += chunkSize {
+		end := i + chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		meta = binary.BigEndian.AppendUint32(meta, crc32.Checksum(data[i:end], tab))
+	}
+
+	metaPath := filepath.Join(dir, "blk_1_1.meta")
+	require.NoError(t, os.WriteFile(metaPath, meta, 0644))
+
+	blockFile, err := os.Open(blockPath)
+	require.NoError(t, err)
+	metaFile, err := os.Open(metaPath)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		blockFile.Close()
+		metaFile.Close()
+	})
+
+	return blockFile, metaFile
+}
+
+// serveShortCircuit stands in for a datanode listening on a domain socket,
+// passing the given block and meta files to any client that asks.
+func serveShortCircuit(t *testing.T, path string, blockFile, metaFile *os.File) {
+	serveShortCircuitStatus(t, path, hdfs.Status_SUCCESS, blockFile, metaFile)
+}
+
+// serveShortCircuitStatus is like serveShortCircuit, but responds to requests
+// with the given status. Unless it's SUCCESS, no files are sent.
+func serveShortCircuitStatus(t *testing.T, path string, status hdfs.Status, blockFile, metaFile *os.File) {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	var rights []byte
+	if status == hdfs.Status_SUCCESS {
+		rights = syscall.UnixRights(int(blockFile.Fd()), int(metaFile.Fd()))
+	}
+
+	go func() {
+		for {
+			conn, err := l.AcceptUnix()
+			if err != nil {
+				return
+			}
+
+			respondShortCircuit(t, conn, status, rights)
+			conn.Close()
+		}
+	}()
+}
+
+func respondShortCircuit(t *testing.T, conn *net.UnixConn, status hdfs.Status, rights []byte) {
+	header := make([]byte, 3)
+	_, err := io.ReadFull(conn, header)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.EqualValues(t, requestShortCircuitFdsOp, header[2])
+
+	op := &hdfs.OpRequestShortCircuitAccessProto{}
+	if !assert.NoError(t, readPrefixedMessage(conn, op)) {
+		return
+	}
+
+	assert.EqualValues(t, 1, op.GetHeader().GetBlock().GetBlockId())
+	assert.True(t, op.GetSupportsReceiptVerification())
+
+	resp, err := makePrefixedMessage(&hdfs.BlockOpResponseProto{
+		Status:                    status.Enum(),
+		ShortCircuitAccessVersion: proto.Uint32(1),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = conn.Write(resp)
+	if !assert.NoError(t, err) || status != hdfs.Status_SUCCESS {
+		return
+	}
+
+	_, _, err = conn.WriteMsgUnix([]byte{0}, rights, nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	receipt := make([]byte, 1)
+	_, err = io.ReadFull(conn, receipt)
+	if assert.NoError(t, err) {
+		assert.EqualValues(t, 0, receipt[0])
+	}
+}
+
+func shortCircuitTestData() []byte {
+	data := make([]byte, 1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	return data
+}
+
+func TestShortCircuitRead(t *testing.T) {
+	dir := t.TempDir()
+	data := shortCircuitTestData()
+	blockFile, metaFile := writeLocalReplica(t, dir, data, 100)
+	serveShortCircuit(t, filepath.Join(dir, "dn.9866"), blockFile, metaFile)
+
+	br := &BlockReader{
+		Block:        testBlock("127.0.0.1"),
+		ShortCircuit: NewShortCircuitReads(filepath.Join(dir, "dn._PORT")),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return nil, errors.New("shouldn't connect over TCP")
+		},
+	}
+
+	b := make([]byte, 150)
+	n, err := br.ReadAt(b, 333)
+	require.NoError(t, err)
+	assert.Equal(t, 150, n)
+	assert.Equal(t, data[333:483], b)
+
+	require.NoError(t, br.Skip(10))
+	assert.EqualValues(t, 10, br.Offset)
+
+	rest, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, data[10:], rest)
+	assert.NoError(t, br.Close())
+}
+
+func TestShortCircuitBadChecksum(t *testing.T) {
+	dir := t.TempDir()
+	data := shortCircuitTestData()
+	blockFile, metaFile := writeLocalReplica(t, dir, data, 100)
+	serveShortCircuit(t, filepath.Join(dir, "dn.9866"), blockFile, metaFile)
+
+	// Corrupt the data on disk. The reader should fall back to the network.
+	corrupt := append([]byte(nil), data...)
+	corrupt[500]++
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "blk_1"), corrupt, 0644))
+
+	dials := 0
+	br := &BlockReader{
+		Block:        testBlock("127.0.0.1"),
+		ShortCircuit: NewShortCircuitReads(filepath.Join(dir, "dn._PORT")),
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials++
+			client, server := net.Pipe()
+			go serveBlockRead(t, server, data)
+			return client, nil
+		},
+	}
+
+	b := make([]byte, 100)
+	n, err := br.ReadAt(b, 450)
+	require.NoError(t, err)
+	assert.Equal(t, 100, n)
+	assert.Equal(t, data[450:550], b)
+	assert.Equal(t, 1, dials)
+}
+
+func TestShortCircuitFallback(t *testing.T) {
+	dir := t.TempDir()
+	data := shortCircuitTestData()
+	path := filepath.Join(dir, "dn.9866")
+
+	dials := 0
+	sc := NewShortCircuitReads(filepath.Join(dir, "dn._PORT"))
+	br := &BlockReader{
+		Block:        testBlock("127.0.0.1"),
+		ShortCircuit: sc,
+		DialFunc: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dials++
+			client, server := net.Pipe()
+			go serveBlockRead(t, server, data)
+			return client, nil
+		},
+	}
+
+	// Nothing is listening on the socket.
+	b, err := io.ReadAll(br)
+	require.NoError(t, err)
+	assert.Equal(t, data, b)
+	assert.Equal(t, 1, dials)
+	assert.True(t, sc.isDisabled(path))
+}
+
+func TestShortCircuitRemoteDatanode(t *testing.T) {
+	sc := NewShortCircuitReads("/nonexistent/dn._PORT")
+	assert.True(t, sc.isLocal("127.0.0.1"))
+	assert.False(t, sc.isLocal("192.0.2.1"))
+
+	_, err := sc.open(testBlock("192.0.2.1"))
+	assert.Error(t, err)
+	assert.False(t, sc.isDisabled("/nonexistent/dn.9866"))
+}
+
+func TestShortCircuitBlockError(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dn.9866")
+	serveShortCircuitStatus(t, path, hdfs.Status_ERROR_ACCESS_TOKEN, nil, nil)
+
+	// A problem with a single block shouldn't stop us from trying again with
+	// the next one.
+	sc := NewShortCircuitReads(filepath.Join(dir, "dn._PORT"))
+	_, err := sc.open(testBlock("127.0.0.1"))
+	assert.Error(t, err)
+	assert.False(t, sc.isDisabled(path))
+}
+
+func TestShortCircuitUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dn.9866")
+	serveShortCircuitStatus(t, path, hdfs.Status_ERROR_UNSUPPORTED, nil, nil)
+
+	sc := NewShortCircuitReads(filepath.Join(dir, "dn._PORT"))
+	_, err := sc.open(testBlock("127.0.0.1"))
+	assert.Error(t, err)
+	assert.True(t, sc.isDisabled(path))
+}
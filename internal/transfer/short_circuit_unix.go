@@ -0,0 +1,79 @@
+//go:build unix
+
+package transfer
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+// requestShortCircuitFds asks the datanode listening at path for the block and
+// meta files for the block, which it passes over the socket with SCM_RIGHTS.
+func requestShortCircuitFds(path string, block *hdfs.LocatedBlockProto) (*os.File, *os.File, error) {
+	conn, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer conn.Close()
+	err = conn.SetDeadline(time.Now().Add(shortCircuitTimeout))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = writeShortCircuitRequest(conn, block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = readShortCircuitResponse(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b := make([]byte, 1)
+	oob := make([]byte, syscall.CmsgSpace(2*4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(b, oob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fds []int
+	for _, msg := range msgs {
+		rights, err := syscall.ParseUnixRights(&msg)
+		if err == nil {
+			fds = append(fds, rights...)
+		}
+	}
+
+	if len(fds) != 2 {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+
+		return nil, nil, errors.New("datanode didn't send the block and meta files")
+	}
+
+	data := os.NewFile(uintptr(fds[0]), path)
+	meta := os.NewFile(uintptr(fds[1]), path)
+
+	// Let the datanode know that we got the files.
+	_, err = conn.Write([]byte{0})
+	if err != nil {
+		data.Close()
+		meta.Close()
+		return nil, nil, err
+	}
+
+	return data, meta, nil
+}
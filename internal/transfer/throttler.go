@@ -0,0 +1,61 @@
+package transfer
+
+import (
+	"sync"
+	"time"
+)
+
+// Throttler limits the rate at which data is read from or written to the
+// datanodes, using a token bucket. It can be shared between BlockReaders or
+// BlockWriters, in which case the limit applies to all of them together.
+type Throttler struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	lock   sync.Mutex
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// NewThrottler creates a Throttler that allows bytesPerSecond on average,
+// with bursts of up to one second's worth.
+func NewThrottler(bytesPerSecond int64) *Throttler {
+	return &Throttler{
+		rate:   float64(bytesPerSecond),
+		tokens: float64(bytesPerSecond),
+		last:   time.Now(),
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+// wait takes n bytes' worth of tokens from the bucket, and then blocks until
+// the bucket is no longer in debt. Concurrent callers queue up behind each
+// other, since each one waits for the tokens taken by the ones before it.
+// It's a no-op on a nil Throttler.
+func (t *Throttler) wait(n int) {
+	if t == nil || n <= 0 {
+		return
+	}
+
+	t.lock.Lock()
+	now := t.now()
+	t.tokens += now.Sub(t.last).Seconds() * t.rate
+	if t.tokens > t.rate {
+		t.tokens = t.rate
+	}
+
+	t.last = now
+	t.tokens -= float64(n)
+
+	var d time.Duration
+	if t.tokens < 0 {
+		d = time.Duration(-t.tokens / t.rate * float64(time.Second))
+	}
+
+	t.lock.Unlock()
+	if d > 0 {
+		t.sleep(d)
+	}
+}
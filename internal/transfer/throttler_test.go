@@ -0,0 +1,51 @@
+package transfer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testThrottler(bytesPerSecond int64) (*Throttler, *time.Time, *time.Duration) {
+	now := time.Now()
+	var slept time.Duration
+	t := NewThrottler(bytesPerSecond)
+	t.last = now
+	t.now = func() time.Time { return now }
+	t.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	return t, &now, &slept
+}
+
+func TestThrottlerAllowsBurst(t *testing.T) {
+	throttler, _, slept := testThrottler(1000)
+	throttler.wait(1000)
+	assert.Zero(t, *slept)
+
+	throttler.wait(500)
+	assert.Equal(t, 500*time.Millisecond, *slept)
+}
+
+func TestThrottlerLimitsRate(t *testing.T) {
+	throttler, now, slept := testThrottler(1000)
+	throttler.wait(1000)
+
+	// Reads larger than the bucket just wait longer.
+	throttler.wait(3000)
+	assert.Equal(t, 3*time.Second, *slept)
+
+	// Tokens refill over time, but only up to one second's worth.
+	*now = now.Add(time.Minute)
+	*slept = 0
+	throttler.wait(1500)
+	assert.Equal(t, 500*time.Millisecond, *slept)
+}
+
+func TestThrottlerNil(t *testing.T) {
+	var throttler *Throttler
+	throttler.wait(1000)
+}
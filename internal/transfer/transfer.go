@@ -20,6 +20,33 @@ const (
 
 var errInvalidResponse = errors.New("invalid response from datanode")
 
+var (
+	// ErrInvalidBlockToken is returned (wrapped) if a datanode rejects the
+	// block token, which usually means it has expired. The block locations
+	// should be fetched from the namenode again, to get a new one.
+	ErrInvalidBlockToken = errors.New("invalid block token")
+	// ErrInvalidEncryptionKey is returned (wrapped) if a datanode doesn't
+	// recognize the data encryption key, which usually means it has expired.
+	// A new one should be fetched from the namenode.
+	ErrInvalidEncryptionKey = errors.New("invalid data encryption key")
+)
+
+// isAccessError returns true if the error means that the datanode rejected
+// our credentials. Since all the datanodes share the same keys, there's no
+// point trying another one in that case.
+func isAccessError(err error) bool {
+	return errors.Is(err, ErrInvalidBlockToken) || errors.Is(err, ErrInvalidEncryptionKey)
+}
+
+// blockOpError returns an error for an unsuccessful response to an op.
+func blockOpError(op string, status hdfs.Status, message string) error {
+	if status == hdfs.Status_ERROR_ACCESS_TOKEN {
+		return fmt.Errorf("%s failed: %w (%s)", op, ErrInvalidBlockToken, message)
+	}
+
+	return fmt.Errorf("%s failed: %s (%s)", op, status.String(), message)
+}
+
 func makePrefixedMessage(msg proto.Message) ([]byte, error) {
 	msgBytes, err := proto.Marshal(msg)
 	if err != nil {
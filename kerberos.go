@@ -0,0 +1,105 @@
+package hdfs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	krb "github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+)
+
+// NewKerberosClientWithKeytab returns a kerberos client for principal that is
+// logged in using the keys in a keytab, suitable for ClientOptions.KerberosClient.
+// Unlike a client created from a ccache, it can log in again by itself once
+// its ticket expires, which makes it the right choice for long-running
+// processes.
+//
+// If keytabPath is empty, the keytab named by the KRB5_CLIENT_KTNAME
+// environment variable is used, like with MIT kerberos. If principal is empty,
+// the first principal in the keytab is used, and if it has no realm, the
+// default realm from krb5conf is assumed. If krb5conf is nil, the
+// configuration is loaded from KRB5_CONFIG, or /etc/krb5.conf.
+func NewKerberosClientWithKeytab(principal, keytabPath string, krb5conf *config.Config) (*krb.Client, error) {
+	if keytabPath == "" {
+		keytabPath = os.Getenv("KRB5_CLIENT_KTNAME")
+	}
+
+	keytabPath, err := parseKeytabName(keytabPath)
+	if err != nil {
+		return nil, err
+	}
+
+	kt, err := keytab.Load(keytabPath)
+	if err != nil {
+		return nil, fmt.Errorf("loading keytab %s: %s", keytabPath, err)
+	}
+
+	if krb5conf == nil {
+		krb5conf, err = loadKerberosConfig()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if principal == "" {
+		if len(kt.Entries) == 0 {
+			return nil, fmt.Errorf("keytab %s has no entries", keytabPath)
+		}
+
+		p := kt.Entries[0].Principal
+		principal = strings.Join(p.Components, "/") + "@" + p.Realm
+	}
+
+	username, realm := splitKerberosPrincipal(principal)
+	if realm == "" {
+		realm = krb5conf.LibDefaults.DefaultRealm
+	}
+
+	client := krb.NewWithKeytab(username, realm, kt, krb5conf)
+	err = client.Login()
+	if err != nil {
+		return nil, fmt.Errorf("logging in as %s@%s: %s", username, realm, err)
+	}
+
+	return client, nil
+}
+
+// parseKeytabName strips the FILE: prefix from a keytab name, and rejects any
+// other kind of keytab.
+func parseKeytabName(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("no keytab specified, and KRB5_CLIENT_KTNAME is not set")
+	}
+
+	if i := strings.Index(name, ":"); i > 0 {
+		if strings.HasPrefix(name, "FILE:") || strings.HasPrefix(name, "WRFILE:") {
+			return name[i+1:], nil
+		}
+
+		return "", fmt.Errorf("unusable keytab: %s", name)
+	}
+
+	return name, nil
+}
+
+// splitKerberosPrincipal splits a principal like "nn/host@EXAMPLE.COM" into
+// the username ("nn/host") and the realm ("EXAMPLE.COM").
+func splitKerberosPrincipal(principal string) (string, string) {
+	if i := strings.LastIndex(principal, "@"); i >= 0 {
+		return principal[:i], principal[i+1:]
+	}
+
+	return principal, ""
+}
+
+func loadKerberosConfig() (*config.Config, error) {
+	configPath := os.Getenv("KRB5_CONFIG")
+	if configPath == "" {
+		configPath = "/etc/krb5.conf"
+	}
+
+	return config.Load(configPath)
+}
@@ -0,0 +1,60 @@
+package hdfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitKerberosPrincipal(t *testing.T) {
+	username, realm := splitKerberosPrincipal("nn/host.example.com@EXAMPLE.COM")
+	assert.Equal(t, "nn/host.example.com", username)
+	assert.Equal(t, "EXAMPLE.COM", realm)
+
+	username, realm = splitKerberosPrincipal("bob")
+	assert.Equal(t, "bob", username)
+	assert.Equal(t, "", realm)
+}
+
+func TestParseKeytabName(t *testing.T) {
+	path, err := parseKeytabName("/etc/hdfs.keytab")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/hdfs.keytab", path)
+
+	path, err = parseKeytabName("FILE:/etc/hdfs.keytab")
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/hdfs.keytab", path)
+
+	_, err = parseKeytabName("KEYRING:foo")
+	assert.Error(t, err)
+
+	_, err = parseKeytabName("")
+	assert.Error(t, err)
+}
+
+func TestNewKerberosClientWithKeytabFromEnvironment(t *testing.T) {
+	kt := keytab.New()
+	require.NoError(t, kt.AddEntry("hdfs/host.example.com", "EXAMPLE.COM", "secret", time.Now(), 1, 18))
+	b, err := kt.Marshal()
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "client.keytab")
+	require.NoError(t, os.WriteFile(path, b, 0600))
+	t.Setenv("KRB5_CLIENT_KTNAME", "FILE:"+path)
+
+	// There's no KDC to log in with, but the principal should be taken from
+	// the keytab.
+	_, err = NewKerberosClientWithKeytab("", "", config.New())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "hdfs/host.example.com@EXAMPLE.COM")
+
+	t.Setenv("KRB5_CLIENT_KTNAME", "")
+	_, err = NewKerberosClientWithKeytab("", "", config.New())
+	assert.Error(t, err)
+}
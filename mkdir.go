@@ -43,7 +43,7 @@ func (c *Client) mkdir(dirname string, perm os.FileMode, createParent bool) erro
 	}
 	resp := &hdfs.MkdirsResponseProto{}
 
-	err = c.namenode.Execute("mkdirs", req, resp)
+	err = c.execute("mkdirs", req, resp)
 	if err != nil {
 		return &os.PathError{"mkdir", dirname, interpretException(err)}
 	}
@@ -0,0 +1,225 @@
+package hdfs
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2/internal/rpc"
+	"github.com/colinmarc/hdfs/v2/internal/transfer"
+)
+
+// Observer receives events from a Client, so that metrics can be collected
+// about what it's doing. The methods are called synchronously, often from
+// several goroutines at once, so implementations must be safe for concurrent
+// use and should return quickly. Implementations should embed NopObserver, so
+// that they keep compiling if more events are added.
+//
+// See PrometheusObserver for an implementation that exports the events as
+// Prometheus metrics.
+type Observer interface {
+	// NamenodeCall is called once each RPC call to the namenode finishes.
+	NamenodeCall(NamenodeCallEvent)
+	// DatanodeConnect is called once each new connection to a datanode, for
+	// reading or writing a block, is set up.
+	DatanodeConnect(DatanodeConnectEvent)
+	// BlockRead is called when a client is done reading from a block.
+	BlockRead(BlockTransferEvent)
+	// BlockWritten is called when a client is done writing to a block.
+	BlockWritten(BlockTransferEvent)
+	// ChecksumFailure is called when data read from a datanode (or from the
+	// local disk, with short-circuit reads) doesn't match its checksum.
+	ChecksumFailure(ChecksumFailureEvent)
+	// Failover is called when the client switches to another namenode,
+	// because the one it was using failed or is in standby.
+	Failover(FailoverEvent)
+	// Retry is called when an operation failed, and is being retried.
+	Retry(RetryEvent)
+}
+
+// NopObserver is an Observer that ignores every event. It's intended to be
+// embedded by other implementations.
+type NopObserver struct{}
+
+func (NopObserver) NamenodeCall(NamenodeCallEvent)       {}
+func (NopObserver) DatanodeConnect(DatanodeConnectEvent) {}
+func (NopObserver) BlockRead(BlockTransferEvent)         {}
+func (NopObserver) BlockWritten(BlockTransferEvent)      {}
+func (NopObserver) ChecksumFailure(ChecksumFailureEvent) {}
+func (NopObserver) Failover(FailoverEvent)               {}
+func (NopObserver) Retry(RetryEvent)                     {}
+
+// NamenodeCallEvent describes an RPC call to the namenode.
+type NamenodeCallEvent struct {
+	// Method is the name of the RPC method, like "getFileInfo".
+	Method string
+	// Host is the address of the namenode the call was sent to.
+	Host string
+	// Duration is how long the call took, including any time spent
+	// connecting to the namenode.
+	Duration time.Duration
+	// Err is the error returned by the call, if any.
+	Err error
+}
+
+// DatanodeConnectEvent describes a new connection to a datanode.
+type DatanodeConnectEvent struct {
+	// Address is the address of the datanode.
+	Address string
+	// ConnectDuration is how long it took to establish the connection.
+	ConnectDuration time.Duration
+	// SaslDuration is how long the SASL handshake took, if one was necessary
+	// (see ClientOptions.DataTransferProtection).
+	SaslDuration time.Duration
+	// Err is the error that occurred while connecting, if any.
+	Err error
+}
+
+// BlockTransferEvent describes the data read from or written to a block.
+type BlockTransferEvent struct {
+	// Path is the path of the file the block belongs to.
+	Path string
+	// BlockID is the ID of the block.
+	BlockID uint64
+	// Address is the address of the datanode the data was transferred to or
+	// from. For reads, it's the datanode the last of the data came from, and
+	// it's empty if the data was read from the local disk.
+	Address string
+	// Bytes is the number of bytes transferred.
+	Bytes int64
+	// Err is the error that occurred while finishing a write, if any.
+	Err error
+}
+
+// ChecksumFailureEvent describes corrupt data received from a datanode.
+type ChecksumFailureEvent struct {
+	// Path is the path of the file the block belongs to.
+	Path string
+	// BlockID is the ID of the corrupt block.
+	BlockID uint64
+	// Address is the address of the datanode the data came from. It's empty
+	// if the data was read from the local disk.
+	Address string
+}
+
+// FailoverEvent describes a failover from one namenode to another.
+type FailoverEvent struct {
+	// From is the address of the namenode that failed.
+	From string
+	// To is the address of the namenode now in use.
+	To string
+	// Err is the error that caused the failover.
+	Err error
+}
+
+// RetryEvent describes an operation that failed and is being retried.
+type RetryEvent struct {
+	// Op is the operation being retried. It's "read" for reads that are
+	// retried against another datanode or with refreshed credentials, or the
+	// name of the RPC method for namenode calls, like "addBlock".
+	Op string
+	// Path is the path of the file involved.
+	Path string
+	// Address is the address of the datanode that failed, if any.
+	Address string
+	// Err is the error that caused the retry.
+	Err error
+}
+
+// rpcEvents returns callbacks for the namenode connection that forward to
+// the Observer.
+func rpcEvents(observer Observer) *rpc.Events {
+	if observer == nil {
+		return nil
+	}
+
+	return &rpc.Events{
+		Call: func(method, address string, d time.Duration, err error) {
+			observer.NamenodeCall(NamenodeCallEvent{Method: method, Host: address, Duration: d, Err: err})
+		},
+		Failover: func(from, to string, err error) {
+			observer.Failover(FailoverEvent{From: from, To: to, Err: err})
+		},
+	}
+}
+
+// transferEvents returns callbacks for a BlockReader or BlockWriter that
+// forward to the Observer, or nil if there isn't one.
+func (c *Client) transferEvents(path string, blockID uint64) *transfer.Events {
+	observer := c.options.Observer
+	if observer == nil {
+		return nil
+	}
+
+	return &transfer.Events{
+		BlockRead: func(address string, n int64) {
+			observer.BlockRead(BlockTransferEvent{Path: path, BlockID: blockID, Address: address, Bytes: n})
+		},
+		BlockWritten: func(address string, n int64, err error) {
+			observer.BlockWritten(BlockTransferEvent{Path: path, BlockID: blockID, Address: address, Bytes: n, Err: err})
+		},
+		ChecksumFailure: func(address string) {
+			observer.ChecksumFailure(ChecksumFailureEvent{Path: path, BlockID: blockID, Address: address})
+		},
+		Retry: func(address string, err error) {
+			observer.Retry(RetryEvent{Op: "read", Path: path, Address: address, Err: err})
+		},
+	}
+}
+
+// observeRetry reports an operation being retried, if there's an Observer.
+func (c *Client) observeRetry(op, path string, err error) {
+	if c.options.Observer != nil {
+		c.options.Observer.Retry(RetryEvent{Op: op, Path: path, Err: err})
+	}
+}
+
+// observeDatanodeDial wraps a dial function for datanodes to report each
+// connection to the Observer. The connect time is measured by wrapping dc
+// with connected, and any time after that is spent on the SASL handshake in
+// sasl, if it's non-nil.
+func (c *Client) observeDatanodeDial(dc dialContext, sasl func(dialContext) dialContext) dialContext {
+	observer := c.options.Observer
+	if observer == nil {
+		if sasl != nil {
+			return sasl(dc)
+		}
+
+		return dc
+	}
+
+	if dc == nil {
+		dc = (&net.Dialer{}).DialContext
+	}
+
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		start := time.Now()
+		var connected time.Time
+		dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dc(ctx, network, addr)
+			connected = time.Now()
+			return conn, err
+		}
+
+		var conn net.Conn
+		var err error
+		if sasl != nil {
+			conn, err = sasl(dial)(ctx, network, addr)
+		} else {
+			conn, err = dial(ctx, network, addr)
+		}
+
+		event := DatanodeConnectEvent{Address: addr, Err: err}
+		if connected.IsZero() {
+			event.ConnectDuration = time.Since(start)
+		} else {
+			event.ConnectDuration = connected.Sub(start)
+			if sasl != nil {
+				event.SaslDuration = time.Since(connected)
+			}
+		}
+
+		observer.DatanodeConnect(event)
+		return conn, err
+	}
+}
@@ -0,0 +1,98 @@
+package hdfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/colinmarc/hdfs/v2/hadoopconf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingObserver struct {
+	NopObserver
+	connects []DatanodeConnectEvent
+}
+
+func (o *recordingObserver) DatanodeConnect(e DatanodeConnectEvent) {
+	o.connects = append(o.connects, e)
+}
+
+func TestObserveDatanodeDial(t *testing.T) {
+	observer := &recordingObserver{}
+	c := &Client{options: ClientOptions{Observer: observer}}
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		server.Close()
+		return client, nil
+	}
+
+	sasl := func(dc dialContext) dialContext {
+		return func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dc(ctx, network, addr)
+			time.Sleep(10 * time.Millisecond)
+			return conn, err
+		}
+	}
+
+	conn, err := c.observeDatanodeDial(dial, sasl)(context.Background(), "tcp", "dn:9866")
+	require.NoError(t, err)
+	conn.Close()
+
+	failing := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return nil, errors.New("connection refused")
+	}
+
+	_, err = c.observeDatanodeDial(failing, nil)(context.Background(), "tcp", "dn:9866")
+	assert.Error(t, err)
+
+	require.Len(t, observer.connects, 2)
+	assert.Equal(t, "dn:9866", observer.connects[0].Address)
+	assert.NoError(t, observer.connects[0].Err)
+	assert.GreaterOrEqual(t, observer.connects[0].SaslDuration, 10*time.Millisecond)
+	assert.Error(t, observer.connects[1].Err)
+	assert.Zero(t, observer.connects[1].SaslDuration)
+}
+
+func TestObserverMetrics(t *testing.T) {
+	conf, err := hadoopconf.LoadFromEnvironment()
+	if err != nil || conf == nil {
+		t.Fatal("Couldn't load ambient config", err)
+	}
+
+	observer := NewPrometheusObserver()
+	options := ClientOptionsFromConf(conf)
+	options.Observer = observer
+	if options.KerberosClient != nil {
+		options.KerberosClient = getKerberosClient(t, "gohdfs1")
+	} else {
+		options.User = "gohdfs1"
+	}
+
+	client, err := NewClient(options)
+	require.NoError(t, err)
+	defer client.Close()
+
+	file, err := client.Open("/_test/foo.txt")
+	require.NoError(t, err)
+
+	_, err = ioutil.ReadAll(file)
+	require.NoError(t, err)
+	file.Close()
+
+	var b strings.Builder
+	_, err = observer.WriteTo(&b)
+	require.NoError(t, err)
+
+	lines := strings.Split(b.String(), "\n")
+	assert.Contains(t, lines, `hdfs_namenode_calls_total{method="getFileInfo",result="success"} 1`)
+	assert.Contains(t, lines, `hdfs_datanode_connects_total{result="success"} 1`)
+	assert.Contains(t, lines, "hdfs_blocks_read_total 1")
+	assert.Contains(t, lines, "hdfs_read_bytes_total 4")
+}
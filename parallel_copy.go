@@ -0,0 +1,200 @@
+package hdfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+const (
+	// DefaultParallelCopyMemory is the memory budget used by ParallelCopy if
+	// none is specified.
+	DefaultParallelCopyMemory = 64 * 1024 * 1024
+	// minParallelCopyBuffer is the smallest buffer each ParallelCopy worker
+	// will use. If the memory budget doesn't allow for that, fewer blocks are
+	// fetched at once.
+	minParallelCopyBuffer = 64 * 1024
+	// maxParallelCopyBuffer is the largest buffer each ParallelCopy worker will
+	// use. Past that, bigger writes don't make things any faster.
+	maxParallelCopyBuffer = 4 * 1024 * 1024
+)
+
+// copyPart is the section of a single block copied by ParallelCopy.
+type copyPart struct {
+	block   *hdfs.LocatedBlockProto
+	offset  int64
+	length  int64
+	written int64
+}
+
+// ParallelCopy copies the rest of the file, starting at the current offset,
+// to w. Each byte is written at the same offset in w as it has in the file.
+// Unlike io.Copy, which reads each block in turn, ParallelCopy fetches up to
+// concurrency blocks at once, which is usually much faster for large files.
+//
+// At most memoryBudget bytes are used for buffering the data; if it's zero or
+// negative, DefaultParallelCopyMemory is used instead. Once ParallelCopy
+// returns, the offset for Read is left after the last byte copied.
+//
+// The returned count is the number of bytes, from the starting offset, that
+// were completely written to w. If an error occurs, data past that point may
+// have been partially written as well.
+func (f *FileReader) ParallelCopy(w io.WriterAt, concurrency int, memoryBudget int64) (int64, error) {
+	if f.closed {
+		return 0, io.ErrClosedPipe
+	}
+
+	if f.info.IsDir() {
+		return 0, &os.PathError{
+			"copy",
+			f.name,
+			errors.New("is a directory"),
+		}
+	}
+
+	if f.blocks == nil {
+		err := f.getBlocks()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if memoryBudget <= 0 {
+		memoryBudget = DefaultParallelCopyMemory
+	}
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	if int64(concurrency)*minParallelCopyBuffer > memoryBudget {
+		concurrency = int(memoryBudget / minParallelCopyBuffer)
+		if concurrency < 1 {
+			concurrency = 1
+		}
+	}
+
+	bufSize := memoryBudget / int64(concurrency)
+	if bufSize > maxParallelCopyBuffer {
+		bufSize = maxParallelCopyBuffer
+	}
+
+	start := f.offset
+	var parts []*copyPart
+	for _, block := range f.blocks {
+		blockOff := int64(block.GetOffset())
+		blockEnd := blockOff + int64(block.GetB().GetNumBytes())
+		if blockEnd > f.length {
+			blockEnd = f.length
+		}
+
+		if blockEnd <= start {
+			continue
+		}
+
+		offset := int64(0)
+		if start > blockOff {
+			offset = start - blockOff
+		}
+
+		parts = append(parts, &copyPart{
+			block:  block,
+			offset: offset,
+			length: blockEnd - blockOff - offset,
+		})
+	}
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+	failed := make(chan struct{})
+	queue := make(chan *copyPart)
+	for i := 0; i < concurrency && i < len(parts); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			buf := make([]byte, bufSize)
+			for part := range queue {
+				err := f.copyPart(w, part, buf)
+				if err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+Parts:
+	for _, part := range parts {
+		select {
+		case queue <- part:
+		case <-failed:
+			break Parts
+		}
+	}
+
+	close(queue)
+	wg.Wait()
+
+	// Only count the bytes up until the first gap.
+	var n int64
+	for _, part := range parts {
+		n += part.written
+		if part.written < part.length {
+			break
+		}
+	}
+
+	_, err := f.Seek(start+n, io.SeekStart)
+	if firstErr != nil {
+		return n, firstErr
+	}
+
+	return n, err
+}
+
+// copyPart copies a single block section to w, using buf to hold the data in
+// between.
+func (f *FileReader) copyPart(w io.WriterAt, part *copyPart, buf []byte) error {
+	return f.withBlockAccess(part.block, func(block *hdfs.LocatedBlockProto) error {
+		return f.copyPartFrom(w, part, block, buf)
+	})
+}
+
+// copyPartFrom does the work for copyPart, resuming from wherever a previous
+// attempt left off.
+func (f *FileReader) copyPartFrom(w io.WriterAt, part *copyPart, block *hdfs.LocatedBlockProto, buf []byte) error {
+	br, err := f.newBlockReader(block, part.offset+part.written)
+	if err != nil {
+		return err
+	}
+	defer br.Close()
+
+	fileOff := int64(block.GetOffset()) + part.offset
+	for part.written < part.length {
+		chunk := buf
+		if remaining := part.length - part.written; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+
+		_, err := io.ReadFull(br, chunk)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.WriteAt(chunk, fileOff+part.written)
+		if err != nil {
+			return err
+		}
+
+		part.written += int64(len(chunk))
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package hdfs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// partSuffix is appended to the destination, along with a random token and a
+// number, to name the temporary files used by ParallelUpload.
+const partSuffix = "._PART_"
+
+// ParallelUpload writes size bytes from src to a new file at dst, using up to
+// parallelism concurrent writers. The data is split into parts on block
+// boundaries, each of which is written to its own temporary file next to dst,
+// and then the parts are joined together with Concat. This gets around the
+// limit of a single write pipeline, which is usually the bottleneck when
+// uploading one large file.
+//
+// The first part is written directly to dst, so dst exists (with incomplete
+// contents) until ParallelUpload returns. If anything fails, dst and the
+// temporary files are removed.
+func (c *Client) ParallelUpload(src io.ReaderAt, size int64, dst string, parallelism int) error {
+	_, err := c.getFileInfo(dst)
+	err = interpretException(err)
+	if err == nil {
+		return &os.PathError{"create", dst, os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return &os.PathError{"create", dst, err}
+	}
+
+	defaults, err := c.fetchDefaults()
+	if err != nil {
+		return err
+	}
+
+	replication := int(defaults.GetReplication())
+	blockSize := int64(defaults.GetBlockSize())
+	return c.parallelUpload(src, size, dst, parallelism, replication, blockSize)
+}
+
+func (c *Client) parallelUpload(src io.ReaderAt, size int64, dst string, parallelism, replication int, blockSize int64) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	// Split the data up into parts of whole blocks, since Concat requires
+	// every part but the last to end on a block boundary.
+	numBlocks := (size + blockSize - 1) / blockSize
+	blocksPerPart := (numBlocks + int64(parallelism) - 1) / int64(parallelism)
+	if blocksPerPart < 1 {
+		blocksPerPart = 1
+	}
+
+	partSize := blocksPerPart * blockSize
+	numParts := int((size + partSize - 1) / partSize)
+	if numParts < 1 {
+		numParts = 1
+	}
+
+	names, err := partNames(dst, numParts)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	writers := make([]*FileWriter, numParts)
+	errs := make([]error, numParts)
+	for i := range names {
+		offset := int64(i) * partSize
+		length := partSize
+		if offset+length > size {
+			length = size - offset
+		}
+
+		wg.Add(1)
+		go func(i int, offset, length int64) {
+			defer wg.Done()
+
+			w, err := c.CreateFile(names[i], replication, blockSize, 0644)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			writers[i] = w
+			_, err = io.Copy(w, io.NewSectionReader(src, offset, length))
+			if err != nil {
+				w.Close()
+				errs[i] = err
+				return
+			}
+
+			errs[i] = w.Close()
+		}(i, offset, length)
+	}
+
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			c.removeParts(names, writers)
+			return err
+		}
+	}
+
+	if numParts > 1 {
+		err := c.Concat(dst, names[1:]...)
+		if err != nil {
+			c.removeParts(names, writers)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// partNames returns the names of the files to write each part to, starting
+// with dst itself. The temporary files get a random token in their names, so
+// that any left behind by an upload that crashed don't get in the way of the
+// next attempt.
+func partNames(dst string, numParts int) ([]string, error) {
+	token := make([]byte, 4)
+	_, err := rand.Read(token)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, numParts)
+	names[0] = dst
+	for i := 1; i < numParts; i++ {
+		names[i] = fmt.Sprintf("%s%s%s_%d", dst, partSuffix, hex.EncodeToString(token), i)
+	}
+
+	return names, nil
+}
+
+// removeParts cleans up after a failed ParallelUpload. Only the files that
+// were actually created are removed.
+func (c *Client) removeParts(names []string, writers []*FileWriter) {
+	for i, name := range names {
+		if writers[i] != nil {
+			c.Remove(name)
+		}
+	}
+}
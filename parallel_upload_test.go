@@ -0,0 +1,73 @@
+package hdfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelUpload(t *testing.T) {
+	client := getClient(t)
+
+	expected, err := ioutil.ReadFile("testdata/mobydick.txt")
+	require.NoError(t, err)
+
+	baleet(t, "/_test/parallelupload.txt")
+	err = client.ParallelUpload(bytes.NewReader(expected), int64(len(expected)), "/_test/parallelupload.txt", 4)
+	ignoreErrReplicating(t, err)
+
+	data, err := client.ReadFile("/_test/parallelupload.txt")
+	require.NoError(t, err)
+	assert.Equal(t, expected, data)
+}
+
+func TestParallelUploadParts(t *testing.T) {
+	client := getClient(t)
+
+	// mobydick.txt is a bit over a megabyte, so with 1MB blocks (the smallest
+	// HDFS allows by default) this ends up as two parts.
+	expected, err := ioutil.ReadFile("testdata/mobydick.txt")
+	require.NoError(t, err)
+
+	baleet(t, "/_test/paralleluploadparts.txt")
+	err = client.parallelUpload(bytes.NewReader(expected), int64(len(expected)),
+		"/_test/paralleluploadparts.txt", 4, 1, 1048576)
+	ignoreErrReplicating(t, err)
+
+	data, err := client.ReadFile("/_test/paralleluploadparts.txt")
+	require.NoError(t, err)
+	assert.Equal(t, expected, data)
+
+	// The temporary files should be gone.
+	infos, err := client.ReadDir("/_test")
+	require.NoError(t, err)
+	for _, info := range infos {
+		assert.False(t, strings.HasPrefix(info.Name(), "paralleluploadparts.txt"+partSuffix), info.Name())
+	}
+}
+
+func TestParallelUploadPartNames(t *testing.T) {
+	names, err := partNames("/foo/bar.txt", 3)
+	require.NoError(t, err)
+	require.Len(t, names, 3)
+	assert.Equal(t, "/foo/bar.txt", names[0])
+	assert.Regexp(t, `^/foo/bar\.txt\._PART_[0-9a-f]{8}_1$`, names[1])
+	assert.Regexp(t, `^/foo/bar\.txt\._PART_[0-9a-f]{8}_2$`, names[2])
+
+	// Another upload to the same file shouldn't reuse the names.
+	others, err := partNames("/foo/bar.txt", 3)
+	require.NoError(t, err)
+	assert.NotEqual(t, names[1], others[1])
+}
+
+func TestParallelUploadExists(t *testing.T) {
+	client := getClient(t)
+
+	err := client.ParallelUpload(bytes.NewReader([]byte("foo")), 3, "/_test/foo.txt", 2)
+	assertPathError(t, err, "create", "/_test/foo.txt", os.ErrExist)
+}
@@ -16,7 +16,7 @@ func (c *Client) Chmod(name string, perm os.FileMode) error {
 	}
 	resp := &hdfs.SetPermissionResponseProto{}
 
-	err := c.namenode.Execute("setPermission", req, resp)
+	err := c.execute("setPermission", req, resp)
 	if err != nil {
 		return &os.PathError{"chmod", name, interpretException(err)}
 	}
@@ -37,7 +37,7 @@ func (c *Client) Chown(name string, user, group string) error {
 	}
 	resp := &hdfs.SetOwnerResponseProto{}
 
-	err := c.namenode.Execute("setOwner", req, resp)
+	err := c.execute("setOwner", req, resp)
 	if err != nil {
 		return &os.PathError{"chown", name, interpretException(err)}
 	}
@@ -54,7 +54,7 @@ func (c *Client) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	}
 	resp := &hdfs.SetTimesResponseProto{}
 
-	err := c.namenode.Execute("setTimes", req, resp)
+	err := c.execute("setTimes", req, resp)
 	if err != nil {
 		return &os.PathError{"chtimes", name, interpretException(err)}
 	}
@@ -71,7 +71,7 @@ func (c *Client) Copytimes(name string, status *hdfs.HdfsFileStatusProto) error
 	}
 	resp := &hdfs.SetTimesResponseProto{}
 
-	err := c.namenode.Execute("setTimes", req, resp)
+	err := c.execute("setTimes", req, resp)
 	if err != nil {
 		return &os.PathError{"copytimes", name, interpretException(err)}
 	}
@@ -0,0 +1,284 @@
+package hdfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// prometheusBuckets are the upper bounds, in seconds, of the histogram
+// buckets used for durations. They're the defaults from the Prometheus
+// client libraries.
+var prometheusBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusObserver is an Observer that aggregates the events from a Client
+// into metrics, and exposes them in the Prometheus text format. It implements
+// http.Handler, so it can be served directly at a /metrics endpoint:
+//
+//	observer := hdfs.NewPrometheusObserver()
+//	client, err := hdfs.NewClient(hdfs.ClientOptions{
+//	    Addresses: []string{"nn1:9000"},
+//	    Observer:  observer,
+//	})
+//	http.Handle("/metrics", observer)
+//
+// The metrics can also be written out with WriteTo, for example to include
+// them in the output of an existing handler. All the metric names are
+// prefixed with "hdfs_".
+type PrometheusObserver struct {
+	lock    sync.Mutex
+	metrics map[string]*prometheusMetric
+}
+
+// prometheusMetric is a counter or histogram, with a value for each distinct
+// set of labels.
+type prometheusMetric struct {
+	name       string
+	help       string
+	histogram  bool
+	counters   map[string]float64
+	histograms map[string]*prometheusHistogram
+}
+
+type prometheusHistogram struct {
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewPrometheusObserver returns a new PrometheusObserver, with all metrics
+// starting at zero.
+func NewPrometheusObserver() *PrometheusObserver {
+	p := &PrometheusObserver{metrics: make(map[string]*prometheusMetric)}
+	p.define("namenode_calls_total", "Number of RPC calls to the namenode.", false)
+	p.define("namenode_call_duration_seconds", "Duration of RPC calls to the namenode.", true)
+	p.define("namenode_failovers_total", "Number of failovers from one namenode to another.", false)
+	p.define("datanode_connects_total", "Number of new connections to datanodes.", false)
+	p.define("datanode_connect_duration_seconds", "Time spent establishing connections to datanodes.", true)
+	p.define("datanode_sasl_duration_seconds", "Time spent on SASL handshakes with datanodes.", true)
+	p.define("blocks_read_total", "Number of blocks read from.", false)
+	p.define("read_bytes_total", "Number of bytes read from blocks.", false)
+	p.define("blocks_written_total", "Number of blocks written to.", false)
+	p.define("written_bytes_total", "Number of bytes written to blocks.", false)
+	p.define("checksum_failures_total", "Number of chunks of data that didn't match their checksums.", false)
+	p.define("retries_total", "Number of operations that failed and were retried.", false)
+	return p
+}
+
+func (p *PrometheusObserver) define(name, help string, histogram bool) {
+	p.metrics[name] = &prometheusMetric{
+		name:       "hdfs_" + name,
+		help:       help,
+		histogram:  histogram,
+		counters:   make(map[string]float64),
+		histograms: make(map[string]*prometheusHistogram),
+	}
+}
+
+// add increments a counter. The labels are given as alternating names and
+// values.
+func (p *PrometheusObserver) add(name string, v float64, labels ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.metrics[name].counters[formatPrometheusLabels(labels)] += v
+}
+
+// observe adds a duration to a histogram.
+func (p *PrometheusObserver) observe(name string, d time.Duration, labels ...string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := formatPrometheusLabels(labels)
+	metric := p.metrics[name]
+	h, ok := metric.histograms[key]
+	if !ok {
+		h = &prometheusHistogram{buckets: make([]uint64, len(prometheusBuckets))}
+		metric.histograms[key] = h
+	}
+
+	v := d.Seconds()
+	for i, bound := range prometheusBuckets {
+		if v <= bound {
+			h.buckets[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+func (p *PrometheusObserver) NamenodeCall(e NamenodeCallEvent) {
+	p.add("namenode_calls_total", 1, "method", e.Method, "result", prometheusResult(e.Err))
+	p.observe("namenode_call_duration_seconds", e.Duration, "method", e.Method)
+}
+
+func (p *PrometheusObserver) DatanodeConnect(e DatanodeConnectEvent) {
+	p.add("datanode_connects_total", 1, "result", prometheusResult(e.Err))
+	p.observe("datanode_connect_duration_seconds", e.ConnectDuration)
+	if e.SaslDuration > 0 {
+		p.observe("datanode_sasl_duration_seconds", e.SaslDuration)
+	}
+}
+
+func (p *PrometheusObserver) BlockRead(e BlockTransferEvent) {
+	p.add("blocks_read_total", 1)
+	p.add("read_bytes_total", float64(e.Bytes))
+}
+
+func (p *PrometheusObserver) BlockWritten(e BlockTransferEvent) {
+	p.add("blocks_written_total", 1, "result", prometheusResult(e.Err))
+	p.add("written_bytes_total", float64(e.Bytes))
+}
+
+func (p *PrometheusObserver) ChecksumFailure(e ChecksumFailureEvent) {
+	p.add("checksum_failures_total", 1)
+}
+
+func (p *PrometheusObserver) Failover(e FailoverEvent) {
+	p.add("namenode_failovers_total", 1)
+}
+
+func (p *PrometheusObserver) Retry(e RetryEvent) {
+	p.add("retries_total", 1, "op", e.Op)
+}
+
+// WriteTo writes out all the metrics in the Prometheus text format.
+func (p *PrometheusObserver) WriteTo(w io.Writer) (int64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	names := make([]string, 0, len(p.metrics))
+	for name := range p.metrics {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		p.metrics[name].writeTo(bw)
+	}
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP implements http.Handler, by writing out all the metrics.
+func (p *PrometheusObserver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+func (m *prometheusMetric) writeTo(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+	if !m.histogram {
+		fmt.Fprintf(w, "# TYPE %s counter\n", m.name)
+		keys := make([]string, 0, len(m.counters))
+		for labels := range m.counters {
+			keys = append(keys, labels)
+		}
+
+		sort.Strings(keys)
+		for _, labels := range keys {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, labels, formatPrometheusValue(m.counters[labels]))
+		}
+
+		return
+	}
+
+	fmt.Fprintf(w, "# TYPE %s histogram\n", m.name)
+	keys := make([]string, 0, len(m.histograms))
+	for labels := range m.histograms {
+		keys = append(keys, labels)
+	}
+
+	sort.Strings(keys)
+	for _, labels := range keys {
+		h := m.histograms[labels]
+		for i, bound := range prometheusBuckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name,
+				withPrometheusLabel(labels, "le", formatPrometheusValue(bound)), h.buckets[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, withPrometheusLabel(labels, "le", "+Inf"), h.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, labels, formatPrometheusValue(h.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, labels, h.count)
+	}
+}
+
+func prometheusResult(err error) string {
+	if err != nil {
+		return "error"
+	}
+
+	return "success"
+}
+
+// formatPrometheusLabels formats alternating label names and values like
+// {name="value",...}, or returns an empty string if there are none.
+func formatPrometheusLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(labels); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(labels[i])
+		b.WriteString(`="`)
+		b.WriteString(escapePrometheusLabel(labels[i+1]))
+		b.WriteByte('"')
+	}
+
+	b.WriteByte('}')
+	return b.String()
+}
+
+// withPrometheusLabel adds a label to a set formatted by
+// formatPrometheusLabels.
+func withPrometheusLabel(labels, name, value string) string {
+	label := name + `="` + escapePrometheusLabel(value) + `"`
+	if labels == "" {
+		return "{" + label + "}"
+	}
+
+	return labels[:len(labels)-1] + "," + label + "}"
+}
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapePrometheusLabel(v string) string {
+	return prometheusLabelEscaper.Replace(v)
+}
+
+func formatPrometheusValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,53 @@
+package hdfs
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusObserver(t *testing.T) {
+	var observer Observer = NewPrometheusObserver()
+	observer.NamenodeCall(NamenodeCallEvent{Method: "getFileInfo", Duration: 20 * time.Millisecond})
+	observer.NamenodeCall(NamenodeCallEvent{Method: "getFileInfo", Duration: 2 * time.Second, Err: errors.New("oops")})
+	observer.DatanodeConnect(DatanodeConnectEvent{ConnectDuration: time.Millisecond, SaslDuration: 30 * time.Millisecond})
+	observer.BlockRead(BlockTransferEvent{Bytes: 1024})
+	observer.BlockRead(BlockTransferEvent{Bytes: 512})
+	observer.Retry(RetryEvent{Op: `a"b`})
+
+	rec := httptest.NewRecorder()
+	observer.(*PrometheusObserver).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+
+	out := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE hdfs_namenode_calls_total counter",
+		`hdfs_namenode_calls_total{method="getFileInfo",result="error"} 1`,
+		`hdfs_namenode_calls_total{method="getFileInfo",result="success"} 1`,
+		"# TYPE hdfs_namenode_call_duration_seconds histogram",
+		`hdfs_namenode_call_duration_seconds_bucket{method="getFileInfo",le="0.01"} 0`,
+		`hdfs_namenode_call_duration_seconds_bucket{method="getFileInfo",le="0.025"} 1`,
+		`hdfs_namenode_call_duration_seconds_bucket{method="getFileInfo",le="2.5"} 2`,
+		`hdfs_namenode_call_duration_seconds_bucket{method="getFileInfo",le="+Inf"} 2`,
+		`hdfs_namenode_call_duration_seconds_sum{method="getFileInfo"} 2.02`,
+		`hdfs_namenode_call_duration_seconds_count{method="getFileInfo"} 2`,
+		`hdfs_datanode_connects_total{result="success"} 1`,
+		`hdfs_datanode_sasl_duration_seconds_bucket{le="0.05"} 1`,
+		"hdfs_blocks_read_total 2",
+		"hdfs_read_bytes_total 1536",
+		`hdfs_retries_total{op="a\"b"} 1`,
+	} {
+		assert.Contains(t, strings.Split(out, "\n"), line)
+	}
+
+	var b strings.Builder
+	n, err := observer.(*PrometheusObserver).WriteTo(&b)
+	require.NoError(t, err)
+	assert.EqualValues(t, len(out), n)
+	assert.Equal(t, out, b.String())
+}
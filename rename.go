@@ -23,7 +23,7 @@ func (c *Client) Rename(oldpath, newpath string) error {
 	}
 	resp := &hdfs.Rename2ResponseProto{}
 
-	err = c.namenode.Execute("rename2", req, resp)
+	err = c.execute("rename2", req, resp)
 	if err != nil {
 		err = interpretException(err)
 		if errors.Is(err, os.ErrExist) {
@@ -51,7 +51,7 @@ func (c *Client) RenameForTrash(oldpath, newpath string) error {
 	}
 	resp := &hdfs.Rename2ResponseProto{}
 
-	err = c.namenode.Execute("rename2", req, resp)
+	err = c.execute("rename2", req, resp)
 	if err != nil {
 		err = interpretException(err)
 		if errors.Is(err, os.ErrExist) {
@@ -16,7 +16,7 @@ func (c *Client) SetReplication(name string, newRep uint32) (bool, error) {
 	}
 	resp := &hdfs.SetReplicationResponseProto{}
 
-	err := c.namenode.Execute("setReplication", req, resp)
+	err := c.execute("setReplication", req, resp)
 	if err != nil {
 		return false, &os.PathError{"setReplication", name, interpretException(err)}
 	} else if resp.Result == nil {
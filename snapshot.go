@@ -13,7 +13,7 @@ func (c *Client) AllowSnapshots(dir string) error {
 	allowSnapshotReq := &hdfs.AllowSnapshotRequestProto{SnapshotRoot: &dir}
 	allowSnapshotRes := &hdfs.AllowSnapshotResponseProto{}
 
-	err := c.namenode.Execute("allowSnapshot", allowSnapshotReq, allowSnapshotRes)
+	err := c.execute("allowSnapshot", allowSnapshotReq, allowSnapshotRes)
 	if err != nil {
 		return interpretException(err)
 	}
@@ -28,7 +28,7 @@ func (c *Client) DisallowSnapshots(dir string) error {
 	disallowSnapshotReq := &hdfs.DisallowSnapshotRequestProto{SnapshotRoot: &dir}
 	disallowSnapshotRes := &hdfs.DisallowSnapshotResponseProto{}
 
-	err := c.namenode.Execute("disallowSnapshot", disallowSnapshotReq, disallowSnapshotRes)
+	err := c.execute("disallowSnapshot", disallowSnapshotReq, disallowSnapshotRes)
 	if err != nil {
 		return interpretException(err)
 	}
@@ -47,7 +47,7 @@ func (c *Client) CreateSnapshot(dir, name string) (string, error) {
 	}
 	allowSnapshotRes := &hdfs.CreateSnapshotResponseProto{}
 
-	err := c.namenode.Execute("createSnapshot", allowSnapshotReq, allowSnapshotRes)
+	err := c.execute("createSnapshot", allowSnapshotReq, allowSnapshotRes)
 	if err != nil {
 		return "", interpretException(err)
 	}
@@ -65,7 +65,7 @@ func (c *Client) DeleteSnapshot(dir, name string) error {
 	}
 	allowSnapshotRes := &hdfs.DeleteSnapshotResponseProto{}
 
-	err := c.namenode.Execute("deleteSnapshot", allowSnapshotReq, allowSnapshotRes)
+	err := c.execute("deleteSnapshot", allowSnapshotReq, allowSnapshotRes)
 	if err != nil {
 		return interpretException(err)
 	}
@@ -22,7 +22,7 @@ type FileStatus = hdfs.HdfsFileStatusProto
 func (c *Client) Exists(name string) (bool, error) {
 	req := &hdfs.GetFileInfoRequestProto{Src: proto.String(name)}
 	resp := &hdfs.GetFileInfoResponseProto{}
-	err := c.namenode.Execute("getFileInfo", req, resp)
+	err := c.execute("getFileInfo", req, resp)
 	if err != nil {
 		return false, &os.PathError{"exists", name, interpretException(err)}
 	}
@@ -44,7 +44,7 @@ func (c *Client) getFileInfo(name string) (os.FileInfo, error) {
 	req := &hdfs.GetFileInfoRequestProto{Src: proto.String(name)}
 	resp := &hdfs.GetFileInfoResponseProto{}
 
-	err := c.namenode.Execute("getFileInfo", req, resp)
+	err := c.execute("getFileInfo", req, resp)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +106,12 @@ func (fi *FileInfo) IsFile() bool {
 	return fi.status.GetFileType() == hdfs.HdfsFileStatusProto_IS_FILE
 }
 
+// IsSymlink returns true if the file is a symbolic link. It's not part of the
+// os.FileInfo interface.
+func (fi *FileInfo) IsSymlink() bool {
+	return fi.status.GetFileType() == hdfs.HdfsFileStatusProto_IS_SYMLINK
+}
+
 // Owner returns the name of the user that owns the file or directory. It's not
 // part of the os.FileInfo interface.
 func (fi *FileInfo) Owner() string {
@@ -124,6 +130,12 @@ func (fi *FileInfo) AccessTime() time.Time {
 	return time.Unix(int64(fi.status.GetAccessTime())/1000, 0)
 }
 
+// BlockSize returns the block size of the file, or 0 for directories. It's not
+// part of the os.FileInfo interface.
+func (fi *FileInfo) BlockSize() int64 {
+	return int64(fi.status.GetBlocksize())
+}
+
 // GetReplication returns the expected block replication.
 // It's not part of the os.FileInfo interface.
 func (fi *FileInfo) GetReplication() int32 {
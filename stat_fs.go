@@ -21,7 +21,7 @@ func (c *Client) StatFs() (FsInfo, error) {
 	req := &hdfs.GetFsStatusRequestProto{}
 	resp := &hdfs.GetFsStatsResponseProto{}
 
-	err := c.namenode.Execute("getFsStats", req, resp)
+	err := c.execute("getFsStats", req, resp)
 	if err != nil {
 		return FsInfo{}, err
 	}
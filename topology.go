@@ -0,0 +1,255 @@
+package hdfs
+
+import (
+	"bufio"
+	"context"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+)
+
+// DefaultRack is the network location used for hosts that a TopologyResolver
+// doesn't know about, like in Hadoop.
+const DefaultRack = "/default-rack"
+
+// A TopologyResolver maps hosts to their network location in the cluster,
+// which is a path like "/datacenter/rack". It's used to find out where the
+// client is, so that it can prefer reading from nearby datanodes; see
+// ClientOptions.TopologyResolver.
+type TopologyResolver interface {
+	// ResolveTopology returns the network location for a host, which may be
+	// given as either a hostname or an IP address. It should return an empty
+	// string if the location is unknown.
+	ResolveTopology(host string) string
+}
+
+// TopologyTable is a TopologyResolver backed by a static mapping of hosts to
+// network locations, like Hadoop's TableMapping.
+type TopologyTable map[string]string
+
+// LoadTopologyTable reads a TopologyTable from a file in the format used by
+// net.topology.table.file.name: one host and location per line, separated by
+// whitespace.
+func LoadTopologyTable(path string) (TopologyTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	table := make(TopologyTable)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			table[fields[0]] = fields[1]
+		}
+	}
+
+	return table, scanner.Err()
+}
+
+// ResolveTopology implements TopologyResolver.
+func (t TopologyTable) ResolveTopology(host string) string {
+	return t[host]
+}
+
+// DefaultTopologyScriptTimeout is used if TopologyScript has a zero Timeout.
+const DefaultTopologyScriptTimeout = 10 * time.Second
+
+// TopologyScript is a TopologyResolver that runs a script to find the location
+// of each host, like Hadoop's ScriptBasedMapping. The script is passed a host
+// as its only argument, and should print the location. If the script fails or
+// times out, the host is placed in DefaultRack. Results are cached, including
+// failures, so that a broken script doesn't slow down every read.
+type TopologyScript struct {
+	// Path is the path to the script, as set by net.topology.script.file.name.
+	Path string
+	// Timeout limits how long the script may run for each host. If it's zero,
+	// DefaultTopologyScriptTimeout is used.
+	Timeout time.Duration
+
+	cache map[string]*topologyScriptResult
+	lock  sync.Mutex
+}
+
+// topologyScriptResult holds the location of a host, once the script
+// finishes. Other lookups for the same host wait on done.
+type topologyScriptResult struct {
+	location string
+	done     chan struct{}
+}
+
+// NewTopologyScript creates a TopologyScript that runs the script at path.
+func NewTopologyScript(path string) *TopologyScript {
+	return &TopologyScript{Path: path}
+}
+
+// ResolveTopology implements TopologyResolver.
+func (s *TopologyScript) ResolveTopology(host string) string {
+	s.lock.Lock()
+	if s.cache == nil {
+		s.cache = make(map[string]*topologyScriptResult)
+	}
+
+	result, ok := s.cache[host]
+	if !ok {
+		result = &topologyScriptResult{done: make(chan struct{})}
+		s.cache[host] = result
+	}
+
+	s.lock.Unlock()
+
+	// The script only runs once per host, and without holding the lock, so
+	// that lookups for other hosts aren't held up by it.
+	if ok {
+		<-result.done
+		return result.location
+	}
+
+	result.location = s.run(host)
+	close(result.done)
+	return result.location
+}
+
+func (s *TopologyScript) run(host string) string {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTopologyScriptTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Output waits until the script's stdout is closed, which can be long
+	// after the script itself is killed if it started any other processes.
+	// So we stop waiting for it once the timeout passes.
+	output := make(chan []byte, 1)
+	go func() {
+		out, err := exec.CommandContext(ctx, s.Path, host).Output()
+		if err != nil {
+			out = nil
+		}
+
+		output <- out
+	}()
+
+	var out []byte
+	select {
+	case out = <-output:
+	case <-ctx.Done():
+	}
+
+	if fields := strings.Fields(string(out)); len(fields) > 0 {
+		return fields[0]
+	}
+
+	return DefaultRack
+}
+
+// topology sorts the replicas for a block by how far away they are from the
+// client.
+type topology struct {
+	resolver TopologyResolver
+
+	clientPath string
+	localIPs   map[string]bool
+	once       sync.Once
+}
+
+func newTopology(resolver TopologyResolver) *topology {
+	return &topology{resolver: resolver}
+}
+
+// init works out where the client is. It's done lazily, since it may involve
+// running a script.
+func (t *topology) init() {
+	t.localIPs = make(map[string]bool)
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				t.localIPs[ipNet.IP.String()] = true
+			}
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "localhost"
+	}
+
+	location := t.resolver.ResolveTopology(hostname)
+	if location == "" {
+		location = DefaultRack
+	}
+
+	t.clientPath = location + "/" + hostname
+}
+
+// sortLocations orders the replicas of a block by their network distance from
+// the client, closest first. Replicas that are equally far away are shuffled,
+// to spread the load between them.
+func (t *topology) sortLocations(block *hdfs.LocatedBlockProto) {
+	t.once.Do(t.init)
+
+	locs := block.GetLocs()
+	distances := make(map[*hdfs.DatanodeInfoProto]int, len(locs))
+	for _, loc := range locs {
+		distances[loc] = t.distance(loc)
+	}
+
+	rand.Shuffle(len(locs), func(i, j int) {
+		locs[i], locs[j] = locs[j], locs[i]
+	})
+
+	sort.SliceStable(locs, func(i, j int) bool {
+		return distances[locs[i]] < distances[locs[j]]
+	})
+}
+
+// distance returns the number of hops between the client and a datanode,
+// which is zero if they're on the same host, two if they're in the same rack,
+// and so on.
+func (t *topology) distance(datanode *hdfs.DatanodeInfoProto) int {
+	id := datanode.GetId()
+	ip := net.ParseIP(id.GetIpAddr())
+	if ip != nil && (ip.IsLoopback() || t.localIPs[ip.String()]) {
+		return 0
+	}
+
+	// The namenode tells us where the datanode is. Only if it doesn't do we
+	// need to fall back to looking it up ourselves.
+	location := datanode.GetLocation()
+	if location == "" {
+		location = t.resolver.ResolveTopology(id.GetIpAddr())
+	}
+
+	if location == "" {
+		location = DefaultRack
+	}
+
+	return networkDistance(t.clientPath, location+"/"+id.GetHostName())
+}
+
+// networkDistance returns the number of hops between two nodes in the network
+// topology, given their full paths.
+func networkDistance(a, b string) int {
+	aParts := strings.Split(strings.Trim(a, "/"), "/")
+	bParts := strings.Split(strings.Trim(b, "/"), "/")
+
+	common := 0
+	for common < len(aParts) && common < len(bParts) && aParts[common] == bParts[common] {
+		common++
+	}
+
+	return (len(aParts) - common) + (len(bParts) - common)
+}
@@ -0,0 +1,118 @@
+package hdfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	hdfs "github.com/colinmarc/hdfs/v2/internal/protocol/hadoop_hdfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNetworkDistance(t *testing.T) {
+	assert.Equal(t, 0, networkDistance("/dc1/rack1/foo", "/dc1/rack1/foo"))
+	assert.Equal(t, 2, networkDistance("/dc1/rack1/foo", "/dc1/rack1/bar"))
+	assert.Equal(t, 4, networkDistance("/dc1/rack1/foo", "/dc1/rack2/bar"))
+	assert.Equal(t, 6, networkDistance("/dc1/rack1/foo", "/dc2/rack1/bar"))
+	assert.Equal(t, 5, networkDistance("/default-rack/foo", "/dc1/rack1/bar"))
+}
+
+func TestLoadTopologyTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.table")
+	err := os.WriteFile(path, []byte("foo /dc1/rack1\n10.0.0.2\t/dc1/rack2\n\nbogus\n"), 0644)
+	require.NoError(t, err)
+
+	table, err := LoadTopologyTable(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/dc1/rack1", table.ResolveTopology("foo"))
+	assert.Equal(t, "/dc1/rack2", table.ResolveTopology("10.0.0.2"))
+	assert.Equal(t, "", table.ResolveTopology("bogus"))
+}
+
+func TestTopologyScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.sh")
+	script := "#!/bin/sh\nif [ \"$1\" = foo ]; then echo /dc1/rack1; else echo /default-rack; fi\n"
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+
+	resolver := NewTopologyScript(path)
+	assert.Equal(t, "/dc1/rack1", resolver.ResolveTopology("foo"))
+	assert.Equal(t, "/default-rack", resolver.ResolveTopology("bar"))
+
+	// Results are cached, so removing the script shouldn't matter.
+	require.NoError(t, os.Remove(path))
+	assert.Equal(t, "/dc1/rack1", resolver.ResolveTopology("foo"))
+	assert.Equal(t, DefaultRack, NewTopologyScript(path).ResolveTopology("foo"))
+}
+
+func TestTopologyScriptTimeout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "topology.sh")
+	script := "#!/bin/sh\nif [ \"$1\" = slow ]; then sleep 10; fi\necho /dc1/rack1\n"
+	require.NoError(t, os.WriteFile(path, []byte(script), 0755))
+
+	resolver := NewTopologyScript(path)
+	resolver.Timeout = 500 * time.Millisecond
+
+	slow := make(chan string)
+	go func() { slow <- resolver.ResolveTopology("slow") }()
+	time.Sleep(50 * time.Millisecond)
+
+	// Looking up another host shouldn't have to wait for the slow one.
+	start := time.Now()
+	assert.Equal(t, "/dc1/rack1", resolver.ResolveTopology("foo"))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	assert.Equal(t, DefaultRack, <-slow)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func topologyTestDatanode(ip, hostname, location string) *hdfs.DatanodeInfoProto {
+	return &hdfs.DatanodeInfoProto{
+		Id: &hdfs.DatanodeIDProto{
+			IpAddr:       proto.String(ip),
+			HostName:     proto.String(hostname),
+			DatanodeUuid: proto.String(hostname),
+			XferPort:     proto.Uint32(9866),
+			InfoPort:     proto.Uint32(9864),
+			IpcPort:      proto.Uint32(9867),
+		},
+		Location: proto.String(location),
+	}
+}
+
+func TestSortLocations(t *testing.T) {
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	topo := newTopology(TopologyTable{
+		hostname:   "/dc1/rack1",
+		"10.0.0.9": "/dc1/rack1",
+	})
+
+	firstRemote := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		block := &hdfs.LocatedBlockProto{
+			Locs: []*hdfs.DatanodeInfoProto{
+				topologyTestDatanode("203.0.113.1", "other-dc", "/dc2/rack1"),
+				topologyTestDatanode("203.0.113.2", "other-rack-a", "/dc1/rack2"),
+				topologyTestDatanode("203.0.113.3", "other-rack-b", "/dc1/rack2"),
+				topologyTestDatanode("10.0.0.9", "same-rack", ""),
+				topologyTestDatanode("127.0.0.1", "local", "/dc1/rack1"),
+			},
+		}
+
+		topo.sortLocations(block)
+		locs := block.GetLocs()
+		assert.Equal(t, "local", locs[0].GetId().GetHostName())
+		assert.Equal(t, "same-rack", locs[1].GetId().GetHostName())
+		assert.Contains(t, []string{"other-rack-a", "other-rack-b"}, locs[2].GetId().GetHostName())
+		assert.Contains(t, []string{"other-rack-a", "other-rack-b"}, locs[3].GetId().GetHostName())
+		assert.Equal(t, "other-dc", locs[4].GetId().GetHostName())
+		firstRemote[locs[2].GetId().GetHostName()]++
+	}
+
+	// Ties should be broken randomly.
+	assert.Len(t, firstRemote, 2)
+}
@@ -20,7 +20,7 @@ func (c *Client) Truncate(name string, size int64) (bool, error) {
 	}
 	resp := &hdfs.TruncateResponseProto{}
 
-	err := c.namenode.Execute("truncate", req, resp)
+	err := c.execute("truncate", req, resp)
 	if err != nil {
 		return false, &os.PathError{"truncate", name, interpretException(err)}
 	} else if resp.Result == nil {
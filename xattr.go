@@ -20,7 +20,7 @@ func (c *Client) ListXAttrs(name string) (map[string]string, error) {
 	req := &hdfs.ListXAttrsRequestProto{Src: proto.String(name)}
 	resp := &hdfs.ListXAttrsResponseProto{}
 
-	err := c.namenode.Execute("listXAttrs", req, resp)
+	err := c.execute("listXAttrs", req, resp)
 	if err != nil {
 		return nil, &os.PathError{"list xattrs", name, interpretException(err)}
 	}
@@ -49,7 +49,7 @@ func (c *Client) GetXAttrs(name string, keys ...string) (map[string]string, erro
 	}
 	resp := &hdfs.GetXAttrsResponseProto{}
 
-	err := c.namenode.Execute("getXAttrs", req, resp)
+	err := c.execute("getXAttrs", req, resp)
 	if err != nil {
 		if isKeyNotFound(err) {
 			return nil, &os.PathError{"get xattrs", name, errXAttrKeysNotFound}
@@ -81,7 +81,7 @@ func (c *Client) SetXAttr(name, key, value string) error {
 		Flag: proto.Uint32(createAndReplace),
 	}
 
-	err = c.namenode.Execute("setXAttr", req, resp)
+	err = c.execute("setXAttr", req, resp)
 	if err != nil {
 		return &os.PathError{"set xattr", name, interpretException(err)}
 	}
@@ -106,7 +106,7 @@ func (c *Client) RemoveXAttr(name, key string) error {
 	}
 	resp := &hdfs.RemoveXAttrResponseProto{}
 
-	err = c.namenode.Execute("removeXAttr", req, resp)
+	err = c.execute("removeXAttr", req, resp)
 	if err != nil {
 		if isKeyNotFound(err) {
 			return &os.PathError{"remove xattr", name, errXAttrKeysNotFound}